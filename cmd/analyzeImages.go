@@ -16,7 +16,11 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/imageprep"
 	"github.com/kubetrail/gini/pkg/run"
 	"github.com/spf13/cobra"
 )
@@ -25,7 +29,17 @@ import (
 var imageCmd = &cobra.Command{
 	Use:   "image",
 	Short: "Analyze images",
-	RunE:  run.AnalyzeImages,
+	Long: `Analyze images
+
+EXIF and other metadata, such as camera details and location, are removed
+from images before they are sent unless --keep-metadata is given.
+Images can be scaled down using --max-dimension and converted to another
+format using --convert-to. JPEG, PNG and WebP images can be resized and
+converted, where WebP images are written losslessly. HEIC and HEIF
+images, as well as images that cannot be decoded, are sent at their size
+and format with a warning and only have their metadata removed. Other
+files, such as PDF documents, are sent as they are.`,
+	RunE: run.AnalyzeImages,
 }
 
 func init() {
@@ -33,7 +47,17 @@ func init() {
 	f := imageCmd.Flags()
 	f.String(flags.Model, flags.Models[flags.DefaultModelIndex], "Model name")
 	f.StringSlice(flags.File, nil, "Image filenames")
-	f.StringSlice(flags.Format, nil, "Image formats (assumes image/jpeg when unspecified)")
+	f.StringSlice(flags.Format, nil, "Image formats (detected from file contents when unspecified)")
+	f.Bool(flags.Stream, false, "Stream response as it is generated")
+	f.String(flags.System, "", "System instruction for the model")
+	f.String(flags.SystemFile, "", "File containing system instruction for the model")
+	f.String(flags.ResponseMimeType, "", fmt.Sprintf("Response mime type (%s, %s)", flags.ResponseMimeTypeText, flags.ResponseMimeTypeJson))
+	f.String(flags.ResponseSchema, "", "JSON schema or YAML file describing the JSON response")
+	f.Int(flags.MaxDimension, 0, "Scale images down to fit within this many pixels (0 keeps size)")
+	f.String(flags.ConvertTo, "", fmt.Sprintf("Convert images to format (%s)", strings.Join(imageprep.Formats, ", ")))
+	f.Int(flags.Quality, 0, fmt.Sprintf("JPEG quality from 1 to 100 (default %d when re-encoding)", imageprep.DefaultQuality))
+	f.Bool(flags.KeepMetadata, false, "Keep EXIF and other metadata of images")
+	f.String(flags.OutputDir, ".", "Directory to save images and other files in responses to")
 	_ = imageCmd.RegisterFlagCompletionFunc(
 		flags.Model,
 		func(
@@ -68,4 +92,36 @@ func init() {
 				cobra.ShellCompDirectiveDefault
 		},
 	)
+
+	_ = imageCmd.RegisterFlagCompletionFunc(
+		flags.ConvertTo,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return imageprep.Formats, cobra.ShellCompDirectiveDefault
+		},
+	)
+
+	_ = imageCmd.RegisterFlagCompletionFunc(
+		flags.ResponseMimeType,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return []string{
+					flags.ResponseMimeTypeText,
+					flags.ResponseMimeTypeJson,
+				},
+				cobra.ShellCompDirectiveDefault
+		},
+	)
 }
@@ -0,0 +1,133 @@
+/*
+Copyright © 2023 kubetrail.io authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/run"
+	"github.com/spf13/cobra"
+)
+
+// askCmd represents the ask command
+var askCmd = &cobra.Command{
+	Use:   "ask [prompt]",
+	Short: "Ask a single question and print the answer",
+	Long: `
+Ask a single question without starting an interactive chat. Content
+piped to stdin is appended to the prompt given as arguments, for example:
+
+git diff | gini ask "write a commit message for this change"
+
+Image generation models respond with images when asked to using
+--response-modalities text,image. Images and other files in responses
+are saved to --output-dir and their paths printed after the text.
+
+Only the response is printed to stdout. Exit code is 2 when the prompt
+or response is blocked, 3 when the response is empty, 4 when the request
+fails at the backend and 1 for invalid usage and other errors.
+`,
+	RunE: run.Ask,
+	// errors are about the response rather than command line usage
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(askCmd)
+	f := askCmd.Flags()
+	f.String(flags.Model, flags.Models[flags.DefaultModelIndex], "Model name")
+	f.StringSlice(flags.File, nil, "Filenames")
+	f.StringSlice(flags.Format, nil, "File formats (detected from file contents when unspecified)")
+	f.String(flags.System, "", "System instruction for the model")
+	f.String(flags.SystemFile, "", "File containing system instruction for the model")
+	f.String(flags.ResponseMimeType, "", fmt.Sprintf("Response mime type (%s, %s)", flags.ResponseMimeTypeText, flags.ResponseMimeTypeJson))
+	f.String(flags.ResponseSchema, "", "JSON schema or YAML file describing the JSON response")
+	f.StringSlice(flags.ResponseModalities, nil, fmt.Sprintf("Response modalities (%s, %s)", flags.ResponseModalityText, flags.ResponseModalityImage))
+	f.String(flags.OutputDir, ".", "Directory to save images and other files in responses to")
+	f.String(flags.CachedContent, "", "Name of cached content to use as context of the question")
+	_ = askCmd.RegisterFlagCompletionFunc(
+		flags.Model,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return flags.Models, cobra.ShellCompDirectiveDefault
+		},
+	)
+
+	_ = askCmd.RegisterFlagCompletionFunc(
+		flags.Format,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return []string{
+					flags.FormatPdf,
+					flags.FormatText,
+					flags.FormatJpeg,
+					flags.FormatPng,
+					flags.FormatHeif,
+					flags.FormatHeic,
+					flags.FormatWebp,
+				},
+				cobra.ShellCompDirectiveDefault
+		},
+	)
+
+	_ = askCmd.RegisterFlagCompletionFunc(
+		flags.ResponseMimeType,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return []string{
+					flags.ResponseMimeTypeText,
+					flags.ResponseMimeTypeJson,
+				},
+				cobra.ShellCompDirectiveDefault
+		},
+	)
+	_ = askCmd.RegisterFlagCompletionFunc(
+		flags.ResponseModalities,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return []string{
+					flags.ResponseModalityText,
+					flags.ResponseModalityImage,
+				},
+				cobra.ShellCompDirectiveDefault
+		},
+	)
+}
@@ -0,0 +1,43 @@
+/*
+Copyright © 2023 kubetrail.io authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage cached content",
+	Long: `
+Manage content cached by the service, such as large documents, so that
+it is not sent and billed in full with every prompt. Use cached content
+with --cached-content flag of chat and ask commands.
+
+Cached content is referred to by its name, the cachedContents/ prefix
+of which can be omitted. It is deleted by the service once it expires.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fmt.Errorf("please use with subcommand")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+}
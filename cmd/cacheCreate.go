@@ -0,0 +1,90 @@
+/*
+Copyright © 2023 kubetrail.io authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"time"
+
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/run"
+	"github.com/spf13/cobra"
+)
+
+// cacheCreateCmd represents the create command
+var cacheCreateCmd = &cobra.Command{
+	Use:   "create [text]",
+	Short: "Cache text and files",
+	Long: `
+Cache text given as arguments along with files and an optional system
+instruction, and print the name of cached content, for example:
+
+gini cache create --model models/gemini-1.5-flash-001 --file report.pdf --ttl 2h
+
+Cached content can only be used with the model it is created for, which
+needs to be a stable model version. The service requires a minimum number
+of tokens to be cached. Expiration defaults to one hour.
+`,
+	RunE: run.CacheCreate,
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheCreateCmd)
+	f := cacheCreateCmd.Flags()
+	f.String(flags.Model, flags.Models[flags.DefaultModelIndex], "Model name")
+	f.StringSlice(flags.File, nil, "Filenames")
+	f.StringSlice(flags.Format, nil, "File formats (detected from file contents when unspecified)")
+	f.String(flags.System, "", "System instruction for the model")
+	f.String(flags.SystemFile, "", "File containing system instruction for the model")
+	f.String(flags.DisplayName, "", "Display name of cached content")
+	f.Duration(flags.TTL, time.Duration(0), "Time to live of cached content, e.g. 30m or 2h")
+	f.String(flags.ExpireTime, "", "Expire time of cached content in RFC3339 format")
+	_ = cacheCreateCmd.RegisterFlagCompletionFunc(
+		flags.Model,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return flags.Models, cobra.ShellCompDirectiveDefault
+		},
+	)
+
+	_ = cacheCreateCmd.RegisterFlagCompletionFunc(
+		flags.Format,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return []string{
+					flags.FormatPdf,
+					flags.FormatText,
+					flags.FormatJpeg,
+					flags.FormatPng,
+					flags.FormatHeif,
+					flags.FormatHeic,
+					flags.FormatWebp,
+				},
+				cobra.ShellCompDirectiveDefault
+		},
+	)
+}
@@ -0,0 +1,33 @@
+/*
+Copyright © 2023 kubetrail.io authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/kubetrail/gini/pkg/run"
+	"github.com/spf13/cobra"
+)
+
+// cacheDeleteCmd represents the delete command
+var cacheDeleteCmd = &cobra.Command{
+	Use:   "delete <name>...",
+	Short: "Delete cached contents",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  run.CacheDelete,
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheDeleteCmd)
+}
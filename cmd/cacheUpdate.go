@@ -0,0 +1,45 @@
+/*
+Copyright © 2023 kubetrail.io authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"time"
+
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/run"
+	"github.com/spf13/cobra"
+)
+
+// cacheUpdateCmd represents the update command
+var cacheUpdateCmd = &cobra.Command{
+	Use:   "update <name>",
+	Short: "Update expiration of cached content",
+	Long: `
+Update expiration of cached content using either a time to live counted
+from now or an absolute expire time, for example:
+
+gini cache update my-cache --ttl 24h
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: run.CacheUpdate,
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheUpdateCmd)
+	f := cacheUpdateCmd.Flags()
+	f.Duration(flags.TTL, time.Duration(0), "Time to live of cached content, e.g. 30m or 2h")
+	f.String(flags.ExpireTime, "", "Expire time of cached content in RFC3339 format")
+}
@@ -16,6 +16,8 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/kubetrail/gini/pkg/flags"
 	"github.com/kubetrail/gini/pkg/run"
 	"github.com/spf13/cobra"
@@ -29,15 +31,80 @@ var chatCmd = &cobra.Command{
 Start an interactive chat with Google Gemini model using this command.
 
 Hit enter twice to send your prompt.
+Pressing Ctrl-C while waiting for a response cancels the request and
+returns to the prompt leaving chat history as it was before it. Pressing
+Ctrl-C at the prompt clears what was typed, and at an empty prompt it
+ends the chat.
+
+When typing at a terminal, the prompt can be edited using arrow keys
+and the usual shortcuts such as Ctrl-A, Ctrl-E, Ctrl-K and Ctrl-W. Up
+and down arrows move between lines of the prompt and recall previous
+prompts, which are kept across chats, and Ctrl-R searches them. Ctrl-J
+or alt-enter start a new line, and so does enter unless it sends the
+prompt as set by --submit-key:
+  double-enter  enter on an empty last line sends the prompt
+  enter         enter sends the prompt
+  alt-enter     alt-enter sends the prompt
+  ctrl-d        Ctrl-D sends the prompt
+Pasted text is inserted as it is, blank lines included, without sending
+the prompt.
 
-Alternatively, if you have blank lines in your text prompt then
-enclose your prompt within {{ and }} as shown below
+Otherwise, such as when input is piped, if you have blank lines in your
+text prompt then enclose your prompt within {{ and }} as shown below
 {{
 This is a prompt with blank lines
 
 
 The prompt ends here
 }}
+
+Following commands can be typed at the prompt to adjust the chat
+without sending anything to the model:
+  /model <name>           switch model keeping chat history
+  /temperature <value>    set model temperature
+  /attach <file> [format] attach file, directory or glob pattern to subsequent prompts
+  /detach [file]...       stop attaching given files or all files
+  /save                   save session now and after every turn
+  /clear                  clear chat history and start a new session
+  /history                print chat history
+  /retry                  send last prompt again replacing its response
+  /undo                   remove last prompt and its response from history
+  /help                   print list of commands
+Start a prompt with // to send it as is when it begins with a slash.
+
+Chats saved with --auto-save can be continued later using --resume
+with either the session file or the session ID.
+
+Directories and glob patterns can be attached using --file, for instance,
+--file ./pkg/... or --file '**/*.go'. Text files found are attached while
+binary files and files ignored by .gitignore or .giniignore are skipped.
+
+Attached files up to 64 KiB are sent inline and larger ones are uploaded.
+Files uploaded by chat are deleted when it ends unless --keep-uploads
+is given, in which case a resumed session reuses them instead of
+uploading them again. Files uploaded using gini files upload can be
+attached by name with --file-uri.
+
+Tools declared in config file can be called by the model when chat is
+started with --enable-tools. Every tool call needs to be confirmed before
+it runs.
+
+Chunks of files most relevant to every prompt are sent along with it when
+chat is started with --index using an index built by gini index build.
+
+Large files can be cached once using gini cache create and used as
+context of the chat with --cached-content instead of being sent along
+with every prompt. The model of cached content is used in that case.
+
+Image generation models respond with images when asked to using
+--response-modalities text,image. Images and other files in responses
+are saved to --output-dir and referenced by path in the chat.
+
+Responses that did not end normally, for instance when cut off by the
+output token limit, are followed by a note on why they ended, as are
+responses citing sources. Responses cut off by the token limit are
+continued automatically, up to 5 times in a row, when chat is started
+with --auto-continue.
 `,
 	RunE: run.Chat,
 }
@@ -47,7 +114,32 @@ func init() {
 	f := chatCmd.Flags()
 	f.String(flags.Model, flags.Models[flags.DefaultModelIndex], "Model name")
 	f.StringSlice(flags.File, nil, "Image filenames")
-	f.StringSlice(flags.Format, nil, "Image formats (assumes application/pdf when unspecified)")
+	f.StringSlice(flags.Format, nil, "File formats (detected from file contents when unspecified)")
+	f.StringSlice(flags.FileUri, nil, "Names of files uploaded beforehand using gini files upload")
+	f.Bool(flags.KeepUploads, false, "Keep uploaded files after chat ends for reuse")
+	f.Bool(flags.Stream, false, "Stream response as it is generated")
+	f.String(flags.System, "", "System instruction for the model")
+	f.String(flags.SystemFile, "", "File containing system instruction for the model")
+	f.String(flags.ResponseMimeType, "", fmt.Sprintf("Response mime type (%s, %s)", flags.ResponseMimeTypeText, flags.ResponseMimeTypeJson))
+	f.String(flags.ResponseSchema, "", "JSON schema or YAML file describing the JSON response")
+	f.StringSlice(flags.ResponseModalities, nil, fmt.Sprintf("Response modalities (%s, %s)", flags.ResponseModalityText, flags.ResponseModalityImage))
+	f.String(flags.OutputDir, ".", "Directory to save images and other files in responses to")
+	f.Bool(flags.AutoContinue, false, "Ask model to continue responses cut off by the output token limit")
+	f.String(flags.SubmitKey, flags.SubmitKeyDoubleEnter,
+		fmt.Sprintf(
+			"Key sending a prompt typed at a terminal (%s, %s, %s, %s)",
+			flags.SubmitKeyDoubleEnter,
+			flags.SubmitKeyEnter,
+			flags.SubmitKeyAltEnter,
+			flags.SubmitKeyCtrlD,
+		),
+	)
+	f.String(flags.Resume, "", "Resume chat from a session file or session ID")
+	f.Bool(flags.Usage, false, "Print token usage after every response")
+	f.Bool(flags.EnableTools, false, "Allow model to call tools declared in config file")
+	f.String(flags.Index, "", "Name of index to retrieve context for every prompt from")
+	f.Int(flags.IndexTopK, 5, "Number of index chunks retrieved for every prompt")
+	f.String(flags.CachedContent, "", "Name of cached content to use as context of the chat")
 	_ = chatCmd.RegisterFlagCompletionFunc(
 		flags.Model,
 		func(
@@ -62,6 +154,26 @@ func init() {
 		},
 	)
 
+	_ = chatCmd.RegisterFlagCompletionFunc(
+		flags.SubmitKey,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return []string{
+					flags.SubmitKeyDoubleEnter,
+					flags.SubmitKeyEnter,
+					flags.SubmitKeyAltEnter,
+					flags.SubmitKeyCtrlD,
+				},
+				cobra.ShellCompDirectiveDefault
+		},
+	)
+
 	_ = chatCmd.RegisterFlagCompletionFunc(
 		flags.Format,
 		func(
@@ -84,4 +196,39 @@ func init() {
 				cobra.ShellCompDirectiveDefault
 		},
 	)
+
+	_ = chatCmd.RegisterFlagCompletionFunc(
+		flags.ResponseMimeType,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return []string{
+					flags.ResponseMimeTypeText,
+					flags.ResponseMimeTypeJson,
+				},
+				cobra.ShellCompDirectiveDefault
+		},
+	)
+	_ = chatCmd.RegisterFlagCompletionFunc(
+		flags.ResponseModalities,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return []string{
+					flags.ResponseModalityText,
+					flags.ResponseModalityImage,
+				},
+				cobra.ShellCompDirectiveDefault
+		},
+	)
 }
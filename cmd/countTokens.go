@@ -0,0 +1,82 @@
+/*
+Copyright © 2023 kubetrail.io authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/run"
+	"github.com/spf13/cobra"
+)
+
+// countTokensCmd represents the tokens command
+var countTokensCmd = &cobra.Command{
+	Use:   "tokens [prompt]",
+	Short: "Count tokens of prompt and files",
+	Long: `
+Count tokens a prompt and attached files consume before sending them
+to the model. Files are uploaded and counted individually followed by
+the total of all inputs together, including the system instruction.
+
+The prompt is read from stdin when neither prompt nor files are given.
+`,
+	RunE: run.CountTokens,
+}
+
+func init() {
+	countCmd.AddCommand(countTokensCmd)
+	f := countTokensCmd.Flags()
+	f.String(flags.Model, flags.Models[flags.DefaultModelIndex], "Model name")
+	f.StringSlice(flags.File, nil, "Filenames")
+	f.StringSlice(flags.Format, nil, "File formats (detected from file contents when unspecified)")
+	f.String(flags.System, "", "System instruction for the model")
+	f.String(flags.SystemFile, "", "File containing system instruction for the model")
+	_ = countTokensCmd.RegisterFlagCompletionFunc(
+		flags.Model,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return flags.Models, cobra.ShellCompDirectiveDefault
+		},
+	)
+
+	_ = countTokensCmd.RegisterFlagCompletionFunc(
+		flags.Format,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return []string{
+					flags.FormatPdf,
+					flags.FormatText,
+					flags.FormatJpeg,
+					flags.FormatPng,
+					flags.FormatHeif,
+					flags.FormatHeic,
+					flags.FormatWebp,
+				},
+				cobra.ShellCompDirectiveDefault
+		},
+	)
+}
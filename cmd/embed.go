@@ -0,0 +1,116 @@
+/*
+Copyright © 2023 kubetrail.io authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"strings"
+
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/run"
+	"github.com/spf13/cobra"
+)
+
+// embedCmd represents the embed command
+var embedCmd = &cobra.Command{
+	Use:   "embed [text]...",
+	Short: "Embed text using an embedding model",
+	Long: `
+Embed text using an embedding model and print the vectors.
+
+Each argument and each file given using --file is embedded as a whole.
+When neither is given, every non-blank line read from stdin is embedded
+separately.
+
+Output format json prints an array of objects with input and values,
+jsonl prints one such object per line and binary writes a compact format:
+4 bytes "GEMB" followed by version, count and dimensions as little endian
+uint32 values, followed by count*dimensions little endian float32 values.
+`,
+	RunE: run.Embed,
+}
+
+func init() {
+	rootCmd.AddCommand(embedCmd)
+	f := embedCmd.Flags()
+	f.String(flags.Model, flags.DefaultEmbeddingModel, "Embedding model name")
+	f.StringSlice(flags.File, nil, "Filenames of text to embed")
+	f.String(flags.TaskType, flags.TaskTypeUnspecified, "Task type the embeddings are used for")
+	f.String(flags.Title, "", "Title of the text (only with retrieval_document task type)")
+	f.String(flags.OutputFormat, flags.OutputFormatJson, "Output format (json, jsonl, binary)")
+	f.StringP(flags.Output, "o", "", "Output filename (default is stdout)")
+	_ = embedCmd.RegisterFlagCompletionFunc(
+		flags.Model,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			var models []string
+			for _, model := range flags.Models {
+				if strings.Contains(model, "embedding") {
+					models = append(models, model)
+				}
+			}
+			return models, cobra.ShellCompDirectiveDefault
+		},
+	)
+
+	_ = embedCmd.RegisterFlagCompletionFunc(
+		flags.TaskType,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return []string{
+					flags.TaskTypeUnspecified,
+					flags.TaskTypeRetrievalQuery,
+					flags.TaskTypeRetrievalDocument,
+					flags.TaskTypeSemanticSimilarity,
+					flags.TaskTypeClassification,
+					flags.TaskTypeClustering,
+					flags.TaskTypeQuestionAnswering,
+					flags.TaskTypeFactVerification,
+				},
+				cobra.ShellCompDirectiveDefault
+		},
+	)
+
+	_ = embedCmd.RegisterFlagCompletionFunc(
+		flags.OutputFormat,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return []string{
+					flags.OutputFormatJson,
+					flags.OutputFormatJsonl,
+					flags.OutputFormatBinary,
+				},
+				cobra.ShellCompDirectiveDefault
+		},
+	)
+}
@@ -0,0 +1,43 @@
+/*
+Copyright © 2023 kubetrail.io authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// filesCmd represents the files command
+var filesCmd = &cobra.Command{
+	Use:   "files",
+	Short: "Manage uploaded files",
+	Long: `
+Manage files uploaded to the service. Uploaded files expire after two
+days and can be attached to chat by name using --file-uri.
+
+Files are referred to by their name, the files/ prefix of which can be
+omitted. Files left behind by interrupted chats can be deleted using
+gini files prune.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fmt.Errorf("please use with subcommand")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(filesCmd)
+}
@@ -0,0 +1,48 @@
+/*
+Copyright © 2023 kubetrail.io authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"time"
+
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/run"
+	"github.com/spf13/cobra"
+)
+
+// filesPruneCmd represents the prune command
+var filesPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete uploaded files",
+	Long: `
+Delete uploaded files older than given age, for instance, to clean up
+files left behind by interrupted chats, or all of them using --all.
+Files are listed and deleted once confirmed, unless --yes is given:
+
+gini files prune --older-than 1h
+`,
+	Args: cobra.NoArgs,
+	RunE: run.FilesPrune,
+}
+
+func init() {
+	filesCmd.AddCommand(filesPruneCmd)
+	f := filesPruneCmd.Flags()
+	f.Duration(flags.OlderThan, time.Duration(0), "Only delete files older than this age, e.g. 1h")
+	f.Bool(flags.All, false, "Delete all uploaded files")
+	f.Bool(flags.DryRun, false, "Print files that would be deleted without deleting them")
+	f.Bool(flags.Yes, false, "Delete files without asking for confirmation")
+}
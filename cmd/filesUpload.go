@@ -0,0 +1,58 @@
+/*
+Copyright © 2023 kubetrail.io authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/run"
+	"github.com/spf13/cobra"
+)
+
+// filesUploadCmd represents the upload command
+var filesUploadCmd = &cobra.Command{
+	Use:   "upload <file>...",
+	Short: "Upload files and print their names",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  run.FilesUpload,
+}
+
+func init() {
+	filesCmd.AddCommand(filesUploadCmd)
+	f := filesUploadCmd.Flags()
+	f.StringSlice(flags.Format, nil, "File formats (detected from file contents when unspecified)")
+	_ = filesUploadCmd.RegisterFlagCompletionFunc(
+		flags.Format,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return []string{
+					flags.FormatPdf,
+					flags.FormatText,
+					flags.FormatJpeg,
+					flags.FormatPng,
+					flags.FormatHeif,
+					flags.FormatHeic,
+					flags.FormatWebp,
+				},
+				cobra.ShellCompDirectiveDefault
+		},
+	)
+}
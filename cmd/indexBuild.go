@@ -0,0 +1,67 @@
+/*
+Copyright © 2023 kubetrail.io authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"strings"
+
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/index"
+	"github.com/kubetrail/gini/pkg/run"
+	"github.com/spf13/cobra"
+)
+
+// indexBuildCmd represents the build command
+var indexBuildCmd = &cobra.Command{
+	Use:   "build <dir>",
+	Short: "Build index of text files in a directory",
+	Long: `
+Build index of text files in a directory by splitting them into chunks
+of whole lines and embedding each chunk. Hidden files and directories,
+binary files and files larger than 1MB are skipped.
+
+Building an index with an existing name replaces it.
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: run.IndexBuild,
+}
+
+func init() {
+	indexCmd.AddCommand(indexBuildCmd)
+	f := indexBuildCmd.Flags()
+	f.String(flags.Name, "", "Index name (default is the directory name)")
+	f.String(flags.Model, flags.DefaultEmbeddingModel, "Embedding model name")
+	f.Int(flags.ChunkSize, index.DefaultChunkSize, "Maximum chunk size in bytes")
+	_ = indexBuildCmd.RegisterFlagCompletionFunc(
+		flags.Model,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			var models []string
+			for _, model := range flags.Models {
+				if strings.Contains(model, "embedding") {
+					models = append(models, model)
+				}
+			}
+			return models, cobra.ShellCompDirectiveDefault
+		},
+	)
+}
@@ -16,10 +16,13 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/run"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -40,6 +43,10 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
+		var exitErr *run.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		os.Exit(1)
 	}
 }
@@ -66,6 +73,8 @@ func init() {
 	f.Float32(flags.Temperature, -1, "Model temperature (-1 means do not configure)")
 	f.Int32(flags.CandidateCount, -1, "Model candidate count (-1 means do not configure)")
 	f.Int32(flags.MaxOutputTokens, -1, "Model max output tokens (-1 means do not configure)")
+	f.Int(flags.RetryMaxAttempts, 5, "Max attempts of requests failing with transient errors (1 means do not retry)")
+	f.Duration(flags.RetryMaxElapsed, time.Minute, "Max time to keep retrying a failing request (0 means no limit)")
 	f.String(flags.AllowHarmProbability, flags.HarmProbabilityNegligible,
 		fmt.Sprintf(
 			"Harm probability (%s, %s, %s, %s, %s)",
@@ -77,6 +86,43 @@ func init() {
 		),
 	)
 
+	blockThresholds := []string{
+		flags.HarmBlockUnspecified,
+		flags.HarmBlockNone,
+		flags.HarmBlockOnlyHigh,
+		flags.HarmBlockMediumAndAbove,
+		flags.HarmBlockLowAndAbove,
+	}
+	f.String(flags.BlockHarassment, flags.HarmBlockUnspecified,
+		fmt.Sprintf("Block threshold of harassment %v", blockThresholds))
+	f.String(flags.BlockHateSpeech, flags.HarmBlockUnspecified,
+		fmt.Sprintf("Block threshold of hate speech %v", blockThresholds))
+	f.String(flags.BlockSexual, flags.HarmBlockUnspecified,
+		fmt.Sprintf("Block threshold of sexually explicit content %v", blockThresholds))
+	f.String(flags.BlockDangerous, flags.HarmBlockUnspecified,
+		fmt.Sprintf("Block threshold of dangerous content %v", blockThresholds))
+
+	for _, name := range []string{
+		flags.BlockHarassment,
+		flags.BlockHateSpeech,
+		flags.BlockSexual,
+		flags.BlockDangerous,
+	} {
+		_ = rootCmd.RegisterFlagCompletionFunc(
+			name,
+			func(
+				cmd *cobra.Command,
+				args []string,
+				toComplete string,
+			) (
+				[]string,
+				cobra.ShellCompDirective,
+			) {
+				return blockThresholds, cobra.ShellCompDirectiveDefault
+			},
+		)
+	}
+
 	_ = rootCmd.RegisterFlagCompletionFunc(
 		flags.AllowHarmProbability,
 		func(
@@ -0,0 +1,42 @@
+/*
+Copyright © 2023 kubetrail.io authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// sessionsCmd represents the sessions command
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "Manage saved chat sessions",
+	Long: `
+Manage chat sessions saved with --auto-save.
+
+Sessions are stored under $XDG_DATA_HOME/gini/sessions, which defaults
+to ~/.local/share/gini/sessions. Sessions can be referred to by their
+full ID or any unambiguous prefix of it.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fmt.Errorf("please use with subcommand")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sessionsCmd)
+}
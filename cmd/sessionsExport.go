@@ -0,0 +1,56 @@
+/*
+Copyright © 2023 kubetrail.io authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/run"
+	"github.com/spf13/cobra"
+)
+
+// sessionsExportCmd represents the export command
+var sessionsExportCmd = &cobra.Command{
+	Use:   "export <id>",
+	Short: "Export session transcript",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run.SessionsExport,
+}
+
+func init() {
+	sessionsCmd.AddCommand(sessionsExportCmd)
+	f := sessionsExportCmd.Flags()
+	f.String(flags.OutputFormat, flags.RenderFormatMarkdown, "Output format (markdown, html, pretty, json)")
+	f.StringP(flags.Output, "o", "", "Output filename (default is stdout)")
+	_ = sessionsExportCmd.RegisterFlagCompletionFunc(
+		flags.OutputFormat,
+		func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) (
+			[]string,
+			cobra.ShellCompDirective,
+		) {
+			return []string{
+					flags.RenderFormatMarkdown,
+					flags.RenderFormatHtml,
+					flags.RenderFormatPretty,
+					flags.OutputFormatJson,
+				},
+				cobra.ShellCompDirectiveDefault
+		},
+	)
+}
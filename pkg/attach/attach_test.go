@@ -0,0 +1,144 @@
+package attach
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "*.go", name: "main.go", want: true},
+		{pattern: "*.go", name: "pkg/main.go", want: false},
+		{pattern: "**/*.go", name: "main.go", want: true},
+		{pattern: "**/*.go", name: "pkg/run/chat.go", want: true},
+		{pattern: "pkg/**", name: "pkg/run/chat.go", want: true},
+		{pattern: "pkg/**/chat.go", name: "pkg/chat.go", want: true},
+		{pattern: "pkg/**/chat.go", name: "cmd/chat.go", want: false},
+		{pattern: "a/?.txt", name: "a/b.txt", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %t, want %t", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{
+		".gitignore":           "*.log\n/build/\n",
+		".giniignore":          "testdata/\n!keep.log\n",
+		"main.go":              "package main\n",
+		"keep.log":             "kept\n",
+		"debug.log":            "ignored\n",
+		"build/out.txt":        "ignored\n",
+		"pkg/run/chat.go":      "package run\n",
+		"pkg/run/logo.png":     "\x89PNG\r\n\x1a\n",
+		"pkg/run/.gitignore":   "generated.go\n",
+		"pkg/run/generated.go": "package run\n",
+		"pkg/testdata/a.txt":   "ignored\n",
+		"pkg/README.md":        "# pkg\n",
+		".git/config":          "[core]\n",
+	})
+
+	tests := []struct {
+		name        string
+		arg         string
+		want        []string
+		wantBinary  int
+		wantIgnored int
+	}{
+		{
+			name:        "recursive directory",
+			arg:         filepath.Join(dir, "pkg") + "/...",
+			want:        []string{"pkg/README.md", "pkg/run/.gitignore", "pkg/run/chat.go"},
+			wantBinary:  1,
+			wantIgnored: 2,
+		},
+		{
+			name:        "plain directory",
+			arg:         dir,
+			want:        []string{".giniignore", ".gitignore", "keep.log", "main.go", "pkg/README.md", "pkg/run/.gitignore", "pkg/run/chat.go"},
+			wantBinary:  1,
+			wantIgnored: 4,
+		},
+		{
+			name:        "glob",
+			arg:         filepath.Join(dir, "**", "*.go"),
+			want:        []string{"main.go", "pkg/run/chat.go"},
+			wantIgnored: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !IsPattern(tt.arg) {
+				t.Fatalf("%s is not a pattern", tt.arg)
+			}
+
+			e, err := Expand(tt.arg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, f := range e.Files {
+				rel, err := filepath.Rel(dir, f.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got files %v, want %v", got, tt.want)
+			}
+			if e.Binary != tt.wantBinary || e.Ignored != tt.wantIgnored {
+				t.Errorf("got %d binary and %d ignored, want %d and %d",
+					e.Binary, e.Ignored, tt.wantBinary, tt.wantIgnored)
+			}
+		})
+	}
+}
+
+func TestIsPattern(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	writeFiles(t, dir, map[string]string{"a.txt": "a"})
+
+	for arg, want := range map[string]bool{
+		file:           false,
+		dir:            true,
+		"./pkg/...":    true,
+		"**/*.go":      true,
+		"missing.txt":  false,
+		"img[0-9].png": true,
+	} {
+		if got := IsPattern(arg); got != want {
+			t.Errorf("IsPattern(%q) = %t, want %t", arg, got, want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Package attach expands directories and glob patterns given as file
+// attachments into the text files they contain, honoring ignore files.
+package attach
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kubetrail/gini/pkg/mimetype"
+)
+
+// recursiveSuffix marks a directory to be attached recursively, as in
+// ./pkg/...
+const recursiveSuffix = "..."
+
+// MaxFiles limits the number of files a single pattern can expand to so
+// that a pattern matching too much is caught early.
+const MaxFiles = 1000
+
+// File is a text file found by expanding a pattern.
+type File struct {
+	Path     string
+	MIMEType string
+	Size     int64
+}
+
+// Expansion lists text files a pattern expands to along with the number
+// of files left out.
+type Expansion struct {
+	Files []File
+	// Binary is the number of matching files skipped for not being text
+	Binary int
+	// Ignored is the number of files and directories skipped by ignore
+	// rules
+	Ignored int
+}
+
+// Size returns total size of expanded files in bytes.
+func (e *Expansion) Size() int64 {
+	var n int64
+	for _, f := range e.Files {
+		n += f.Size
+	}
+
+	return n
+}
+
+// IsPattern reports whether arg refers to more than a single file, i.e.
+// it is a directory, ends with /... or contains glob characters.
+func IsPattern(arg string) bool {
+	if strings.HasSuffix(filepath.ToSlash(arg), recursiveSuffix) || hasMeta(arg) {
+		return true
+	}
+
+	info, err := os.Stat(arg)
+	return err == nil && info.IsDir()
+}
+
+// Expand returns text files under a directory or matching a glob pattern,
+// where ** matches any number of directories. Rules of .gitignore and
+// .giniignore files are honored, including the ones in parent directories
+// up to the root of the git repository, and .git directories are skipped.
+func Expand(arg string) (*Expansion, error) {
+	root, pattern := split(arg)
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	ig := &ignorer{}
+	top := repoRoot(root)
+	if err := loadParents(ig, top, root); err != nil {
+		return nil, fmt.Errorf("failed to read ignore files: %w", err)
+	}
+
+	e := &Expansion{}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(top, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if path == root {
+				return ig.load(path, relBase(rel))
+			}
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if ig.ignored(rel, true) {
+				e.Ignored++
+				return filepath.SkipDir
+			}
+			return ig.load(path, rel)
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		if len(pattern) > 0 {
+			relRoot, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			if !matchGlob(pattern, filepath.ToSlash(relRoot)) {
+				return nil
+			}
+		}
+
+		if ig.ignored(rel, false) {
+			e.Ignored++
+			return nil
+		}
+
+		mimeType, err := mimetype.Detect(path)
+		if err != nil {
+			return err
+		}
+		if !mimetype.IsText(mimeType) {
+			e.Binary++
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if len(e.Files) == MaxFiles {
+			return fmt.Errorf("%s matches more than %d files", arg, MaxFiles)
+		}
+		e.Files = append(e.Files, File{Path: path, MIMEType: mimeType, Size: info.Size()})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand %s: %w", arg, err)
+	}
+
+	sort.Slice(e.Files, func(i, j int) bool { return e.Files[i].Path < e.Files[j].Path })
+
+	return e, nil
+}
+
+// split splits arg into a directory to walk and a slash separated glob
+// pattern matched against paths relative to it, empty to match all files.
+func split(arg string) (string, string) {
+	arg = filepath.ToSlash(arg)
+
+	if strings.HasSuffix(arg, recursiveSuffix) {
+		root := strings.TrimSuffix(arg, recursiveSuffix)
+		if len(root) == 0 {
+			root = "."
+		}
+		return filepath.FromSlash(root), ""
+	}
+
+	if !hasMeta(arg) {
+		return filepath.FromSlash(arg), ""
+	}
+
+	segments := strings.Split(arg, "/")
+	i := 0
+	for i < len(segments) && !hasMeta(segments[i]) {
+		i++
+	}
+
+	root := strings.Join(segments[:i], "/")
+	switch {
+	case i == 1 && len(segments[0]) == 0:
+		root = "/"
+	case len(root) == 0:
+		root = "."
+	}
+
+	return filepath.FromSlash(root), strings.Join(segments[i:], "/")
+}
+
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// repoRoot returns the nearest directory containing dir that holds a .git
+// entry, or dir itself when it is not in a git repository.
+func repoRoot(dir string) string {
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+// loadParents loads ignore files of directories from top down to, but not
+// including, dir.
+func loadParents(ig *ignorer, top, dir string) error {
+	rel, err := filepath.Rel(top, dir)
+	if err != nil || rel == "." {
+		return err
+	}
+
+	path := top
+	base := ""
+	if err := ig.load(path, base); err != nil {
+		return err
+	}
+
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	for _, segment := range segments[:len(segments)-1] {
+		path = filepath.Join(path, segment)
+		base = strings.TrimPrefix(base+"/"+segment, "/")
+		if err := ig.load(path, base); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func relBase(rel string) string {
+	if rel == "." {
+		return ""
+	}
+
+	return rel
+}
@@ -0,0 +1,149 @@
+package attach
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFiles are read in every directory, later rules take precedence.
+var ignoreFiles = []string{".gitignore", ".giniignore"}
+
+// rule is a single pattern of an ignore file following gitignore syntax.
+type rule struct {
+	// base is the slash separated directory of the ignore file relative
+	// to the top directory, empty for the top directory itself
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignorer holds rules of all ignore files read so far.
+type ignorer struct {
+	rules []rule
+}
+
+// load reads ignore files in dir, which is base relative to the top
+// directory. Missing files are not an error.
+func (ig *ignorer) load(dir, base string) error {
+	for _, name := range ignoreFiles {
+		f, err := os.Open(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if r, ok := parseRule(scanner.Text(), base); ok {
+				ig.rules = append(ig.rules, r)
+			}
+		}
+		err = scanner.Err()
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseRule(line, base string) (rule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if len(line) == 0 || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+
+	r := rule{base: base}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		r.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if len(line) == 0 {
+		return rule{}, false
+	}
+	r.pattern = line
+
+	return r, true
+}
+
+// ignored reports whether rel, a slash separated path relative to the top
+// directory, is ignored. The last matching rule decides.
+func (ig *ignorer) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range ig.rules {
+		if r.match(rel, isDir) {
+			ignored = !r.negate
+		}
+	}
+
+	return ignored
+}
+
+func (r rule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	if len(r.base) > 0 {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+
+	if r.anchored {
+		return matchGlob(r.pattern, rel)
+	}
+
+	return matchGlob(r.pattern, path.Base(rel))
+}
+
+// matchGlob matches a slash separated name against pattern, where ** as
+// a whole segment matches any number of segments and other segments are
+// matched using path.Match.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"context"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Backend is the set of operations gini needs from a model provider.
+// The genai implementation is returned by New, and Fake provides an
+// in-process scripted implementation for offline testing.
+type Backend interface {
+	GenerateContent(ctx context.Context, model *Model, parts ...genai.Part) (*genai.GenerateContentResponse, error)
+	GenerateContentStream(ctx context.Context, model *Model, parts ...genai.Part) ResponseIterator
+	StartChat(model *Model) ChatSession
+	CountTokens(ctx context.Context, model *Model, parts ...genai.Part) (*genai.CountTokensResponse, error)
+	EmbedContents(ctx context.Context, model *EmbeddingModel, title string, texts ...string) ([][]float32, error)
+	ListModels(ctx context.Context) ModelIterator
+	CreateCachedContent(ctx context.Context, cc *genai.CachedContent) (*genai.CachedContent, error)
+	GetCachedContent(ctx context.Context, name string) (*genai.CachedContent, error)
+	UpdateCachedContent(ctx context.Context, cc *genai.CachedContent, ccu *genai.CachedContentToUpdate) (*genai.CachedContent, error)
+	DeleteCachedContent(ctx context.Context, name string) error
+	ListCachedContents(ctx context.Context) CachedContentIterator
+	UploadFile(ctx context.Context, path string, opts *genai.UploadFileOptions) (*genai.File, error)
+	GetFile(ctx context.Context, name string) (*genai.File, error)
+	ListFiles(ctx context.Context) FileIterator
+	DeleteFile(ctx context.Context, name string) error
+	Close() error
+}
+
+// Model holds the name and configuration of a generative model.
+type Model struct {
+	Name string
+	genai.GenerationConfig
+	SafetySettings    []*genai.SafetySetting
+	Tools             []*genai.Tool
+	ToolConfig        *genai.ToolConfig
+	SystemInstruction *genai.Content
+	// CachedContent is the name of cached content used as a prefix of
+	// every request. Name must then match the model of the cached content.
+	CachedContent string
+	// ResponseModalities lists modalities, such as ModalityImage, the model
+	// is asked to respond with. Empty leaves it to the model.
+	ResponseModalities []string
+}
+
+// NewModel returns an unconfigured model with given name.
+func NewModel(name string) *Model {
+	return &Model{Name: name}
+}
+
+// EmbeddingModel holds the name and task type of an embedding model.
+type EmbeddingModel struct {
+	Name     string
+	TaskType genai.TaskType
+}
+
+// ChatSession is a multi-turn conversation with a model.
+type ChatSession interface {
+	SendMessage(ctx context.Context, parts ...genai.Part) (*genai.GenerateContentResponse, error)
+	SendMessageStream(ctx context.Context, parts ...genai.Part) ResponseIterator
+	History() []*genai.Content
+	SetHistory(history []*genai.Content)
+}
+
+// ResponseIterator iterates over streamed responses.
+// It is satisfied by *genai.GenerateContentResponseIterator.
+type ResponseIterator interface {
+	Next() (*genai.GenerateContentResponse, error)
+	MergedResponse() *genai.GenerateContentResponse
+}
+
+// ModelIterator iterates over available models.
+// It is satisfied by *genai.ModelInfoIterator.
+type ModelIterator interface {
+	Next() (*genai.ModelInfo, error)
+}
+
+// CachedContentIterator iterates over cached contents.
+// It is satisfied by *genai.CachedContentIterator.
+type CachedContentIterator interface {
+	Next() (*genai.CachedContent, error)
+}
+
+// FileIterator iterates over uploaded files.
+// It is satisfied by *genai.FileIterator.
+type FileIterator interface {
+	Next() (*genai.File, error)
+}
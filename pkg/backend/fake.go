@@ -0,0 +1,504 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+)
+
+// FakeEmbeddingSize is the number of dimensions of fake embeddings.
+const FakeEmbeddingSize = 32
+
+// Reply is a scripted outcome of a single generate or send message call.
+type Reply struct {
+	Response *genai.GenerateContentResponse
+	Err      error
+	// Wait makes the call block until its context is done and fail with
+	// the context error, as a slow request that gets cancelled would.
+	Wait bool
+}
+
+// Request records the model and contents of a single call made to Fake.
+type Request struct {
+	Model    *Model
+	Contents []*genai.Content
+}
+
+// Fake is an in-process Backend that replays scripted replies in order
+// and records every request it receives. It needs no network access
+// and is meant for offline testing.
+type Fake struct {
+	mu     sync.Mutex
+	Script []Reply
+	Models []*genai.ModelInfo
+	Files  map[string]*genai.File
+	// FileStates are states reported by successive GetFile calls of every
+	// uploaded file, which stays in the last one. Uploaded files are
+	// active right away when empty.
+	FileStates []genai.FileState
+	// CachedContents holds cached contents by name, it is created on
+	// first use when nil
+	CachedContents map[string]*genai.CachedContent
+	// EmbedErr fails every EmbedContents call when not nil
+	EmbedErr error
+	Requests []Request
+	Closed   bool
+	// Waiting receives a value whenever a call starts waiting for its
+	// context to be done, when not nil.
+	Waiting  chan struct{}
+	cacheSeq int
+	fileSeq  int
+	pending  map[string][]genai.FileState
+}
+
+// NewFake returns a fake backend that replies with given responses in order.
+func NewFake(responses ...*genai.GenerateContentResponse) *Fake {
+	script := make([]Reply, len(responses))
+	for i, res := range responses {
+		script[i] = Reply{Response: res}
+	}
+
+	return &Fake{
+		Script: script,
+		Files:  make(map[string]*genai.File),
+	}
+}
+
+// TextResponse builds a single candidate response with given text parts.
+func TextResponse(texts ...string) *genai.GenerateContentResponse {
+	parts := make([]genai.Part, len(texts))
+	for i, text := range texts {
+		parts[i] = genai.Text(text)
+	}
+
+	return &genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{
+			{
+				Content:      &genai.Content{Role: "model", Parts: parts},
+				FinishReason: genai.FinishReasonStop,
+			},
+		},
+	}
+}
+
+func (f *Fake) next(ctx context.Context, model *Model, contents []*genai.Content) (*genai.GenerateContentResponse, error) {
+	f.mu.Lock()
+
+	c := *model
+	f.Requests = append(f.Requests, Request{Model: &c, Contents: contents})
+
+	if len(f.Script) == 0 {
+		f.mu.Unlock()
+		return nil, fmt.Errorf("fake: no scripted reply left")
+	}
+
+	reply := f.Script[0]
+	f.Script = f.Script[1:]
+	waiting := f.Waiting
+	f.mu.Unlock()
+
+	if reply.Wait {
+		if waiting != nil {
+			waiting <- struct{}{}
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	return reply.Response, reply.Err
+}
+
+func (f *Fake) GenerateContent(ctx context.Context, model *Model, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	return f.next(ctx, model, []*genai.Content{genai.NewUserContent(parts...)})
+}
+
+func (f *Fake) GenerateContentStream(ctx context.Context, model *Model, parts ...genai.Part) ResponseIterator {
+	res, err := f.GenerateContent(ctx, model, parts...)
+	return &fakeIterator{res: res, err: err}
+}
+
+func (f *Fake) StartChat(model *Model) ChatSession {
+	return &fakeChatSession{f: f, model: model}
+}
+
+func (f *Fake) CountTokens(ctx context.Context, model *Model, parts ...genai.Part) (*genai.CountTokensResponse, error) {
+	var n int32
+	for _, part := range parts {
+		if text, ok := part.(genai.Text); ok {
+			n += int32(len(strings.Fields(string(text))))
+		}
+	}
+
+	return &genai.CountTokensResponse{TotalTokens: n}, nil
+}
+
+// EmbedContents returns bag of words vectors so that texts sharing words
+// are similar. Each call is recorded as a request with one content per text.
+func (f *Fake) EmbedContents(ctx context.Context, model *EmbeddingModel, title string, texts ...string) ([][]float32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.EmbedErr != nil {
+		return nil, f.EmbedErr
+	}
+
+	contents := make([]*genai.Content, len(texts))
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		contents[i] = genai.NewUserContent(genai.Text(text))
+
+		v := make([]float32, FakeEmbeddingSize)
+		for _, word := range strings.Fields(strings.ToLower(text)) {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(strings.Trim(word, ".,;:!?\"'()")))
+			v[h.Sum32()%FakeEmbeddingSize]++
+		}
+		vectors[i] = v
+	}
+	f.Requests = append(f.Requests, Request{Model: &Model{Name: model.Name}, Contents: contents})
+
+	return vectors, nil
+}
+
+func (f *Fake) ListModels(ctx context.Context) ModelIterator {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return &fakeModelIterator{models: append([]*genai.ModelInfo(nil), f.Models...)}
+}
+
+func (f *Fake) UploadFile(ctx context.Context, path string, opts *genai.UploadFileOptions) (*genai.File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Files == nil {
+		f.Files = make(map[string]*genai.File)
+	}
+
+	f.fileSeq++
+	name := fmt.Sprintf("files/fake-%d", f.fileSeq)
+	now := time.Now()
+	file := &genai.File{
+		Name:           name,
+		DisplayName:    filepath.Base(path),
+		SizeBytes:      info.Size(),
+		CreateTime:     now,
+		UpdateTime:     now,
+		ExpirationTime: now.Add(48 * time.Hour),
+		URI:            "https://fake.invalid/" + name,
+		State:          genai.FileStateActive,
+	}
+	if opts != nil {
+		file.DisplayName = opts.DisplayName
+		file.MIMEType = opts.MIMEType
+	}
+	if len(f.FileStates) > 0 {
+		if f.pending == nil {
+			f.pending = make(map[string][]genai.FileState)
+		}
+		file.State = genai.FileStateProcessing
+		f.pending[name] = append([]genai.FileState(nil), f.FileStates...)
+	}
+	f.Files[name] = file
+
+	return file, nil
+}
+
+func (f *Fake) GetFile(ctx context.Context, name string) (*genai.File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, ok := f.Files[name]
+	if !ok {
+		return nil, fmt.Errorf("fake: file %s not found", name)
+	}
+	if states := f.pending[name]; len(states) > 0 {
+		file.State = states[0]
+		if len(states) > 1 {
+			f.pending[name] = states[1:]
+		}
+	}
+	c := *file
+
+	return &c, nil
+}
+
+func (f *Fake) ListFiles(ctx context.Context) FileIterator {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := make([]string, 0, len(f.Files))
+	for name := range f.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	it := &fakeFileIterator{}
+	for _, name := range names {
+		c := *f.Files[name]
+		it.files = append(it.files, &c)
+	}
+
+	return it
+}
+
+func (f *Fake) DeleteFile(ctx context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.Files[name]; !ok {
+		return fmt.Errorf("fake: file %s not found", name)
+	}
+	delete(f.Files, name)
+
+	return nil
+}
+
+func (f *Fake) CreateCachedContent(ctx context.Context, cc *genai.CachedContent) (*genai.CachedContent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.CachedContents == nil {
+		f.CachedContents = make(map[string]*genai.CachedContent)
+	}
+
+	f.cacheSeq++
+	c := *cc
+	c.Name = fmt.Sprintf("cachedContents/fake-%d", f.cacheSeq)
+	if !strings.HasPrefix(c.Model, "models/") {
+		c.Model = "models/" + c.Model
+	}
+	c.CreateTime = time.Now()
+	c.UpdateTime = c.CreateTime
+	c.Expiration = fakeExpiration(cc.Expiration, c.CreateTime)
+
+	var n int32
+	for _, content := range cc.Contents {
+		for _, part := range content.Parts {
+			if text, ok := part.(genai.Text); ok {
+				n += int32(len(strings.Fields(string(text))))
+			}
+		}
+	}
+	c.UsageMetadata = &genai.CachedContentUsageMetadata{TotalTokenCount: n}
+
+	f.CachedContents[c.Name] = &c
+	r := c
+
+	return &r, nil
+}
+
+func (f *Fake) GetCachedContent(ctx context.Context, name string) (*genai.CachedContent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cc, ok := f.CachedContents[name]
+	if !ok {
+		return nil, fmt.Errorf("fake: cached content %s not found", name)
+	}
+	c := *cc
+
+	return &c, nil
+}
+
+func (f *Fake) UpdateCachedContent(ctx context.Context, cc *genai.CachedContent, ccu *genai.CachedContentToUpdate) (*genai.CachedContent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, ok := f.CachedContents[cc.Name]
+	if !ok {
+		return nil, fmt.Errorf("fake: cached content %s not found", cc.Name)
+	}
+	c.UpdateTime = time.Now()
+	if ccu != nil && ccu.Expiration != nil {
+		c.Expiration = fakeExpiration(*ccu.Expiration, c.UpdateTime)
+	}
+	r := *c
+
+	return &r, nil
+}
+
+func (f *Fake) DeleteCachedContent(ctx context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.CachedContents[name]; !ok {
+		return fmt.Errorf("fake: cached content %s not found", name)
+	}
+	delete(f.CachedContents, name)
+
+	return nil
+}
+
+func (f *Fake) ListCachedContents(ctx context.Context) CachedContentIterator {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := make([]string, 0, len(f.CachedContents))
+	for name := range f.CachedContents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	it := &fakeCachedContentIterator{}
+	for _, name := range names {
+		c := *f.CachedContents[name]
+		it.contents = append(it.contents, &c)
+	}
+
+	return it
+}
+
+// fakeExpiration resolves a TTL into an expire time the way the service
+// reports it.
+func fakeExpiration(e genai.ExpireTimeOrTTL, now time.Time) genai.ExpireTimeOrTTL {
+	if e.TTL > 0 {
+		return genai.ExpireTimeOrTTL{ExpireTime: now.Add(e.TTL)}
+	}
+	if e.ExpireTime.IsZero() {
+		return genai.ExpireTimeOrTTL{ExpireTime: now.Add(time.Hour)}
+	}
+
+	return genai.ExpireTimeOrTTL{ExpireTime: e.ExpireTime}
+}
+
+func (f *Fake) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Closed = true
+	return nil
+}
+
+type fakeChatSession struct {
+	f       *Fake
+	model   *Model
+	history []*genai.Content
+}
+
+func (s *fakeChatSession) SendMessage(ctx context.Context, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	s.history = append(s.history, genai.NewUserContent(parts...))
+	res, err := s.f.next(ctx, s.model, append([]*genai.Content(nil), s.history...))
+	if err != nil {
+		return nil, err
+	}
+	s.addToHistory(res)
+
+	return res, nil
+}
+
+func (s *fakeChatSession) SendMessageStream(ctx context.Context, parts ...genai.Part) ResponseIterator {
+	s.history = append(s.history, genai.NewUserContent(parts...))
+	res, err := s.f.next(ctx, s.model, append([]*genai.Content(nil), s.history...))
+
+	return &fakeIterator{res: res, err: err, done: func() { s.addToHistory(res) }}
+}
+
+func (s *fakeChatSession) addToHistory(res *genai.GenerateContentResponse) {
+	if res == nil || len(res.Candidates) == 0 || res.Candidates[0].Content == nil {
+		return
+	}
+
+	c := *res.Candidates[0].Content
+	c.Role = "model"
+	s.history = append(s.history, &c)
+}
+
+func (s *fakeChatSession) History() []*genai.Content {
+	return s.history
+}
+
+func (s *fakeChatSession) SetHistory(history []*genai.Content) {
+	s.history = history
+}
+
+// fakeIterator streams a scripted response as a single chunk.
+type fakeIterator struct {
+	res  *genai.GenerateContentResponse
+	err  error
+	sent bool
+	done func()
+}
+
+func (it *fakeIterator) Next() (*genai.GenerateContentResponse, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	if it.sent {
+		if it.done != nil {
+			it.done()
+			it.done = nil
+		}
+		return nil, iterator.Done
+	}
+	it.sent = true
+
+	return it.res, nil
+}
+
+func (it *fakeIterator) MergedResponse() *genai.GenerateContentResponse {
+	if !it.sent {
+		return nil
+	}
+
+	return it.res
+}
+
+type fakeModelIterator struct {
+	models []*genai.ModelInfo
+}
+
+func (it *fakeModelIterator) Next() (*genai.ModelInfo, error) {
+	if len(it.models) == 0 {
+		return nil, iterator.Done
+	}
+
+	m := it.models[0]
+	it.models = it.models[1:]
+
+	return m, nil
+}
+
+type fakeCachedContentIterator struct {
+	contents []*genai.CachedContent
+}
+
+func (it *fakeCachedContentIterator) Next() (*genai.CachedContent, error) {
+	if len(it.contents) == 0 {
+		return nil, iterator.Done
+	}
+
+	c := it.contents[0]
+	it.contents = it.contents[1:]
+
+	return c, nil
+}
+
+type fakeFileIterator struct {
+	files []*genai.File
+}
+
+func (it *fakeFileIterator) Next() (*genai.File, error) {
+	if len(it.files) == 0 {
+		return nil, iterator.Done
+	}
+
+	f := it.files[0]
+	it.files = it.files[1:]
+
+	return f, nil
+}
@@ -0,0 +1,168 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// maxBatchSize is the maximum number of contents embedded in one request.
+const maxBatchSize = 100
+
+type genaiBackend struct {
+	client *genai.Client
+}
+
+// New returns a backend talking to Google Gemini API using given API key.
+func New(ctx context.Context, apiKey string) (Backend, error) {
+	transport, err := htransport.NewTransport(ctx, http.DefaultTransport, option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http transport: %w", err)
+	}
+
+	// the api key is still needed by the cache client, which does not use
+	// given http clients
+	client, err := genai.NewClient(ctx,
+		option.WithAPIKey(apiKey),
+		option.WithHTTPClient(&http.Client{Transport: &modalitiesTransport{base: transport}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new genai client: %w", err)
+	}
+
+	return &genaiBackend{client: client}, nil
+}
+
+func (b *genaiBackend) model(m *Model) *genai.GenerativeModel {
+	model := b.client.GenerativeModel(m.Name)
+	if len(m.CachedContent) > 0 {
+		model = b.client.GenerativeModelFromCachedContent(&genai.CachedContent{
+			Name:  m.CachedContent,
+			Model: m.Name,
+		})
+	}
+	model.GenerationConfig = m.GenerationConfig
+	model.SafetySettings = m.SafetySettings
+	model.Tools = m.Tools
+	model.ToolConfig = m.ToolConfig
+	model.SystemInstruction = m.SystemInstruction
+	return model
+}
+
+func (b *genaiBackend) GenerateContent(ctx context.Context, model *Model, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	return b.model(model).GenerateContent(withModalities(ctx, model.ResponseModalities), parts...)
+}
+
+func (b *genaiBackend) GenerateContentStream(ctx context.Context, model *Model, parts ...genai.Part) ResponseIterator {
+	return b.model(model).GenerateContentStream(withModalities(ctx, model.ResponseModalities), parts...)
+}
+
+func (b *genaiBackend) StartChat(model *Model) ChatSession {
+	return &genaiChatSession{cs: b.model(model).StartChat(), modalities: model.ResponseModalities}
+}
+
+func (b *genaiBackend) CountTokens(ctx context.Context, model *Model, parts ...genai.Part) (*genai.CountTokensResponse, error) {
+	return b.model(model).CountTokens(ctx, parts...)
+}
+
+func (b *genaiBackend) EmbedContents(ctx context.Context, model *EmbeddingModel, title string, texts ...string) ([][]float32, error) {
+	em := b.client.EmbeddingModel(model.Name)
+	em.TaskType = model.TaskType
+
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(texts))
+
+		batch := em.NewBatch()
+		for _, text := range texts[start:end] {
+			if len(title) > 0 {
+				batch.AddContentWithTitle(title, genai.Text(text))
+			} else {
+				batch.AddContent(genai.Text(text))
+			}
+		}
+
+		res, err := em.BatchEmbedContents(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		if len(res.Embeddings) != end-start {
+			return nil, fmt.Errorf("got %d embeddings for %d contents", len(res.Embeddings), end-start)
+		}
+
+		for _, e := range res.Embeddings {
+			vectors = append(vectors, e.Values)
+		}
+	}
+
+	return vectors, nil
+}
+
+func (b *genaiBackend) ListModels(ctx context.Context) ModelIterator {
+	return b.client.ListModels(ctx)
+}
+
+func (b *genaiBackend) CreateCachedContent(ctx context.Context, cc *genai.CachedContent) (*genai.CachedContent, error) {
+	return b.client.CreateCachedContent(ctx, cc)
+}
+
+func (b *genaiBackend) GetCachedContent(ctx context.Context, name string) (*genai.CachedContent, error) {
+	return b.client.GetCachedContent(ctx, name)
+}
+
+func (b *genaiBackend) UpdateCachedContent(ctx context.Context, cc *genai.CachedContent, ccu *genai.CachedContentToUpdate) (*genai.CachedContent, error) {
+	return b.client.UpdateCachedContent(ctx, cc, ccu)
+}
+
+func (b *genaiBackend) DeleteCachedContent(ctx context.Context, name string) error {
+	return b.client.DeleteCachedContent(ctx, name)
+}
+
+func (b *genaiBackend) ListCachedContents(ctx context.Context) CachedContentIterator {
+	return b.client.ListCachedContents(ctx)
+}
+
+func (b *genaiBackend) UploadFile(ctx context.Context, path string, opts *genai.UploadFileOptions) (*genai.File, error) {
+	return b.client.UploadFileFromPath(ctx, path, opts)
+}
+
+func (b *genaiBackend) GetFile(ctx context.Context, name string) (*genai.File, error) {
+	return b.client.GetFile(ctx, name)
+}
+
+func (b *genaiBackend) ListFiles(ctx context.Context) FileIterator {
+	return b.client.ListFiles(ctx)
+}
+
+func (b *genaiBackend) DeleteFile(ctx context.Context, name string) error {
+	return b.client.DeleteFile(ctx, name)
+}
+
+func (b *genaiBackend) Close() error {
+	return b.client.Close()
+}
+
+type genaiChatSession struct {
+	cs         *genai.ChatSession
+	modalities []string
+}
+
+func (s *genaiChatSession) SendMessage(ctx context.Context, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	return s.cs.SendMessage(withModalities(ctx, s.modalities), parts...)
+}
+
+func (s *genaiChatSession) SendMessageStream(ctx context.Context, parts ...genai.Part) ResponseIterator {
+	return s.cs.SendMessageStream(withModalities(ctx, s.modalities), parts...)
+}
+
+func (s *genaiChatSession) History() []*genai.Content {
+	return s.cs.History
+}
+
+func (s *genaiChatSession) SetHistory(history []*genai.Content) {
+	s.cs.History = history
+}
@@ -0,0 +1,95 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Response modalities a model can be asked to respond with.
+const (
+	ModalityText  = "TEXT"
+	ModalityImage = "IMAGE"
+)
+
+// The genai package has no notion of response modalities yet, which image
+// generation models require to respond with images. They are therefore
+// added to the generation config of generate content requests by the
+// transport of the HTTP client, taking them from the request context.
+
+type modalitiesKey struct{}
+
+// withModalities returns ctx carrying modalities to request.
+func withModalities(ctx context.Context, modalities []string) context.Context {
+	if len(modalities) == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, modalitiesKey{}, modalities)
+}
+
+// modalitiesTransport adds response modalities found in the request
+// context to generate content requests.
+type modalitiesTransport struct {
+	base http.RoundTripper
+}
+
+func (t *modalitiesTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	modalities, _ := req.Context().Value(modalitiesKey{}).([]string)
+	if len(modalities) == 0 || req.Method != http.MethodPost || req.Body == nil ||
+		!strings.HasSuffix(req.URL.Path, ":generateContent") &&
+			!strings.HasSuffix(req.URL.Path, ":streamGenerateContent") {
+		return t.base.RoundTrip(req)
+	}
+
+	b, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	b, err = addModalities(b, modalities)
+	if err != nil {
+		return nil, err
+	}
+
+	// a round tripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	req.ContentLength = int64(len(b))
+
+	return t.base.RoundTrip(req)
+}
+
+// addModalities sets response modalities in the generation config of
+// a JSON encoded request body.
+func addModalities(body []byte, modalities []string) ([]byte, error) {
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, fmt.Errorf("failed to decode request: %w", err)
+	}
+
+	config := make(map[string]json.RawMessage)
+	if raw, ok := request["generationConfig"]; ok {
+		if err := json.Unmarshal(raw, &config); err != nil {
+			return nil, fmt.Errorf("failed to decode generation config: %w", err)
+		}
+	}
+
+	var err error
+	if config["responseModalities"], err = json.Marshal(modalities); err != nil {
+		return nil, err
+	}
+	if request["generationConfig"], err = json.Marshal(config); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(request)
+}
@@ -0,0 +1,67 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestModalitiesTransport(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = nil
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Errorf("invalid request body %q: %v", b, err)
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &modalitiesTransport{base: http.DefaultTransport}}
+	body := `{"contents":[],"generationConfig":{"temperature":0.5}}`
+
+	tests := []struct {
+		name       string
+		path       string
+		modalities []string
+		want       []any
+	}{
+		{name: "generate", path: "/v1beta/models/m:generateContent", modalities: []string{ModalityText, ModalityImage}, want: []any{"TEXT", "IMAGE"}},
+		{name: "stream", path: "/v1beta/models/m:streamGenerateContent", modalities: []string{ModalityImage}, want: []any{"IMAGE"}},
+		{name: "no modalities", path: "/v1beta/models/m:generateContent"},
+		{name: "count tokens", path: "/v1beta/models/m:countTokens", modalities: []string{ModalityImage}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := withModalities(context.Background(), tt.modalities)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+tt.path, strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = res.Body.Close()
+
+			config, _ := got["generationConfig"].(map[string]any)
+			if config["temperature"] != 0.5 {
+				t.Fatalf("generation config was not kept: %v", got)
+			}
+			modalities, _ := config["responseModalities"].([]any)
+			if len(modalities) != len(tt.want) {
+				t.Fatalf("got modalities %v, want %v", modalities, tt.want)
+			}
+			for i := range modalities {
+				if modalities[i] != tt.want[i] {
+					t.Fatalf("got modalities %v, want %v", modalities, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/googleapis/gax-go/v2/apierror"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	defaultInitialDelay = time.Second
+	defaultMaxDelay     = 30 * time.Second
+)
+
+// retryableHTTPCodes are status codes of requests worth retrying.
+var retryableHTTPCodes = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// retryableGRPCCodes are status codes of gRPC calls worth retrying.
+var retryableGRPCCodes = map[codes.Code]bool{
+	codes.ResourceExhausted: true,
+	codes.Unavailable:       true,
+	codes.Internal:          true,
+	codes.Aborted:           true,
+	codes.DeadlineExceeded:  true,
+}
+
+// RetryPolicy sets how calls failing with transient errors are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts made in total, including the
+	// first one. One or less disables retries.
+	MaxAttempts int
+	// MaxElapsed bounds the time spent since the first attempt after which
+	// no more retries are made. Zero means no bound.
+	MaxElapsed time.Duration
+	// InitialDelay is the delay before the first retry, doubling on every
+	// retry up to MaxDelay. Actual delays are randomized to spread retries
+	// of concurrent clients, and server retry hints take precedence when
+	// longer.
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	// Notify is called, when not nil, before waiting for the next attempt
+	// of a call that failed with err.
+	Notify func(attempt, maxAttempts int, delay time.Duration, err error)
+}
+
+// WithRetry returns a backend retrying calls of b that fail with transient
+// errors, such as rate limiting or temporary unavailability, according to
+// policy. Other errors are returned right away. Listings and streams are
+// retried only when failing before yielding anything, and uploads are not
+// retried at all.
+//
+// Note that the genai client already retries unavailable generate requests
+// on its own before they get here.
+func WithRetry(b Backend, policy RetryPolicy) Backend {
+	if policy.InitialDelay <= 0 {
+		policy.InitialDelay = defaultInitialDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = defaultMaxDelay
+	}
+
+	return &retryBackend{b: b, policy: &policy}
+}
+
+// backoff returns the randomized delay before given retry.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.InitialDelay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retrier tracks attempts of a single call.
+type retrier struct {
+	policy  *RetryPolicy
+	attempt int
+	start   time.Time
+}
+
+func (p *RetryPolicy) retrier() *retrier {
+	return &retrier{policy: p, attempt: 1, start: time.Now()}
+}
+
+// wait waits for the next attempt and returns nil when err is transient
+// and the budget of the policy allows it. Otherwise, it returns err, or
+// the context error when ctx is done while waiting.
+func (r *retrier) wait(ctx context.Context, err error) error {
+	if r.attempt >= r.policy.MaxAttempts || ctx.Err() != nil {
+		return err
+	}
+
+	hint, ok := retryHint(err)
+	if !ok {
+		return err
+	}
+
+	delay := max(r.policy.backoff(r.attempt), hint)
+	if r.policy.MaxElapsed > 0 && time.Since(r.start)+delay > r.policy.MaxElapsed {
+		return err
+	}
+
+	r.attempt++
+	if r.policy.Notify != nil {
+		r.policy.Notify(r.attempt, r.policy.MaxAttempts, delay, err)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryHint reports whether err is transient, along with the delay the
+// server asked to wait before retrying, if any.
+func retryHint(err error) (time.Duration, bool) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return 0, false
+	}
+
+	if apiErr, ok := apierror.FromError(err); ok {
+		if code := apiErr.HTTPCode(); code > 0 {
+			if !retryableHTTPCodes[code] {
+				return 0, false
+			}
+		} else if status := apiErr.GRPCStatus(); status == nil || !retryableGRPCCodes[status.Code()] {
+			return 0, false
+		}
+
+		if info := apiErr.Details().RetryInfo; info != nil {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+
+		var httpErr *googleapi.Error
+		if errors.As(err, &httpErr) {
+			return retryAfter(httpErr.Header), true
+		}
+
+		return 0, true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return 0, true
+	}
+
+	return 0, errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryAfter parses the Retry-After header given either as seconds or as
+// a date.
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if len(value) == 0 {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return 0
+}
+
+// retry calls call until it succeeds or fails for good.
+func retry[T any](ctx context.Context, p *RetryPolicy, call func() (T, error)) (T, error) {
+	r := p.retrier()
+	for {
+		v, err := call()
+		if err == nil {
+			return v, nil
+		}
+		if err := r.wait(ctx, err); err != nil {
+			return v, err
+		}
+	}
+}
+
+// nexter is implemented by iterators of the backend.
+type nexter[T any] interface {
+	Next() (T, error)
+}
+
+// retryIterator restarts iterators that fail before yielding anything.
+type retryIterator[T any, I nexter[T]] struct {
+	ctx     context.Context
+	r       *retrier
+	start   func() I
+	it      I
+	yielded bool
+}
+
+func newRetryIterator[T any, I nexter[T]](ctx context.Context, p *RetryPolicy, start func() I) *retryIterator[T, I] {
+	return &retryIterator[T, I]{ctx: ctx, r: p.retrier(), start: start, it: start()}
+}
+
+func (it *retryIterator[T, I]) Next() (T, error) {
+	for {
+		v, err := it.it.Next()
+		if err == nil {
+			it.yielded = true
+			return v, nil
+		}
+		if it.yielded || errors.Is(err, iterator.Done) {
+			return v, err
+		}
+		if err := it.r.wait(it.ctx, err); err != nil {
+			return v, err
+		}
+		it.it = it.start()
+	}
+}
+
+type retryResponseIterator struct {
+	*retryIterator[*genai.GenerateContentResponse, ResponseIterator]
+}
+
+func (it retryResponseIterator) MergedResponse() *genai.GenerateContentResponse {
+	return it.it.MergedResponse()
+}
+
+type retryBackend struct {
+	b      Backend
+	policy *RetryPolicy
+}
+
+func (b *retryBackend) GenerateContent(ctx context.Context, model *Model, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	return retry(ctx, b.policy, func() (*genai.GenerateContentResponse, error) {
+		return b.b.GenerateContent(ctx, model, parts...)
+	})
+}
+
+func (b *retryBackend) GenerateContentStream(ctx context.Context, model *Model, parts ...genai.Part) ResponseIterator {
+	return retryResponseIterator{newRetryIterator[*genai.GenerateContentResponse](ctx, b.policy, func() ResponseIterator {
+		return b.b.GenerateContentStream(ctx, model, parts...)
+	})}
+}
+
+func (b *retryBackend) StartChat(model *Model) ChatSession {
+	return &retryChatSession{cs: b.b.StartChat(model), policy: b.policy}
+}
+
+func (b *retryBackend) CountTokens(ctx context.Context, model *Model, parts ...genai.Part) (*genai.CountTokensResponse, error) {
+	return retry(ctx, b.policy, func() (*genai.CountTokensResponse, error) {
+		return b.b.CountTokens(ctx, model, parts...)
+	})
+}
+
+func (b *retryBackend) EmbedContents(ctx context.Context, model *EmbeddingModel, title string, texts ...string) ([][]float32, error) {
+	return retry(ctx, b.policy, func() ([][]float32, error) {
+		return b.b.EmbedContents(ctx, model, title, texts...)
+	})
+}
+
+func (b *retryBackend) ListModels(ctx context.Context) ModelIterator {
+	return newRetryIterator[*genai.ModelInfo](ctx, b.policy, func() ModelIterator {
+		return b.b.ListModels(ctx)
+	})
+}
+
+func (b *retryBackend) CreateCachedContent(ctx context.Context, cc *genai.CachedContent) (*genai.CachedContent, error) {
+	return retry(ctx, b.policy, func() (*genai.CachedContent, error) {
+		return b.b.CreateCachedContent(ctx, cc)
+	})
+}
+
+func (b *retryBackend) GetCachedContent(ctx context.Context, name string) (*genai.CachedContent, error) {
+	return retry(ctx, b.policy, func() (*genai.CachedContent, error) {
+		return b.b.GetCachedContent(ctx, name)
+	})
+}
+
+func (b *retryBackend) UpdateCachedContent(ctx context.Context, cc *genai.CachedContent, ccu *genai.CachedContentToUpdate) (*genai.CachedContent, error) {
+	return retry(ctx, b.policy, func() (*genai.CachedContent, error) {
+		return b.b.UpdateCachedContent(ctx, cc, ccu)
+	})
+}
+
+func (b *retryBackend) DeleteCachedContent(ctx context.Context, name string) error {
+	_, err := retry(ctx, b.policy, func() (struct{}, error) {
+		return struct{}{}, b.b.DeleteCachedContent(ctx, name)
+	})
+	return err
+}
+
+func (b *retryBackend) ListCachedContents(ctx context.Context) CachedContentIterator {
+	return newRetryIterator[*genai.CachedContent](ctx, b.policy, func() CachedContentIterator {
+		return b.b.ListCachedContents(ctx)
+	})
+}
+
+// UploadFile is not retried since an upload failing after the server
+// has accepted it, such as one timing out waiting for the response, would
+// leave behind a file that is never deleted.
+func (b *retryBackend) UploadFile(ctx context.Context, path string, opts *genai.UploadFileOptions) (*genai.File, error) {
+	return b.b.UploadFile(ctx, path, opts)
+}
+
+func (b *retryBackend) GetFile(ctx context.Context, name string) (*genai.File, error) {
+	return retry(ctx, b.policy, func() (*genai.File, error) {
+		return b.b.GetFile(ctx, name)
+	})
+}
+
+func (b *retryBackend) ListFiles(ctx context.Context) FileIterator {
+	return newRetryIterator[*genai.File](ctx, b.policy, func() FileIterator {
+		return b.b.ListFiles(ctx)
+	})
+}
+
+func (b *retryBackend) DeleteFile(ctx context.Context, name string) error {
+	_, err := retry(ctx, b.policy, func() (struct{}, error) {
+		return struct{}{}, b.b.DeleteFile(ctx, name)
+	})
+	return err
+}
+
+func (b *retryBackend) Close() error {
+	return b.b.Close()
+}
+
+// retryChatSession drops the prompt of a failed attempt from history
+// before sending it again, as the underlying session keeps it.
+type retryChatSession struct {
+	cs     ChatSession
+	policy *RetryPolicy
+}
+
+func (s *retryChatSession) SendMessage(ctx context.Context, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	n := len(s.cs.History())
+	return retry(ctx, s.policy, func() (*genai.GenerateContentResponse, error) {
+		s.rollback(n)
+		return s.cs.SendMessage(ctx, parts...)
+	})
+}
+
+func (s *retryChatSession) SendMessageStream(ctx context.Context, parts ...genai.Part) ResponseIterator {
+	n := len(s.cs.History())
+	return retryResponseIterator{newRetryIterator[*genai.GenerateContentResponse](ctx, s.policy, func() ResponseIterator {
+		s.rollback(n)
+		return s.cs.SendMessageStream(ctx, parts...)
+	})}
+}
+
+func (s *retryChatSession) rollback(n int) {
+	if history := s.cs.History(); len(history) > n {
+		s.cs.SetHistory(history[:n])
+	}
+}
+
+func (s *retryChatSession) History() []*genai.Content {
+	return s.cs.History()
+}
+
+func (s *retryChatSession) SetHistory(history []*genai.Content) {
+	s.cs.SetHistory(history)
+}
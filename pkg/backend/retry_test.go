@@ -0,0 +1,196 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryHint(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantRetry bool
+		wantHint  time.Duration
+	}{
+		{name: "rate limited", err: &googleapi.Error{Code: http.StatusTooManyRequests}, wantRetry: true},
+		{
+			name:      "retry after",
+			err:       &googleapi.Error{Code: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": []string{"3"}}},
+			wantRetry: true,
+			wantHint:  3 * time.Second,
+		},
+		{name: "wrapped", err: fmt.Errorf("failed: %w", &googleapi.Error{Code: http.StatusBadGateway}), wantRetry: true},
+		{name: "bad request", err: &googleapi.Error{Code: http.StatusBadRequest}},
+		{name: "invalid key", err: &googleapi.Error{Code: http.StatusForbidden}},
+		{name: "grpc unavailable", err: status.Error(codes.Unavailable, "unavailable"), wantRetry: true},
+		{name: "grpc invalid argument", err: status.Error(codes.InvalidArgument, "invalid")},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), wantRetry: true},
+		{name: "cancelled", err: context.Canceled},
+		{name: "other", err: errors.New("failed")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hint, retry := retryHint(tt.err)
+			if retry != tt.wantRetry || hint != tt.wantHint {
+				t.Fatalf("got %v, %v, want %v, %v", hint, retry, tt.wantHint, tt.wantRetry)
+			}
+		})
+	}
+}
+
+// testPolicy returns a policy with short delays recording attempts
+// announced by Notify.
+func testPolicy(maxAttempts int, attempts *[]int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:  maxAttempts,
+		InitialDelay: time.Millisecond,
+		MaxDelay:     2 * time.Millisecond,
+		Notify: func(attempt, maxAttempts int, delay time.Duration, err error) {
+			*attempts = append(*attempts, attempt)
+		},
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	unavailable := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	badRequest := &googleapi.Error{Code: http.StatusBadRequest}
+
+	tests := []struct {
+		name         string
+		script       []Reply
+		maxAttempts  int
+		wantErr      error
+		wantRequests int
+		wantAttempts []int
+	}{
+		{
+			name:         "recovers",
+			script:       []Reply{{Err: unavailable}, {Err: unavailable}, {Response: TextResponse("ok")}},
+			maxAttempts:  5,
+			wantRequests: 3,
+			wantAttempts: []int{2, 3},
+		},
+		{
+			name:         "fails fast",
+			script:       []Reply{{Err: badRequest}, {Response: TextResponse("ok")}},
+			maxAttempts:  5,
+			wantErr:      badRequest,
+			wantRequests: 1,
+		},
+		{
+			name:         "gives up",
+			script:       []Reply{{Err: unavailable}, {Err: unavailable}, {Response: TextResponse("ok")}},
+			maxAttempts:  2,
+			wantErr:      unavailable,
+			wantRequests: 2,
+			wantAttempts: []int{2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &Fake{Script: tt.script}
+			var attempts []int
+			b := WithRetry(fake, testPolicy(tt.maxAttempts, &attempts))
+
+			_, err := b.GenerateContent(context.Background(), NewModel("m"), genai.Text("hi"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if len(fake.Requests) != tt.wantRequests {
+				t.Fatalf("got %d requests, want %d", len(fake.Requests), tt.wantRequests)
+			}
+			if !reflect.DeepEqual(attempts, tt.wantAttempts) {
+				t.Fatalf("got attempts %v, want %v", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestWithRetryMaxElapsed(t *testing.T) {
+	fake := &Fake{Script: []Reply{
+		{Err: &googleapi.Error{Code: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"60"}}}},
+		{Response: TextResponse("ok")},
+	}}
+	var attempts []int
+	policy := testPolicy(5, &attempts)
+	policy.MaxElapsed = time.Second
+	b := WithRetry(fake, policy)
+
+	// waiting as long as the server asks would exceed the budget
+	if _, err := b.GenerateContent(context.Background(), NewModel("m"), genai.Text("hi")); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(fake.Requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(fake.Requests))
+	}
+}
+
+func TestWithRetryChat(t *testing.T) {
+	fake := &Fake{Script: []Reply{
+		{Err: &googleapi.Error{Code: http.StatusServiceUnavailable}},
+		{Response: TextResponse("one")},
+		{Err: &googleapi.Error{Code: http.StatusTooManyRequests}},
+		{Response: TextResponse("two")},
+	}}
+	var attempts []int
+	cs := WithRetry(fake, testPolicy(3, &attempts)).StartChat(NewModel("m"))
+
+	if _, err := cs.SendMessage(context.Background(), genai.Text("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	it := cs.SendMessageStream(context.Background(), genai.Text("second"))
+	for {
+		if _, err := it.Next(); err != nil {
+			break
+		}
+	}
+	if res := it.MergedResponse(); res == nil || res.Candidates[0].Content.Parts[0] != genai.Text("two") {
+		t.Fatalf("got merged response %v, want two", res)
+	}
+
+	// failed attempts leave no prompt behind in history
+	if n := len(cs.History()); n != 4 {
+		t.Fatalf("got %d contents in history, want 4", n)
+	}
+	if n := len(fake.Requests[3].Contents); n != 3 {
+		t.Fatalf("got %d contents in last request, want 3", n)
+	}
+}
+
+// failingUpload fails every upload after counting it.
+type failingUpload struct {
+	*Fake
+	uploads int
+}
+
+func (b *failingUpload) UploadFile(ctx context.Context, path string, opts *genai.UploadFileOptions) (*genai.File, error) {
+	b.uploads++
+	return nil, &googleapi.Error{Code: http.StatusGatewayTimeout}
+}
+
+func TestWithRetryUpload(t *testing.T) {
+	b := &failingUpload{Fake: NewFake()}
+	var attempts []int
+
+	// the server may have stored the file before timing out
+	if _, err := WithRetry(b, testPolicy(5, &attempts)).UploadFile(context.Background(), "a.pdf", nil); err == nil {
+		t.Fatal("expected error")
+	}
+	if b.uploads != 1 || len(attempts) != 0 {
+		t.Fatalf("got %d uploads and retries %v, want a single upload", b.uploads, attempts)
+	}
+}
@@ -0,0 +1,82 @@
+// Package embedding encodes embedding vectors for downstream use.
+package embedding
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// magic identifies the binary format.
+var magic = [4]byte{'G', 'E', 'M', 'B'}
+
+const version = 1
+
+// header precedes vectors in binary format.
+type header struct {
+	Magic      [4]byte
+	Version    uint32
+	Count      uint32
+	Dimensions uint32
+}
+
+// WriteBinary writes vectors of equal length in a compact binary format.
+// It consists of 4 bytes "GEMB" followed by version, count and dimensions
+// as little endian uint32 values, followed by count*dimensions little
+// endian float32 values.
+func WriteBinary(w io.Writer, vectors [][]float32) error {
+	var dims int
+	if len(vectors) > 0 {
+		dims = len(vectors[0])
+	}
+
+	for i, v := range vectors {
+		if len(v) != dims {
+			return fmt.Errorf("vector %d has %d dimensions, want %d", i, len(v), dims)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	h := header{Magic: magic, Version: version, Count: uint32(len(vectors)), Dimensions: uint32(dims)}
+	if err := binary.Write(bw, binary.LittleEndian, h); err != nil {
+		return err
+	}
+
+	for _, v := range vectors {
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ReadBinary reads vectors written by WriteBinary.
+func ReadBinary(r io.Reader) ([][]float32, error) {
+	var h header
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if h.Magic != magic {
+		return nil, fmt.Errorf("not an embeddings file")
+	}
+	if h.Version != version {
+		return nil, fmt.Errorf("unsupported embeddings file version %d", h.Version)
+	}
+	if uint64(h.Count)*uint64(h.Dimensions) > math.MaxInt32 {
+		return nil, fmt.Errorf("embeddings file is too large")
+	}
+
+	vectors := make([][]float32, h.Count)
+	for i := range vectors {
+		vectors[i] = make([]float32, h.Dimensions)
+		if err := binary.Read(r, binary.LittleEndian, vectors[i]); err != nil {
+			return nil, fmt.Errorf("failed to read vector %d: %w", i, err)
+		}
+	}
+
+	return vectors, nil
+}
@@ -0,0 +1,43 @@
+package embedding
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	vectors := [][]float32{{0.5, -1, 2}, {3, 0, -0.25}}
+
+	var buf bytes.Buffer
+	if err := WriteBinary(&buf, vectors); err != nil {
+		t.Fatal(err)
+	}
+
+	// header of 16 bytes followed by 6 float32 values
+	if buf.Len() != 16+6*4 {
+		t.Fatalf("got %d bytes, want %d", buf.Len(), 16+6*4)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("GEMB")) {
+		t.Fatalf("missing magic in %q", buf.Bytes()[:4])
+	}
+
+	got, err := ReadBinary(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, vectors) {
+		t.Fatalf("got %v, want %v", got, vectors)
+	}
+}
+
+func TestBinaryErrors(t *testing.T) {
+	if err := WriteBinary(&bytes.Buffer{}, [][]float32{{1, 2}, {1}}); err == nil {
+		t.Fatal("expected error for vectors of different lengths")
+	}
+
+	if _, err := ReadBinary(strings.NewReader("JSON{}..........")); err == nil || !strings.Contains(err.Error(), "not an embeddings file") {
+		t.Fatalf("got error %v, want not an embeddings file", err)
+	}
+}
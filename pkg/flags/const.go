@@ -6,6 +6,10 @@ const (
 	AutoSave             = "auto-save"
 	Render               = "render"
 	AllowHarmProbability = "allow-harm-probability"
+	BlockHarassment      = "block-harassment"
+	BlockHateSpeech      = "block-hate-speech"
+	BlockSexual          = "block-sexually-explicit"
+	BlockDangerous       = "block-dangerous-content"
 	TopK                 = "top-k"
 	TopP                 = "top-p"
 	Temperature          = "temperature"
@@ -13,6 +17,42 @@ const (
 	MaxOutputTokens      = "max-output-tokens"
 	File                 = "file"
 	Format               = "format"
+	Stream               = "stream"
+	Resume               = "resume"
+	OutputFormat         = "output-format"
+	Output               = "output"
+	System               = "system"
+	SystemFile           = "system-file"
+	Usage                = "usage"
+	ResponseMimeType     = "response-mime-type"
+	ResponseSchema       = "response-schema"
+	EnableTools          = "enable-tools"
+	TaskType             = "task-type"
+	Title                = "title"
+	Name                 = "name"
+	ChunkSize            = "chunk-size"
+	Index                = "index"
+	IndexTopK            = "index-top-k"
+	CachedContent        = "cached-content"
+	DisplayName          = "display-name"
+	TTL                  = "ttl"
+	ExpireTime           = "expire-time"
+	KeepUploads          = "keep-uploads"
+	FileUri              = "file-uri"
+	OlderThan            = "older-than"
+	DryRun               = "dry-run"
+	All                  = "all"
+	Yes                  = "yes"
+	MaxDimension         = "max-dimension"
+	ConvertTo            = "convert-to"
+	Quality              = "quality"
+	KeepMetadata         = "keep-metadata"
+	OutputDir            = "output-dir"
+	ResponseModalities   = "response-modalities"
+	AutoContinue         = "auto-continue"
+	RetryMaxAttempts     = "retry-max-attempts"
+	RetryMaxElapsed      = "retry-max-elapsed"
+	SubmitKey            = "submit-key"
 )
 
 const (
@@ -21,6 +61,33 @@ const (
 	RenderFormatPretty   = "pretty"
 )
 
+const (
+	OutputFormatJson   = "json"
+	OutputFormatJsonl  = "jsonl"
+	OutputFormatBinary = "binary"
+)
+
+const (
+	TaskTypeUnspecified        = "unspecified"
+	TaskTypeRetrievalQuery     = "retrieval_query"
+	TaskTypeRetrievalDocument  = "retrieval_document"
+	TaskTypeSemanticSimilarity = "semantic_similarity"
+	TaskTypeClassification     = "classification"
+	TaskTypeClustering         = "clustering"
+	TaskTypeQuestionAnswering  = "question_answering"
+	TaskTypeFactVerification   = "fact_verification"
+)
+
+const (
+	ResponseMimeTypeText = "text/plain"
+	ResponseMimeTypeJson = "application/json"
+)
+
+const (
+	ResponseModalityText  = "text"
+	ResponseModalityImage = "image"
+)
+
 const (
 	FormatPng  = "image/png"
 	FormatJpeg = "image/jpeg"
@@ -40,7 +107,8 @@ const (
 )
 
 const (
-	DefaultModelIndex = 23
+	DefaultModelIndex     = 23
+	DefaultEmbeddingModel = "models/text-embedding-004"
 )
 
 var Models = []string{
@@ -111,3 +179,18 @@ const (
 	HarmProbabilityMedium      = "medium"
 	HarmProbabilityHigh        = "high"
 )
+
+const (
+	HarmBlockUnspecified    = "unspecified"
+	HarmBlockNone           = "none"
+	HarmBlockOnlyHigh       = "only-high"
+	HarmBlockMediumAndAbove = "medium-and-above"
+	HarmBlockLowAndAbove    = "low-and-above"
+)
+
+const (
+	SubmitKeyDoubleEnter = "double-enter"
+	SubmitKeyEnter       = "enter"
+	SubmitKeyAltEnter    = "alt-enter"
+	SubmitKeyCtrlD       = "ctrl-d"
+)
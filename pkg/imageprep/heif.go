@@ -0,0 +1,292 @@
+package imageprep
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// HEIF images, which include HEIC photos, keep EXIF and XMP metadata as
+// items of the meta box whose data is located by the item location box.
+// Since the image cannot be decoded in pure Go, metadata is removed by
+// overwriting the data of those items with zeros, leaving the structure
+// of the file intact.
+
+// box is an ISO base media file box.
+type box struct {
+	typ string
+	// start and end are offsets of the box payload, which follows the
+	// header, within the file
+	start, end int
+}
+
+// readBoxes returns boxes found between offsets start and end of data.
+func readBoxes(data []byte, start, end int) ([]box, error) {
+	var boxes []box
+	for p := start; p < end; {
+		if p+8 > end {
+			return nil, errTruncated
+		}
+		size := int(binary.BigEndian.Uint32(data[p:]))
+		typ := string(data[p+4 : p+8])
+		header := 8
+		switch size {
+		case 0:
+			size = end - p
+		case 1:
+			if p+16 > end {
+				return nil, errTruncated
+			}
+			size = int(binary.BigEndian.Uint64(data[p+8:]))
+			header = 16
+		}
+		if size < header || p+size > end {
+			return nil, errTruncated
+		}
+
+		boxes = append(boxes, box{typ: typ, start: p + header, end: p + size})
+		p += size
+	}
+
+	return boxes, nil
+}
+
+func findBox(boxes []box, typ string) (box, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+
+	return box{}, false
+}
+
+// stripHEIF zeroes data of EXIF and XMP items of a HEIF image.
+func stripHEIF(data []byte) ([]byte, error) {
+	top, err := readBoxes(data, 0, len(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(top) == 0 || top[0].typ != "ftyp" {
+		return nil, errors.New("not a heif image")
+	}
+
+	meta, ok := findBox(top, "meta")
+	if !ok {
+		return data, nil
+	}
+	// meta is a full box with version and flags before its children
+	children, err := readBoxes(data, meta.start+4, meta.end)
+	if err != nil {
+		return nil, err
+	}
+
+	iinf, ok := findBox(children, "iinf")
+	if !ok {
+		return data, nil
+	}
+	items, err := metadataItems(data, iinf)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return data, nil
+	}
+
+	iloc, ok := findBox(children, "iloc")
+	if !ok {
+		return nil, errors.New("item locations are missing")
+	}
+	idat, _ := findBox(children, "idat")
+	extents, err := itemExtents(data, iloc, idat, items)
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, data...)
+	for _, e := range extents {
+		clear(out[e[0]:e[1]])
+	}
+
+	return out, nil
+}
+
+// metadataItems returns IDs of EXIF and XMP items listed in the item
+// information box.
+func metadataItems(data []byte, iinf box) (map[uint32]bool, error) {
+	r := &boxReader{data: data, p: iinf.start, end: iinf.end}
+	version := r.uint(1)
+	r.skip(3)
+	if version == 0 {
+		r.uint(2)
+	} else {
+		r.uint(4)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	entries, err := readBoxes(data, r.p, iinf.end)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make(map[uint32]bool)
+	for _, infe := range entries {
+		if infe.typ != "infe" {
+			continue
+		}
+
+		r := &boxReader{data: data, p: infe.start, end: infe.end}
+		version := r.uint(1)
+		r.skip(3)
+		// item types were introduced in version 2
+		if version < 2 {
+			continue
+		}
+		var id uint32
+		if version == 2 {
+			id = r.uint(2)
+		} else {
+			id = r.uint(4)
+		}
+		r.skip(2)
+		typ := r.string(4)
+		r.cstring()
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		switch typ {
+		case "Exif":
+			items[id] = true
+		case "mime":
+			if r.cstring() == "application/rdf+xml" {
+				items[id] = true
+			}
+		}
+	}
+
+	return items, nil
+}
+
+// itemExtents returns start and end offsets of data of items within the
+// file. Data can be stored anywhere in the file or in the item data box.
+func itemExtents(data []byte, iloc, idat box, items map[uint32]bool) ([][2]int, error) {
+	r := &boxReader{data: data, p: iloc.start, end: iloc.end}
+	version := r.uint(1)
+	r.skip(3)
+	sizes := r.uint(2)
+	offsetSize, lengthSize := int(sizes>>12), int(sizes>>8&0xf)
+	baseOffsetSize, indexSize := int(sizes>>4&0xf), int(sizes&0xf)
+	if version == 0 {
+		indexSize = 0
+	}
+
+	var count uint32
+	if version < 2 {
+		count = r.uint(2)
+	} else {
+		count = r.uint(4)
+	}
+
+	var extents [][2]int
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		var id uint32
+		if version < 2 {
+			id = r.uint(2)
+		} else {
+			id = r.uint(4)
+		}
+		method := uint32(0)
+		if version > 0 {
+			method = r.uint(2) & 0xf
+		}
+		r.skip(2)
+		base := r.uint(baseOffsetSize)
+		n := r.uint(2)
+
+		for j := uint32(0); j < n && r.err == nil; j++ {
+			r.skip(indexSize)
+			offset := int(base) + int(r.uint(offsetSize))
+			length := int(r.uint(lengthSize))
+			if !items[id] || length == 0 {
+				continue
+			}
+
+			switch method {
+			case 0:
+			case 1:
+				offset += idat.start
+			default:
+				return nil, errors.New("metadata stored by reference to other items is not supported")
+			}
+			if offset < 0 || offset+length > len(data) {
+				return nil, errTruncated
+			}
+			extents = append(extents, [2]int{offset, offset + length})
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return extents, nil
+}
+
+// boxReader reads big endian fields of a box payload, recording the
+// first error.
+type boxReader struct {
+	data   []byte
+	p, end int
+	err    error
+}
+
+func (r *boxReader) skip(n int) {
+	if r.err == nil && r.p+n > r.end {
+		r.err = errTruncated
+	}
+	r.p += n
+}
+
+// uint reads an unsigned integer of n bytes. Eight byte offsets are
+// truncated, which is of no concern for files smaller than 4 GiB.
+func (r *boxReader) uint(n int) uint32 {
+	start := r.p
+	r.skip(n)
+	if r.err != nil {
+		return 0
+	}
+
+	var v uint32
+	for _, b := range r.data[start:r.p] {
+		v = v<<8 | uint32(b)
+	}
+	return v
+}
+
+func (r *boxReader) string(n int) string {
+	start := r.p
+	r.skip(n)
+	if r.err != nil {
+		return ""
+	}
+	return string(r.data[start:r.p])
+}
+
+// cstring reads a string terminated by a zero byte, which may be missing
+// at the end of the box.
+func (r *boxReader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+
+	start := r.p
+	for r.p < r.end && r.data[r.p] != 0 {
+		r.p++
+	}
+	s := string(r.data[start:r.p])
+	if r.p < r.end {
+		r.p++
+	}
+	return s
+}
@@ -0,0 +1,224 @@
+// Package imageprep prepares images before they are sent to a model by
+// resizing them, converting them to another format and removing metadata
+// such as EXIF data with camera details and location. It is written in
+// pure Go, hence HEIC and HEIF images cannot be decoded, although their
+// metadata can be removed.
+package imageprep
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatWebP = "webp"
+
+	// DefaultQuality is the JPEG quality used when none is given.
+	DefaultQuality = 90
+)
+
+// Formats lists formats images can be converted to.
+var Formats = []string{FormatJPEG, FormatPNG, FormatWebP}
+
+// Options control how an image is prepared. The zero value removes
+// metadata and leaves the image as it is otherwise.
+type Options struct {
+	// MaxDimension limits width and height of the image, which is scaled
+	// down keeping its aspect ratio. Zero leaves the size as it is.
+	MaxDimension int
+	// Format is the format to convert to, empty to keep the format.
+	Format string
+	// Quality is the JPEG quality from 1 to 100, zero for the default.
+	// Giving it re-encodes JPEG images.
+	Quality int
+	// KeepMetadata keeps metadata of images that are not re-encoded.
+	// Re-encoded images never carry metadata over.
+	KeepMetadata bool
+}
+
+// Validate returns an error for options out of range.
+func (o Options) Validate() error {
+	if o.MaxDimension < 0 {
+		return fmt.Errorf("max dimension cannot be negative")
+	}
+	if o.Quality < 0 || o.Quality > 100 {
+		return fmt.Errorf("quality needs to be between 1 and 100")
+	}
+
+	switch o.Format {
+	case "", FormatJPEG, FormatPNG, FormatWebP:
+		return nil
+	default:
+		return fmt.Errorf("invalid format %s, needs to be one of %v", o.Format, Formats)
+	}
+}
+
+// Result is a prepared image.
+type Result struct {
+	Data     []byte
+	MIMEType string
+	// Width and Height are set for re-encoded images only.
+	Width, Height int
+	// Reencoded tells whether the image was decoded and encoded again as
+	// opposed to having its metadata removed at most.
+	Reencoded bool
+	// Warning tells why an image that cannot be decoded was left at its
+	// size and format.
+	Warning string
+}
+
+// Supported reports whether files of type mimeType can be prepared. Other
+// files, such as PDF documents, are left as they are by Process.
+func Supported(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/webp", "image/heic", "image/heif":
+		return true
+	default:
+		return false
+	}
+}
+
+// Process prepares an image of type mimeType according to opts. Files of
+// types that are not supported are returned unchanged. Images that cannot
+// be decoded, such as HEIC images, keep their size and format and only have
+// their metadata removed, with a warning set on the result.
+func Process(data []byte, mimeType string, opts Options) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if !Supported(mimeType) {
+		return &Result{Data: data, MIMEType: mimeType}, nil
+	}
+
+	format := formatOf(mimeType)
+	var warning string
+	reencode, err := needsReencoding(data, mimeType, opts)
+	if err != nil {
+		warning = err.Error()
+	}
+
+	var img image.Image
+	if reencode {
+		img, err = imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+		if err != nil {
+			warning = fmt.Sprintf("failed to decode image: %v", err)
+			reencode = false
+		}
+	}
+
+	if !reencode {
+		if opts.KeepMetadata {
+			return &Result{Data: data, MIMEType: mimeType, Warning: warning}, nil
+		}
+		stripped, err := strip(data, mimeType)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Data: stripped, MIMEType: mimeType, Warning: warning}, nil
+	}
+
+	if m := opts.MaxDimension; m > 0 {
+		if b := img.Bounds(); b.Dx() > m || b.Dy() > m {
+			img = imaging.Fit(img, m, m, imaging.Lanczos)
+		}
+	}
+
+	if len(opts.Format) > 0 {
+		format = opts.Format
+	}
+	out, err := encode(img, format, opts.Quality)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image as %s: %w", format, err)
+	}
+
+	return &Result{
+		Data:      out,
+		MIMEType:  "image/" + format,
+		Width:     img.Bounds().Dx(),
+		Height:    img.Bounds().Dy(),
+		Reencoded: true,
+	}, nil
+}
+
+// formatOf returns the format of mimeType or an empty string for types
+// that cannot be decoded.
+func formatOf(mimeType string) string {
+	switch mimeType {
+	case "image/jpeg":
+		return FormatJPEG
+	case "image/png":
+		return FormatPNG
+	case "image/webp":
+		return FormatWebP
+	default:
+		return ""
+	}
+}
+
+// needsReencoding reports whether an image needs to be decoded to apply
+// opts, returning an error when it cannot be decoded, in which case it
+// does not need to be re-encoded.
+func needsReencoding(data []byte, mimeType string, opts Options) (bool, error) {
+	format := formatOf(mimeType)
+	reencode := len(opts.Format) > 0 && opts.Format != format ||
+		opts.Quality > 0 && (opts.Format == FormatJPEG || len(opts.Format) == 0 && format == FormatJPEG)
+
+	if !reencode && opts.MaxDimension > 0 && len(format) > 0 {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return false, fmt.Errorf("failed to decode image: %w", err)
+		}
+		reencode = cfg.Width > opts.MaxDimension || cfg.Height > opts.MaxDimension
+	}
+
+	if len(format) == 0 && (reencode || opts.MaxDimension > 0) {
+		return false, fmt.Errorf("%s images cannot be resized or converted, only JPEG, PNG and WebP images can", mimeType)
+	}
+
+	return reencode, nil
+}
+
+func encode(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case FormatJPEG:
+		if quality == 0 {
+			quality = DefaultQuality
+		}
+		// jpeg has no transparency, transparent areas are shown white
+		if !opaque(img) {
+			b := img.Bounds()
+			img = imaging.Overlay(imaging.New(b.Dx(), b.Dy(), color.White), img, image.Point{}, 1)
+		}
+		err = imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(quality))
+	case FormatPNG:
+		err = imaging.Encode(&buf, img, imaging.PNG)
+	case FormatWebP:
+		err = encodeWebP(&buf, img)
+	default:
+		err = fmt.Errorf("unsupported format")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+
+	return false
+}
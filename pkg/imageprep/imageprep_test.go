@@ -0,0 +1,458 @@
+package imageprep
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func testImage(width, height int, alpha bool) *image.NRGBA {
+	r := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{
+				R: uint8(x * 255 / width),
+				G: uint8(y * 255 / height),
+				B: uint8(r.Intn(256)),
+				A: 0xff,
+			}
+			if alpha {
+				c.A = uint8(r.Intn(256))
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestEncodeWebP(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		alpha         bool
+		fill          func(img *image.NRGBA)
+	}{
+		{name: "single pixel", width: 1, height: 1},
+		{name: "odd size", width: 37, height: 23},
+		{name: "alpha", width: 64, height: 48, alpha: true},
+		{name: "single row", width: 97, height: 1},
+		{name: "single column", width: 1, height: 97},
+		{name: "large", width: 300, height: 200, alpha: true},
+		{
+			name: "flat", width: 20, height: 20,
+			fill: func(img *image.NRGBA) {
+				for i := range img.Pix {
+					img.Pix[i] = 0x80
+				}
+			},
+		},
+		{
+			name: "transparent", width: 20, height: 20,
+			fill: func(img *image.NRGBA) {
+				for i := range img.Pix {
+					img.Pix[i] = 0
+				}
+			},
+		},
+		{
+			name: "noise", width: 128, height: 128,
+			fill: func(img *image.NRGBA) {
+				r := rand.New(rand.NewSource(2))
+				for i := range img.Pix {
+					img.Pix[i] = uint8(r.Intn(256))
+				}
+			},
+		},
+		{
+			// values with exponentially falling frequencies need code
+			// lengths to be limited
+			name: "skewed", width: 256, height: 256,
+			fill: func(img *image.NRGBA) {
+				r := rand.New(rand.NewSource(3))
+				for i := range img.Pix {
+					v := 0
+					for v < 40 && r.Intn(2) == 0 {
+						v++
+					}
+					img.Pix[i] = uint8(v * 6)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := testImage(tt.width, tt.height, tt.alpha)
+			if tt.fill != nil {
+				tt.fill(img)
+			}
+
+			var buf bytes.Buffer
+			if err := encodeWebP(&buf, img); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nrgba, ok := got.(*image.NRGBA)
+			if !ok {
+				t.Fatalf("got %T, want *image.NRGBA", got)
+			}
+			if !bytes.Equal(nrgba.Pix, img.Pix) {
+				t.Fatal("decoded pixels differ from encoded ones")
+			}
+		})
+	}
+}
+
+func TestEncodeWebPSize(t *testing.T) {
+	for _, size := range []image.Rectangle{
+		image.Rect(0, 0, 0, 10),
+		image.Rect(0, 0, vp8lMaxSize+1, 1),
+	} {
+		if err := encodeWebP(&bytes.Buffer{}, image.NewNRGBA(size)); err == nil {
+			t.Fatalf("%v: want error", size)
+		}
+	}
+}
+
+// exifSegment returns an APP1 segment with orientation and a string that
+// stands for location data.
+func exifSegment(orientation int) []byte {
+	tiff := []byte{
+		'I', 'I', 42, 0, 8, 0, 0, 0,
+		2, 0,
+		0x12, 0x01, 3, 0, 1, 0, 0, 0, byte(orientation), 0, 0, 0,
+		0x25, 0x88, 2, 0, 4, 0, 0, 0, 'G', 'P', 'S', 0,
+		0, 0, 0, 0,
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(2+len(payload)))
+
+	return append(segment, payload...)
+}
+
+func TestStripJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(16, 8, false), nil); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+
+	comment := []byte{0xff, 0xfe, 0, 10, 'G', 'P', 'S', ' ', 'h', 'e', 'r', 'e'}
+	tests := []struct {
+		name            string
+		segments        []byte
+		trailer         []byte
+		wantOrientation int
+	}{
+		{name: "exif with orientation", segments: exifSegment(6), wantOrientation: 6},
+		{name: "exif with default orientation", segments: exifSegment(1)},
+		{name: "comment and trailing data", segments: comment, trailer: []byte("GPS")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append(append(append([]byte{}, plain[:2]...), tt.segments...), plain[2:]...)
+			data = append(data, tt.trailer...)
+
+			got, err := stripJPEG(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(got, []byte("GPS")) {
+				t.Fatal("metadata was not removed")
+			}
+			if len(tt.trailer) == 0 && len(got) > len(data) {
+				t.Fatalf("got %d bytes, more than %d", len(got), len(data))
+			}
+
+			orientation := 0
+			if i := bytes.Index(got, exifHeader); i >= 0 {
+				orientation, _ = exifOrientation(got[i:])
+			}
+			if orientation != tt.wantOrientation {
+				t.Fatalf("got orientation %d, want %d", orientation, tt.wantOrientation)
+			}
+
+			if _, err := jpeg.Decode(bytes.NewReader(got)); err != nil {
+				t.Fatalf("stripped image does not decode: %v", err)
+			}
+		})
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(8, 8, false)); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+
+	text := []byte("Location\x00GPS")
+	chunk := make([]byte, 8, 12+len(text))
+	binary.BigEndian.PutUint32(chunk, uint32(len(text)))
+	copy(chunk[4:], "tEXt")
+	chunk = append(append(chunk, text...), 0, 0, 0, 0)
+	// the chunk follows IHDR
+	data := append(append(append([]byte{}, plain[:33]...), chunk...), plain[33:]...)
+
+	got, err := stripPNG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatal("text chunk was not removed")
+	}
+}
+
+// webpData is a lossless 1x1 WebP image.
+var webpData = []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00")
+
+func TestStripWebP(t *testing.T) {
+	plain := webpData
+
+	vp8x := []byte{'V', 'P', '8', 'X', 10, 0, 0, 0, vp8xFlagEXIF, 0, 0, 0, 7, 0, 0, 7, 0, 0}
+	exif := []byte{'E', 'X', 'I', 'F', 3, 0, 0, 0, 'G', 'P', 'S', 0}
+	data := append(append(append(append([]byte{}, plain[:12]...), vp8x...), plain[12:]...), exif...)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+
+	got, err := stripWebP(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(got, []byte("GPS")) {
+		t.Fatal("exif chunk was not removed")
+	}
+	if got[20]&vp8xFlagEXIF != 0 {
+		t.Fatal("exif flag was not cleared")
+	}
+	if binary.LittleEndian.Uint32(got[4:]) != uint32(len(got)-8) {
+		t.Fatal("riff size was not updated")
+	}
+}
+
+// heifBox returns a box of type typ holding payload.
+func heifBox(typ string, payload ...[]byte) []byte {
+	b := []byte{0, 0, 0, 0}
+	b = append(b, typ...)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)))
+
+	return b
+}
+
+func TestStripHEIF(t *testing.T) {
+	exif := []byte("\x00\x00\x00\x06Exif\x00\x00GPS data")
+	image := []byte("image data")
+
+	build := func(exifOffset int) []byte {
+		ftyp := heifBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+		iinf := heifBox("iinf", []byte{0, 0, 0, 0, 0, 2},
+			heifBox("infe", []byte{2, 0, 0, 0, 0, 1, 0, 0}, []byte("hvc1\x00")),
+			heifBox("infe", []byte{2, 0, 0, 0, 0, 2, 0, 0}, []byte("Exif\x00")),
+		)
+		// version 0 with 4 byte offsets and lengths and no base offset
+		iloc := heifBox("iloc", []byte{0, 0, 0, 0, 0x44, 0x00, 0, 2},
+			[]byte{0, 1, 0, 0, 0, 1}, be32(exifOffset+len(exif)), be32(len(image)),
+			[]byte{0, 2, 0, 0, 0, 1}, be32(exifOffset), be32(len(exif)),
+		)
+		meta := heifBox("meta", []byte{0, 0, 0, 0}, heifBox("hdlr", make([]byte, 24)), iinf, iloc)
+		return append(append([]byte{}, ftyp...), meta...)
+	}
+
+	head := build(0)
+	// item data follows the mdat header
+	offset := len(head) + 8
+	data := append(build(offset), heifBox("mdat", exif, image)...)
+
+	got, err := stripHEIF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(data) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(data))
+	}
+	if bytes.Contains(got, []byte("GPS")) {
+		t.Fatal("exif item was not cleared")
+	}
+	if !bytes.HasSuffix(got, image) {
+		t.Fatal("image item was changed")
+	}
+}
+
+func be32(n int) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(n))
+}
+
+func TestProcess(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(200, 100, false)); err != nil {
+		t.Fatal(err)
+	}
+	pngData := buf.Bytes()
+
+	var webpBuf bytes.Buffer
+	if err := encodeWebP(&webpBuf, testImage(200, 100, false)); err != nil {
+		t.Fatal(err)
+	}
+	largeWebPData := webpBuf.Bytes()
+
+	tests := []struct {
+		name        string
+		data        []byte
+		mimeType    string
+		opts        Options
+		wantMIME    string
+		wantWidth   int
+		wantHeight  int
+		wantWarning bool
+		wantErr     bool
+	}{
+		{
+			name:     "metadata only",
+			data:     pngData,
+			mimeType: "image/png",
+			wantMIME: "image/png",
+		},
+		{
+			name:     "smaller than max dimension",
+			data:     pngData,
+			mimeType: "image/png",
+			opts:     Options{MaxDimension: 400},
+			wantMIME: "image/png",
+		},
+		{
+			name:       "resize",
+			data:       pngData,
+			mimeType:   "image/png",
+			opts:       Options{MaxDimension: 50},
+			wantMIME:   "image/png",
+			wantWidth:  50,
+			wantHeight: 25,
+		},
+		{
+			name:       "convert to jpeg",
+			data:       pngData,
+			mimeType:   "image/png",
+			opts:       Options{Format: FormatJPEG, Quality: 50},
+			wantMIME:   "image/jpeg",
+			wantWidth:  200,
+			wantHeight: 100,
+		},
+		{
+			name:       "convert webp",
+			data:       webpData,
+			mimeType:   "image/webp",
+			opts:       Options{Format: FormatPNG},
+			wantMIME:   "image/png",
+			wantWidth:  1,
+			wantHeight: 1,
+		},
+		{
+			name:        "heic left at its size",
+			data:        heifBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic")),
+			mimeType:    "image/heic",
+			opts:        Options{MaxDimension: 64},
+			wantMIME:    "image/heic",
+			wantWarning: true,
+		},
+		{
+			name:        "undecodable png left as is",
+			data:        []byte("\x89PNG\r\n\x1a\n"),
+			mimeType:    "image/png",
+			opts:        Options{Format: FormatJPEG},
+			wantMIME:    "image/png",
+			wantWarning: true,
+		},
+		{
+			name:       "convert to webp",
+			data:       pngData,
+			mimeType:   "image/png",
+			opts:       Options{Format: FormatWebP, MaxDimension: 64},
+			wantMIME:   "image/webp",
+			wantWidth:  64,
+			wantHeight: 32,
+		},
+		{
+			name:       "resized webp stays webp",
+			data:       largeWebPData,
+			mimeType:   "image/webp",
+			opts:       Options{MaxDimension: 64},
+			wantMIME:   "image/webp",
+			wantWidth:  64,
+			wantHeight: 32,
+		},
+		{
+			name:     "pdf left as is",
+			data:     []byte("%PDF-1.7"),
+			mimeType: "application/pdf",
+			opts:     Options{Format: FormatJPEG, MaxDimension: 64},
+			wantMIME: "application/pdf",
+		},
+		{
+			name:     "invalid format",
+			data:     pngData,
+			mimeType: "image/png",
+			opts:     Options{Format: "gif"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Process(tt.data, tt.mimeType, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if (len(res.Warning) > 0) != tt.wantWarning {
+				t.Fatalf("got warning %q, want warning %t", res.Warning, tt.wantWarning)
+			}
+			if res.MIMEType != tt.wantMIME {
+				t.Fatalf("got mime type %s, want %s", res.MIMEType, tt.wantMIME)
+			}
+			if res.Reencoded != (tt.wantWidth > 0) {
+				t.Fatalf("got reencoded %t", res.Reencoded)
+			}
+			if res.Width != tt.wantWidth || res.Height != tt.wantHeight {
+				t.Fatalf("got %dx%d, want %dx%d", res.Width, res.Height, tt.wantWidth, tt.wantHeight)
+			}
+
+			if !Supported(tt.mimeType) || tt.wantWarning {
+				if !bytes.Equal(res.Data, tt.data) {
+					t.Fatal("data was changed")
+				}
+				return
+			}
+
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(res.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if "image/"+format != tt.wantMIME {
+				t.Fatalf("data is %s, want %s", format, tt.wantMIME)
+			}
+			if res.Reencoded && (cfg.Width != res.Width || cfg.Height != res.Height) {
+				t.Fatalf("data is %dx%d", cfg.Width, cfg.Height)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package imageprep
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var errTruncated = errors.New("image data is truncated")
+
+const (
+	markerSOI   = 0xd8
+	markerEOI   = 0xd9
+	markerSOS   = 0xda
+	markerAPP0  = 0xe0
+	markerAPP1  = 0xe1
+	markerAPP2  = 0xe2
+	markerAPP14 = 0xee
+	markerAPP15 = 0xef
+	markerCOM   = 0xfe
+
+	orientationTag = 0x0112
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// stripJPEG removes EXIF, XMP, IPTC, comments and other application
+// segments from a JPEG image, keeping JFIF, ICC profile and Adobe
+// segments that affect how colors are decoded. An orientation other than
+// the default is kept in a minimal EXIF segment so that the image is not
+// shown rotated. Data following the end of the image, such as secondary
+// images of multi-picture files, is dropped.
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != markerSOI {
+		return nil, errors.New("not a jpeg image")
+	}
+
+	out := []byte{0xff, markerSOI}
+	// segments preceding the first scan are held back until the
+	// orientation is known, which then follows the JFIF segment
+	var header []byte
+	orientation := 0
+	scanning := false
+
+	for p := 2; ; {
+		// markers may be preceded by any number of fill bytes
+		for p+1 < len(data) && data[p] == 0xff && data[p+1] == 0xff {
+			p++
+		}
+		if p+2 > len(data) || data[p] != 0xff {
+			return nil, errTruncated
+		}
+		marker := data[p+1]
+		if marker == markerEOI {
+			return append(out, 0xff, markerEOI), nil
+		}
+		if p+4 > len(data) {
+			return nil, errTruncated
+		}
+		end := p + 2 + int(binary.BigEndian.Uint16(data[p+2:]))
+		if end > len(data) {
+			return nil, errTruncated
+		}
+		segment := data[p:end]
+		p = end
+
+		switch {
+		case scanning:
+			if keepSegment(marker, segment[4:]) {
+				out = append(out, segment...)
+			}
+		case marker == markerAPP0:
+			out = append(out, segment...)
+		case marker == markerAPP1:
+			if o, ok := exifOrientation(segment[4:]); ok && orientation == 0 {
+				orientation = o
+			}
+		case keepSegment(marker, segment[4:]):
+			header = append(header, segment...)
+		}
+
+		if marker != markerSOS {
+			continue
+		}
+		if !scanning {
+			if orientation > 1 {
+				out = append(out, orientationSegment(orientation)...)
+			}
+			out = append(out, header...)
+			scanning = true
+		}
+
+		// entropy coded data runs up to the next marker other than a
+		// restart marker or a stuffed zero byte
+		start := p
+		for p+1 < len(data) && (data[p] != 0xff || data[p+1] == 0 || data[p+1] >= 0xd0 && data[p+1] <= 0xd7) {
+			p++
+		}
+		if p+1 >= len(data) {
+			return nil, errTruncated
+		}
+		out = append(out, data[start:p]...)
+	}
+}
+
+// keepSegment reports whether a JPEG segment is needed to decode the
+// image. Application segments are dropped except for JFIF, ICC profiles
+// and Adobe color transform, as are comments.
+func keepSegment(marker byte, payload []byte) bool {
+	switch {
+	case marker == markerAPP0, marker == markerAPP14:
+		return true
+	case marker == markerAPP2:
+		return bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+	case marker >= markerAPP0 && marker <= markerAPP15, marker == markerCOM:
+		return false
+	default:
+		return true
+	}
+}
+
+// exifOrientation returns the orientation tag of EXIF data that starts
+// with the Exif header.
+func exifOrientation(b []byte) (int, bool) {
+	if !bytes.HasPrefix(b, exifHeader) {
+		return 0, false
+	}
+	tiff := b[len(exifHeader):]
+	if len(tiff) < 8 {
+		return 0, false
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0, false
+	}
+	n := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < n; i++ {
+		e := ifd + 2 + 12*i
+		if e+12 > len(tiff) {
+			return 0, false
+		}
+		if order.Uint16(tiff[e:]) == orientationTag {
+			o := int(order.Uint16(tiff[e+8:]))
+			return o, o >= 1 && o <= 8
+		}
+	}
+
+	return 0, false
+}
+
+// orientationSegment returns an APP1 segment holding EXIF data with only
+// the orientation tag.
+func orientationSegment(orientation int) []byte {
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8,
+		// one entry of type short and count one
+		0, 1,
+		byte(orientationTag >> 8), byte(orientationTag & 0xff), 0, 3, 0, 0, 0, 1,
+		0, byte(orientation), 0, 0,
+		// no next directory
+		0, 0, 0, 0,
+	}
+
+	payload := append(append([]byte{}, exifHeader...), tiff...)
+	segment := []byte{0xff, markerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(2+len(payload)))
+
+	return append(segment, payload...)
+}
+
+// pngMetadataChunks are ancillary chunks holding text, EXIF data and
+// modification time.
+var pngMetadataChunks = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"eXIf": true,
+	"tIME": true,
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// stripPNG removes text, EXIF and time chunks from a PNG image.
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("not a png image")
+	}
+
+	out := append([]byte{}, pngSignature...)
+	for p := len(pngSignature); p < len(data); {
+		if p+12 > len(data) {
+			return nil, errTruncated
+		}
+		end := p + 12 + int(binary.BigEndian.Uint32(data[p:]))
+		if end > len(data) || end < p {
+			return nil, errTruncated
+		}
+
+		if !pngMetadataChunks[string(data[p+4:p+8])] {
+			out = append(out, data[p:end]...)
+		}
+		p = end
+	}
+
+	return out, nil
+}
+
+const (
+	vp8xFlagEXIF = 0x08
+	vp8xFlagXMP  = 0x04
+)
+
+// stripWebP removes EXIF and XMP chunks from a WebP image.
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("not a webp image")
+	}
+
+	out := append([]byte{}, data[:12]...)
+	for p := 12; p < len(data); {
+		if p+8 > len(data) {
+			return nil, errTruncated
+		}
+		size := int(binary.LittleEndian.Uint32(data[p+4:]))
+		end := p + 8 + size + size%2
+		if end > len(data) {
+			// the padding byte of the last chunk is at times missing
+			if p+8+size != len(data) {
+				return nil, errTruncated
+			}
+			end = len(data)
+		}
+
+		switch string(data[p : p+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte{}, data[p:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= vp8xFlagEXIF | vp8xFlagXMP
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[p:end]...)
+		}
+		p = end
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+// strip removes metadata from an image of type mimeType.
+func strip(data []byte, mimeType string) ([]byte, error) {
+	var out []byte
+	var err error
+	switch mimeType {
+	case "image/jpeg":
+		out, err = stripJPEG(data)
+	case "image/png":
+		out, err = stripPNG(data)
+	case "image/webp":
+		out, err = stripWebP(data)
+	case "image/heic", "image/heif":
+		out, err = stripHEIF(data)
+	default:
+		return nil, fmt.Errorf("removing metadata of %s images is not supported", mimeType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove metadata: %w", err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,444 @@
+package imageprep
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+)
+
+// The encoder writes lossless WebP (VP8L) images, since there is no
+// WebP encoder in the standard library or golang.org/x/image. It applies
+// the subtract green and predictor transforms and codes pixels as
+// literals without backward references or a color cache, which keeps it
+// simple at the cost of larger files than those of libwebp.
+
+const (
+	vp8lSignature   = 0x2f
+	vp8lMaxSize     = 1 << 14
+	predictorBits   = 4
+	predictorSelect = 11
+
+	transformPredictor     = 0
+	transformSubtractGreen = 2
+
+	maxCodeLength           = 15
+	maxCodeLengthCodeLength = 7
+)
+
+var (
+	// alphabetSizes are sizes of the green, red, blue, alpha and distance
+	// alphabets, where green includes 24 backward reference length codes.
+	alphabetSizes = [5]int{256 + 24, 256, 256, 256, 40}
+
+	codeLengthCodeOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+)
+
+// encodeWebP writes img to w as a lossless WebP image.
+func encodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width == 0 || height == 0 || width > vp8lMaxSize || height > vp8lMaxSize {
+		return fmt.Errorf("webp images need to be between 1 and %d pixels wide and high, got %dx%d",
+			vp8lMaxSize, width, height)
+	}
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+	pix := nrgba.Pix
+
+	hasAlpha := false
+	for p := 3; p < len(pix); p += 4 {
+		if pix[p] != 0xff {
+			hasAlpha = true
+			break
+		}
+	}
+
+	bw := &bitWriter{}
+	bw.write(vp8lSignature, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	bw.write(boolBit(hasAlpha), 1)
+	bw.write(0, 3)
+
+	// transforms are undone by the decoder in reverse order
+	bw.write(1, 1)
+	bw.write(transformSubtractGreen, 2)
+	subtractGreen(pix)
+
+	bw.write(1, 1)
+	bw.write(transformPredictor, 2)
+	bw.write(predictorBits-2, 3)
+	tiles := make([]byte, 4*tileCount(width)*tileCount(height))
+	for p := 0; p < len(tiles); p += 4 {
+		tiles[p+1] = predictorSelect
+	}
+	writeImage(bw, tiles, false)
+	residuals := predict(pix, width, height)
+
+	bw.write(0, 1)
+	writeImage(bw, residuals, true)
+
+	data := bw.bytes()
+	chunk := len(data) + len(data)%2
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+chunk))
+	copy(header[8:], "WEBP")
+	copy(header[12:], "VP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if len(data)%2 == 1 {
+		data = append(data, 0)
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func tileCount(size int) int {
+	return (size + 1<<predictorBits - 1) >> predictorBits
+}
+
+// subtractGreen subtracts green from red and blue of RGBA pixels.
+func subtractGreen(pix []byte) {
+	for p := 0; p < len(pix); p += 4 {
+		pix[p+0] -= pix[p+1]
+		pix[p+2] -= pix[p+1]
+	}
+}
+
+// predict returns residuals of RGBA pixels predicted using the select
+// predictor, except for the first row and column, whose predictors are
+// fixed by the format.
+func predict(pix []byte, width, height int) []byte {
+	res := make([]byte, len(pix))
+	stride := 4 * width
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := y*stride + 4*x
+			var pred [4]byte
+			switch {
+			case x == 0 && y == 0:
+				pred = [4]byte{0, 0, 0, 0xff}
+			case y == 0:
+				copy(pred[:], pix[p-4:p])
+			case x == 0:
+				copy(pred[:], pix[p-stride:p-stride+4])
+			default:
+				pred = selectPredictor(pix[p-4:p], pix[p-stride:p-stride+4], pix[p-stride-4:p-stride])
+			}
+			for i := 0; i < 4; i++ {
+				res[p+i] = pix[p+i] - pred[i]
+			}
+		}
+	}
+
+	return res
+}
+
+// selectPredictor picks left or top pixel, whichever is closer to the
+// gradient estimate.
+func selectPredictor(l, t, tl []byte) [4]byte {
+	var pl, pt int
+	for i := 0; i < 4; i++ {
+		pl += abs(int(tl[i]) - int(t[i]))
+		pt += abs(int(tl[i]) - int(l[i]))
+	}
+
+	var pred [4]byte
+	if pl < pt {
+		copy(pred[:], l)
+	} else {
+		copy(pred[:], t)
+	}
+
+	return pred
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// writeImage entropy codes RGBA pixels as literals using a single group
+// of prefix codes.
+func writeImage(bw *bitWriter, pix []byte, topLevel bool) {
+	// no color cache
+	bw.write(0, 1)
+	if topLevel {
+		// no meta prefix codes
+		bw.write(0, 1)
+	}
+
+	var histograms [5][]int
+	for i, size := range alphabetSizes {
+		histograms[i] = make([]int, size)
+	}
+	for p := 0; p < len(pix); p += 4 {
+		histograms[0][pix[p+1]]++
+		histograms[1][pix[p+0]]++
+		histograms[2][pix[p+2]]++
+		histograms[3][pix[p+3]]++
+	}
+
+	var codes [5]*prefixCode
+	for i, h := range histograms {
+		codes[i] = writePrefixCode(bw, h)
+	}
+
+	for p := 0; p < len(pix); p += 4 {
+		codes[0].write(bw, int(pix[p+1]))
+		codes[1].write(bw, int(pix[p+0]))
+		codes[2].write(bw, int(pix[p+2]))
+		codes[3].write(bw, int(pix[p+3]))
+	}
+}
+
+// prefixCode is a canonical prefix code.
+type prefixCode struct {
+	lengths []int
+	codes   []uint32
+	// single is set when only one symbol is coded, using no bits at all
+	single bool
+}
+
+func newPrefixCode(lengths []int) *prefixCode {
+	c := &prefixCode{lengths: lengths, codes: make([]uint32, len(lengths))}
+
+	used := 0
+	var count [maxCodeLength + 1]uint32
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+			used++
+		}
+	}
+	if used <= 1 {
+		c.single = true
+		return c
+	}
+
+	var next [maxCodeLength + 1]uint32
+	code := uint32(0)
+	for l := 1; l <= maxCodeLength; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range lengths {
+		if l > 0 {
+			c.codes[s] = next[l]
+			next[l]++
+		}
+	}
+
+	return c
+}
+
+// write writes the code of symbol, most significant bit first as
+// required by the format.
+func (c *prefixCode) write(bw *bitWriter, symbol int) {
+	if c.single {
+		return
+	}
+
+	l := c.lengths[symbol]
+	code := c.codes[symbol]
+	var reversed uint32
+	for i := 0; i < l; i++ {
+		reversed = reversed<<1 | code>>i&1
+	}
+	bw.write(reversed, uint(l))
+}
+
+// writePrefixCode writes a prefix code for symbols counted in histogram
+// and returns it. Codes of at most two symbols below 256 are written in
+// the compact simple form.
+func writePrefixCode(bw *bitWriter, histogram []int) *prefixCode {
+	var used []int
+	for s, n := range histogram {
+		if n > 0 {
+			used = append(used, s)
+		}
+	}
+	if len(used) == 0 {
+		used = []int{0}
+	}
+
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		bw.write(1, 1)
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+
+		lengths := make([]int, len(histogram))
+		if len(used) == 2 {
+			bw.write(uint32(used[1]), 8)
+			lengths[used[0]], lengths[used[1]] = 1, 1
+		} else {
+			lengths[used[0]] = 1
+		}
+		return newPrefixCode(lengths)
+	}
+
+	lengths := codeLengths(histogram, maxCodeLength)
+
+	counts := make([]int, len(codeLengthCodeOrder))
+	for _, l := range lengths {
+		counts[l]++
+	}
+	clLengths := codeLengths(counts, maxCodeLengthCodeLength)
+
+	n := len(codeLengthCodeOrder)
+	for n > 4 && clLengths[codeLengthCodeOrder[n-1]] == 0 {
+		n--
+	}
+
+	bw.write(0, 1)
+	bw.write(uint32(n-4), 4)
+	for _, s := range codeLengthCodeOrder[:n] {
+		bw.write(uint32(clLengths[s]), 3)
+	}
+	// code lengths are given for the whole alphabet
+	bw.write(0, 1)
+
+	clCode := newPrefixCode(clLengths)
+	for _, l := range lengths {
+		clCode.write(bw, l)
+	}
+
+	return newPrefixCode(lengths)
+}
+
+// codeLengths returns Huffman code lengths of at most limit bits for
+// symbols counted in histogram. When the optimal code is too deep, rare
+// symbols are made more frequent until it fits.
+func codeLengths(histogram []int, limit int) []int {
+	for minCount := 1; ; minCount *= 2 {
+		lengths := huffmanLengths(histogram, minCount)
+
+		fits := true
+		for _, l := range lengths {
+			if l > limit {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			return lengths
+		}
+	}
+}
+
+type huffmanNode struct {
+	count       int
+	symbol      int
+	left, right int
+}
+
+type huffmanHeap struct {
+	nodes []huffmanNode
+	items []int
+}
+
+func (h *huffmanHeap) Len() int { return len(h.items) }
+func (h *huffmanHeap) Less(i, j int) bool {
+	a, b := h.nodes[h.items[i]], h.nodes[h.items[j]]
+	if a.count != b.count {
+		return a.count < b.count
+	}
+	return h.items[i] < h.items[j]
+}
+func (h *huffmanHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *huffmanHeap) Push(x any)    { h.items = append(h.items, x.(int)) }
+func (h *huffmanHeap) Pop() any {
+	x := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return x
+}
+
+func huffmanLengths(histogram []int, minCount int) []int {
+	lengths := make([]int, len(histogram))
+
+	h := &huffmanHeap{}
+	for s, n := range histogram {
+		if n > 0 {
+			h.nodes = append(h.nodes, huffmanNode{count: max(n, minCount), symbol: s, left: -1, right: -1})
+			h.items = append(h.items, len(h.nodes)-1)
+		}
+	}
+
+	switch len(h.items) {
+	case 0:
+		return lengths
+	case 1:
+		lengths[h.nodes[0].symbol] = 1
+		return lengths
+	}
+
+	heap.Init(h)
+	for h.Len() > 1 {
+		a := heap.Pop(h).(int)
+		b := heap.Pop(h).(int)
+		h.nodes = append(h.nodes, huffmanNode{count: h.nodes[a].count + h.nodes[b].count, symbol: -1, left: a, right: b})
+		heap.Push(h, len(h.nodes)-1)
+	}
+
+	var walk func(n, depth int)
+	walk = func(n, depth int) {
+		node := h.nodes[n]
+		if node.left < 0 {
+			lengths[node.symbol] = depth
+			return
+		}
+		walk(node.left, depth+1)
+		walk(node.right, depth+1)
+	}
+	walk(h.items[0], 0)
+
+	return lengths
+}
+
+// bitWriter writes bits least significant first.
+type bitWriter struct {
+	buf  []byte
+	acc  uint64
+	bits uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v) << w.bits
+	w.bits += n
+	for w.bits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.bits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.bits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.bits = 0, 0
+	}
+	return w.buf
+}
+
+func boolBit(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+package index
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// sniffLen is the number of leading bytes checked to detect binary files.
+const sniffLen = 8000
+
+// Chunk is a contiguous range of lines of a file.
+type Chunk struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+	Text      string `json:"text"`
+}
+
+// IsText reports whether b looks like text, i.e. valid UTF-8 without NUL
+// bytes in its beginning.
+func IsText(b []byte) bool {
+	head := b
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+		// do not fail on a rune cut at the boundary
+		for i := 0; i < utf8.UTFMax && !utf8.Valid(head); i++ {
+			head = head[:len(head)-1]
+		}
+	}
+
+	return bytes.IndexByte(head, 0) < 0 && utf8.Valid(head)
+}
+
+// SplitLines splits text of file at path into chunks of whole lines of at
+// most size bytes. A single line longer than size becomes a chunk of its
+// own. Blank chunks are dropped.
+func SplitLines(path, text string, size int) []Chunk {
+	var chunks []Chunk
+	var sb strings.Builder
+	start := 1
+
+	flush := func(end int) {
+		if len(strings.TrimSpace(sb.String())) > 0 {
+			chunks = append(chunks, Chunk{
+				Path:      path,
+				StartLine: start,
+				EndLine:   end,
+				Text:      strings.TrimRight(sb.String(), "\n"),
+			})
+		}
+		sb.Reset()
+		start = end + 1
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	if n := len(lines); n > 0 && len(lines[n-1]) == 0 {
+		lines = lines[:n-1]
+	}
+	for i, line := range lines {
+		if sb.Len() > 0 && sb.Len()+len(line) > size {
+			flush(i)
+		}
+		sb.WriteString(line)
+	}
+	flush(len(lines))
+
+	return chunks
+}
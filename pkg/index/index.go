@@ -0,0 +1,131 @@
+// Package index builds a local semantic index of text files and retrieves
+// the chunks most relevant to a query.
+package index
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultChunkSize is the default maximum size of a chunk in bytes.
+	DefaultChunkSize = 1500
+	// maxFileSize is the size of the largest file that is indexed.
+	maxFileSize = 1048576
+)
+
+// Index is a set of file chunks along with their embeddings.
+type Index struct {
+	Name       string    `json:"name"`
+	Root       string    `json:"root"`
+	Model      string    `json:"model"`
+	ChunkSize  int       `json:"chunkSize"`
+	CreateTime time.Time `json:"createTime"`
+	Chunks     []Chunk   `json:"chunks"`
+
+	// Vectors holds embeddings of chunks in the same order as chunks.
+	Vectors [][]float32 `json:"-"`
+}
+
+// Result is a chunk retrieved for a query along with its similarity score.
+type Result struct {
+	Chunk
+	Score float32
+}
+
+// Collect walks dir and splits every text file in it into chunks with
+// paths relative to dir. Hidden files and directories as well as binary
+// and large files are skipped.
+func Collect(dir string, size int) ([]Chunk, error) {
+	var chunks []Chunk
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > maxFileSize {
+			return nil
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !IsText(b) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		chunks = append(chunks, SplitLines(filepath.ToSlash(rel), string(b), size)...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read files in %s: %w", dir, err)
+	}
+
+	return chunks, nil
+}
+
+// Search returns up to k chunks most similar to query by cosine similarity,
+// most similar first.
+func (ix *Index) Search(query []float32, k int) []Result {
+	results := make([]Result, 0, len(ix.Chunks))
+	for i, chunk := range ix.Chunks {
+		if i >= len(ix.Vectors) {
+			break
+		}
+		results = append(results, Result{Chunk: chunk, Score: cosine(query, ix.Vectors[i])})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) > k {
+		results = results[:k]
+	}
+
+	return results
+}
+
+func cosine(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+
+	return float32(dot / (math.Sqrt(na) * math.Sqrt(nb)))
+}
@@ -0,0 +1,119 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitLines(t *testing.T) {
+	text := "one\ntwo\n\nthree four five\nsix\n"
+
+	got := SplitLines("a.txt", text, 10)
+	want := []Chunk{
+		{Path: "a.txt", StartLine: 1, EndLine: 3, Text: "one\ntwo"},
+		{Path: "a.txt", StartLine: 4, EndLine: 4, Text: "three four five"},
+		{Path: "a.txt", StartLine: 5, EndLine: 5, Text: "six"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if got := SplitLines("b.txt", "\n \n", 10); len(got) != 0 {
+		t.Fatalf("got %+v for blank text", got)
+	}
+}
+
+func TestIsText(t *testing.T) {
+	if !IsText([]byte("héllo\n")) {
+		t.Fatal("utf-8 text is not text")
+	}
+	if IsText([]byte("\x89PNG\r\n\x1a\n\x00\x00")) {
+		t.Fatal("binary data is text")
+	}
+	// a rune cut at the sniffed boundary is still text
+	long := strings.Repeat("a", sniffLen-1) + "é"
+	if !IsText([]byte(long)) {
+		t.Fatal("text with rune at boundary is not text")
+	}
+}
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"README.md":        "# readme\n",
+		"docs/runbook.txt": "restart the service\n",
+		".git/config":      "[core]\n",
+		".env":             "SECRET=1\n",
+		"logo.png":         "\x89PNG\x00\x00",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chunks, err := Collect(dir, DefaultChunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, chunk := range chunks {
+		paths = append(paths, chunk.Path)
+	}
+	if want := []string{"README.md", "docs/runbook.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got paths %v, want %v", paths, want)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ix := &Index{
+		Chunks: []Chunk{{Path: "a"}, {Path: "b"}, {Path: "c"}},
+		Vectors: [][]float32{
+			{1, 0, 0},
+			{0.7, 0.7, 0},
+			{0, 0, 1},
+		},
+	}
+
+	got := ix.Search([]float32{1, 0.1, 0}, 2)
+	if len(got) != 2 || got[0].Path != "a" || got[1].Path != "b" {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := &Store{Dir: t.TempDir()}
+
+	ix := &Index{
+		Name:    "docs",
+		Root:    "/tmp/docs",
+		Model:   "models/text-embedding-004",
+		Chunks:  []Chunk{{Path: "a.txt", StartLine: 1, EndLine: 1, Text: "a"}},
+		Vectors: [][]float32{{0.25, 0.5}},
+	}
+	if err := s.Save(ix); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Load("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Chunks, ix.Chunks) || !reflect.DeepEqual(got.Vectors, ix.Vectors) {
+		t.Fatalf("got %+v, want %+v", got, ix)
+	}
+
+	if _, err := s.Load("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("got error %v, want not found", err)
+	}
+	if _, err := s.Load("../docs"); err == nil || !strings.Contains(err.Error(), "invalid index name") {
+		t.Fatalf("got error %v, want invalid index name", err)
+	}
+}
@@ -0,0 +1,140 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kubetrail/gini/pkg/embedding"
+)
+
+const (
+	dataDirEnv  = "XDG_DATA_HOME"
+	appDir      = "gini"
+	indexesDir  = "indexes"
+	indexFile   = "index.json"
+	vectorsFile = "vectors.bin"
+)
+
+// Store keeps each index in a directory named after it.
+type Store struct {
+	Dir string
+}
+
+// DefaultDir returns the indexes directory under XDG data directory,
+// i.e. $XDG_DATA_HOME/gini/indexes, falling back to ~/.local/share
+// when XDG_DATA_HOME is not set.
+func DefaultDir() (string, error) {
+	dataDir := os.Getenv(dataDirEnv)
+	if len(dataDir) == 0 || !filepath.IsAbs(dataDir) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home dir: %w", err)
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+
+	return filepath.Join(dataDir, appDir, indexesDir), nil
+}
+
+// NewStore returns a store at the default directory, creating it if needed.
+func NewStore() (*Store, error) {
+	dir, err := DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create indexes dir: %w", err)
+	}
+
+	return &Store{Dir: dir}, nil
+}
+
+// checkName returns an error unless name can be used as a directory name.
+func checkName(name string) error {
+	if len(name) == 0 || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid index name %q", name)
+	}
+
+	return nil
+}
+
+// Path returns the directory of the index with given name.
+func (s *Store) Path(name string) string {
+	return filepath.Join(s.Dir, name)
+}
+
+// Save writes index metadata and chunks as JSON and vectors in binary
+// embedding format, replacing any index with the same name.
+func (s *Store) Save(ix *Index) error {
+	if err := checkName(ix.Name); err != nil {
+		return err
+	}
+	if len(ix.Vectors) != len(ix.Chunks) {
+		return fmt.Errorf("index has %d vectors for %d chunks", len(ix.Vectors), len(ix.Chunks))
+	}
+
+	dir := s.Path(ix.Name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create index dir: %w", err)
+	}
+
+	b, err := json.MarshalIndent(ix, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize index: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, indexFile), b, 0600); err != nil {
+		return fmt.Errorf("failed to write index file: %w", err)
+	}
+
+	f, err := os.Create(filepath.Join(dir, vectorsFile))
+	if err != nil {
+		return fmt.Errorf("failed to create vectors file: %w", err)
+	}
+	defer f.Close()
+
+	if err := embedding.WriteBinary(f, ix.Vectors); err != nil {
+		return fmt.Errorf("failed to write vectors file: %w", err)
+	}
+
+	return f.Close()
+}
+
+// Load reads the index with given name.
+func (s *Store) Load(name string) (*Index, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	dir := s.Path(name)
+
+	b, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("index %s not found", name)
+		}
+		return nil, fmt.Errorf("failed to read index file: %w", err)
+	}
+
+	ix := &Index{}
+	if err := json.Unmarshal(b, ix); err != nil {
+		return nil, fmt.Errorf("failed to parse index file: %w", err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, vectorsFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vectors file: %w", err)
+	}
+	defer f.Close()
+
+	if ix.Vectors, err = embedding.ReadBinary(f); err != nil {
+		return nil, fmt.Errorf("failed to read vectors file: %w", err)
+	}
+	if len(ix.Vectors) != len(ix.Chunks) {
+		return nil, fmt.Errorf("index %s has %d vectors for %d chunks", name, len(ix.Vectors), len(ix.Chunks))
+	}
+
+	return ix, nil
+}
@@ -0,0 +1,594 @@
+// Package lineedit reads prompts typed at a terminal, allowing them to be
+// edited over multiple lines and recalled from a persistent history.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// defaultWidth is the number of columns assumed when the terminal does
+// not tell.
+const defaultWidth = 80
+
+// ErrInterrupted is returned when Ctrl-C is pressed at an empty prompt.
+var ErrInterrupted = errors.New("interrupted")
+
+// SubmitKey selects the key sending a prompt. The keys not sending it
+// insert a new line instead, and so does Ctrl-J. Enter always sends an
+// empty prompt.
+type SubmitKey int
+
+const (
+	// SubmitDoubleEnter sends the prompt when enter is pressed on an
+	// empty last line.
+	SubmitDoubleEnter SubmitKey = iota
+	// SubmitEnter sends the prompt on enter.
+	SubmitEnter
+	// SubmitAltEnter sends the prompt on alt-enter.
+	SubmitAltEnter
+	// SubmitCtrlD sends the prompt on Ctrl-D.
+	SubmitCtrlD
+)
+
+// Editor reads prompts from a terminal in raw mode, redrawing them as they
+// are edited. Text pasted into the terminal is inserted as it is without
+// sending the prompt at new lines.
+type Editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	fd      int
+	history *History
+	submit  SubmitKey
+
+	mu    sync.Mutex
+	state *termState
+
+	// prompt being edited
+	prompt string
+	buf    []rune
+	pos    int
+	row    int
+	paste  bool
+	single bool
+	hist   int
+	draft  []rune
+	search *search
+}
+
+// search is the state of a reverse search through history.
+type search struct {
+	query  []rune
+	match  int
+	failed bool
+	// prompt shown before search started
+	buf  []rune
+	pos  int
+	hist int
+}
+
+// New returns an editor reading keys from terminal in and drawing prompts
+// on out. Prompts sent are added to history. An error is returned when in
+// cannot be put in raw mode, in which case input is better read as it is.
+func New(in *os.File, out io.Writer, history *History, submit SubmitKey) (*Editor, error) {
+	fd := int(in.Fd())
+	state, err := makeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set terminal to raw mode: %w", err)
+	}
+	if err := restoreTerm(fd, state); err != nil {
+		return nil, fmt.Errorf("failed to restore terminal: %w", err)
+	}
+
+	return &Editor{in: bufio.NewReader(in), out: out, fd: fd, history: history, submit: submit}, nil
+}
+
+// ReadPrompt reads a prompt showing prompt in front of its first line.
+// It returns io.EOF when Ctrl-D is pressed at an empty prompt and
+// ErrInterrupted for Ctrl-C. Ctrl-C clears the prompt when it is not
+// empty.
+func (e *Editor) ReadPrompt(prompt string) (string, error) {
+	text, err := e.read(prompt, false)
+	if err != nil {
+		return "", err
+	}
+
+	if err := e.history.Add(text); err != nil {
+		return "", err
+	}
+
+	return text, nil
+}
+
+// ReadLine reads a single line sent by enter, such as an answer to
+// a question, which is not added to history.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	return e.read(prompt, true)
+}
+
+// Close restores the terminal if it was left in raw mode by a read still
+// waiting for input.
+func (e *Editor) Close() error {
+	return e.restore()
+}
+
+func (e *Editor) read(prompt string, single bool) (string, error) {
+	if err := e.raw(); err != nil {
+		return "", err
+	}
+	defer e.restore()
+
+	e.prompt, e.buf, e.pos, e.row = prompt, nil, 0, 0
+	e.paste, e.single, e.search = false, single, nil
+	e.hist, e.draft = len(e.history.Entries()), nil
+
+	if err := e.render(); err != nil {
+		return "", err
+	}
+
+	for {
+		k, err := readKey(e.in)
+		if err != nil {
+			return "", err
+		}
+
+		done, err := e.handle(k)
+		if err != nil {
+			// the prompt is left on its line
+			_ = e.write("\r\n")
+			return "", err
+		}
+		if done {
+			e.pos = len(e.buf)
+			if err := e.render(); err != nil {
+				return "", err
+			}
+			if err := e.write("\r\n"); err != nil {
+				return "", err
+			}
+			return string(e.buf), nil
+		}
+
+		if err := e.render(); err != nil {
+			return "", err
+		}
+	}
+}
+
+// raw puts the terminal in raw mode and enables bracketed paste, which
+// makes terminals mark pasted text.
+func (e *Editor) raw() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.fd >= 0 {
+		state, err := makeRaw(e.fd)
+		if err != nil {
+			return fmt.Errorf("failed to set terminal to raw mode: %w", err)
+		}
+		e.state = state
+	}
+
+	return e.write("\x1b[?2004h")
+}
+
+func (e *Editor) restore() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.state == nil {
+		return nil
+	}
+	state := e.state
+	e.state = nil
+
+	_ = e.write("\x1b[?2004l")
+	if err := restoreTerm(e.fd, state); err != nil {
+		return fmt.Errorf("failed to restore terminal: %w", err)
+	}
+
+	return nil
+}
+
+func (e *Editor) write(s string) error {
+	if _, err := io.WriteString(e.out, s); err != nil {
+		return fmt.Errorf("failed to write to terminal: %w", err)
+	}
+
+	return nil
+}
+
+// handle applies key k to the prompt and reports whether it is done.
+func (e *Editor) handle(k key) (bool, error) {
+	if e.paste {
+		switch k.kind {
+		case keyPasteEnd:
+			e.paste = false
+		case keyEnter, keyNewline:
+			e.insert('\n')
+		case keyRune:
+			e.insert(k.r)
+		}
+		return false, nil
+	}
+
+	if e.search != nil {
+		if e.handleSearch(k) {
+			return false, nil
+		}
+	}
+
+	switch k.kind {
+	case keyRune:
+		e.insert(k.r)
+	case keyPasteStart:
+		e.paste = true
+	case keyEnter:
+		// new lines read along with more input are pasted
+		if k.more && !e.single {
+			e.insert('\n')
+			return false, nil
+		}
+		return e.enter(), nil
+	case keyNewline:
+		if e.single {
+			return true, nil
+		}
+		e.insert('\n')
+	case keyAltEnter:
+		if e.submit == SubmitAltEnter || e.single {
+			return true, nil
+		}
+		e.insert('\n')
+	case keyEOF:
+		switch {
+		case len(e.buf) == 0:
+			return false, io.EOF
+		case e.submit == SubmitCtrlD && !e.single:
+			return true, nil
+		default:
+			e.delete(e.pos, e.pos+1)
+		}
+	case keyInterrupt:
+		if len(e.buf) == 0 {
+			return false, ErrInterrupted
+		}
+		if err := e.clearPrompt(); err != nil {
+			return false, err
+		}
+	case keyBackspace:
+		e.delete(e.pos-1, e.pos)
+	case keyDelete:
+		e.delete(e.pos, e.pos+1)
+	case keyLeft:
+		e.pos = max(e.pos-1, 0)
+	case keyRight:
+		e.pos = min(e.pos+1, len(e.buf))
+	case keyHome:
+		e.pos = e.lineStart(e.pos)
+	case keyEnd:
+		e.pos = e.lineEnd(e.pos)
+	case keyWordLeft:
+		e.pos = e.wordStart(e.pos)
+	case keyWordRight:
+		e.pos = e.wordEnd(e.pos)
+	case keyUp:
+		e.up()
+	case keyDown:
+		e.down()
+	case keyKillEnd:
+		if end := e.lineEnd(e.pos); end > e.pos {
+			e.delete(e.pos, end)
+		} else {
+			e.delete(e.pos, e.pos+1)
+		}
+	case keyKillStart:
+		e.delete(e.lineStart(e.pos), e.pos)
+	case keyKillWord:
+		e.delete(e.wordStart(e.pos), e.pos)
+	case keySearch:
+		if !e.single {
+			e.search = &search{match: -1, buf: e.buf, pos: e.pos, hist: e.hist}
+		}
+	case keyClear:
+		e.row = 0
+		if err := e.write("\x1b[H\x1b[2J"); err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// enter handles the enter key, which sends empty prompts in any case.
+func (e *Editor) enter() bool {
+	if len(e.buf) == 0 || e.single {
+		return true
+	}
+
+	switch e.submit {
+	case SubmitEnter:
+		return true
+	case SubmitDoubleEnter:
+		if e.pos == len(e.buf) && e.buf[len(e.buf)-1] == '\n' {
+			e.buf = e.buf[:len(e.buf)-1]
+			e.pos = len(e.buf)
+			return true
+		}
+	}
+
+	e.insert('\n')
+	return false
+}
+
+// handleSearch applies k to the reverse search and reports whether it
+// was consumed. Keys not used by search end it, keeping the prompt found,
+// and are applied to the prompt as well except for enter.
+func (e *Editor) handleSearch(k key) bool {
+	s := e.search
+	entries := e.history.Entries()
+
+	switch k.kind {
+	case keyRune:
+		// the prompt found so far is kept while it still matches
+		s.query = append(s.query, k.r)
+		if s.match >= 0 {
+			e.find(s.match)
+		} else {
+			e.find(len(entries) - 1)
+		}
+	case keyBackspace:
+		if len(s.query) > 0 {
+			s.query = s.query[:len(s.query)-1]
+		}
+		e.find(len(entries) - 1)
+	case keySearch:
+		if s.match > 0 {
+			e.find(s.match - 1)
+		}
+	case keyCancel, keyInterrupt:
+		e.buf, e.pos, e.hist = s.buf, s.pos, s.hist
+		e.search = nil
+	case keyEnter:
+		e.search = nil
+	default:
+		e.search = nil
+		return false
+	}
+
+	return true
+}
+
+// find shows the most recent prompt at or before index from matching the
+// search query, keeping the current one if there is none.
+func (e *Editor) find(from int) {
+	s := e.search
+	if len(s.query) == 0 {
+		s.match, s.failed = -1, false
+		e.buf, e.pos, e.hist = s.buf, s.pos, s.hist
+		return
+	}
+
+	i := e.history.Search(string(s.query), from)
+	s.failed = i < 0
+	if s.failed {
+		return
+	}
+
+	s.match, e.hist = i, i
+	e.buf = []rune(e.history.Entries()[i])
+	e.pos = len(e.buf)
+}
+
+// clearPrompt leaves the prompt on screen marked as cancelled and starts
+// a new one.
+func (e *Editor) clearPrompt() error {
+	e.pos = len(e.buf)
+	if err := e.render(); err != nil {
+		return err
+	}
+	if err := e.write("^C\r\n"); err != nil {
+		return err
+	}
+
+	e.buf, e.pos, e.row = nil, 0, 0
+	e.hist, e.draft = len(e.history.Entries()), nil
+
+	return nil
+}
+
+func (e *Editor) insert(r rune) {
+	e.buf = append(e.buf[:e.pos], append([]rune{r}, e.buf[e.pos:]...)...)
+	e.pos++
+}
+
+// delete removes runes between from and to, which are clipped to the
+// prompt.
+func (e *Editor) delete(from, to int) {
+	from, to = max(from, 0), min(to, len(e.buf))
+	if from >= to {
+		return
+	}
+
+	e.buf = append(e.buf[:from], e.buf[to:]...)
+	e.pos = from
+}
+
+// up moves to the line above or to the previous prompt of history when on
+// the first line.
+func (e *Editor) up() {
+	start := e.lineStart(e.pos)
+	if start == 0 {
+		e.recall(e.hist - 1)
+		return
+	}
+
+	prev := e.lineStart(start - 1)
+	e.pos = min(prev+e.pos-start, start-1)
+}
+
+// down moves to the line below or to the next prompt of history when on
+// the last line.
+func (e *Editor) down() {
+	end := e.lineEnd(e.pos)
+	if end == len(e.buf) {
+		e.recall(e.hist + 1)
+		return
+	}
+
+	next := end + 1
+	e.pos = min(next+e.pos-e.lineStart(e.pos), e.lineEnd(next))
+}
+
+// recall shows prompt i of history, the prompt being typed being kept
+// past the most recent one.
+func (e *Editor) recall(i int) {
+	entries := e.history.Entries()
+	if e.single || i < 0 || i > len(entries) {
+		return
+	}
+
+	if e.hist == len(entries) {
+		e.draft = e.buf
+	}
+	e.hist = i
+
+	if i == len(entries) {
+		e.buf = e.draft
+	} else {
+		e.buf = []rune(entries[i])
+	}
+	e.pos = len(e.buf)
+}
+
+func (e *Editor) lineStart(pos int) int {
+	for pos > 0 && e.buf[pos-1] != '\n' {
+		pos--
+	}
+
+	return pos
+}
+
+func (e *Editor) lineEnd(pos int) int {
+	for pos < len(e.buf) && e.buf[pos] != '\n' {
+		pos++
+	}
+
+	return pos
+}
+
+func (e *Editor) wordStart(pos int) int {
+	for pos > 0 && unicode.IsSpace(e.buf[pos-1]) {
+		pos--
+	}
+	for pos > 0 && !unicode.IsSpace(e.buf[pos-1]) {
+		pos--
+	}
+
+	return pos
+}
+
+func (e *Editor) wordEnd(pos int) int {
+	for pos < len(e.buf) && unicode.IsSpace(e.buf[pos]) {
+		pos++
+	}
+	for pos < len(e.buf) && !unicode.IsSpace(e.buf[pos]) {
+		pos++
+	}
+
+	return pos
+}
+
+// render redraws the prompt from its first row, which is row rows above
+// the cursor, and leaves the cursor at the position being edited.
+func (e *Editor) render() error {
+	var sb strings.Builder
+	if e.row > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dA", e.row)
+	}
+	sb.WriteString("\r\x1b[J")
+
+	prompt := e.prompt
+	if s := e.search; s != nil {
+		status := "reverse-i-search"
+		if s.failed {
+			status = "failed " + status
+		}
+		prompt = fmt.Sprintf("(%s)`%s': ", status, string(s.query))
+	}
+
+	width := defaultWidth
+	if e.fd >= 0 {
+		width = termWidth(e.fd)
+	}
+
+	lines := strings.Split(string(e.buf), "\n")
+	cursorLine := strings.Count(string(e.buf[:e.pos]), "\n")
+	cursorCol := e.pos - e.lineStart(e.pos)
+
+	var row, cursorRow, cursorX int
+	for i, line := range lines {
+		lead := prompt
+		if i > 0 {
+			lead = continuation(prompt)
+			sb.WriteString("\r\n")
+		}
+		sb.WriteString(lead)
+		sb.WriteString(expandTabs(line))
+
+		w := runewidth.StringWidth(lead + expandTabs(line))
+		if i == cursorLine {
+			x := runewidth.StringWidth(lead + expandTabs(string([]rune(line)[:cursorCol])))
+			cursorRow, cursorX = row+x/width, x%width
+			// a cursor past a full row of a line that goes on is shown at
+			// the end of that row
+			if x > 0 && x%width == 0 && i < len(lines)-1 {
+				cursorRow, cursorX = cursorRow-1, width-1
+			}
+		}
+
+		if i < len(lines)-1 {
+			row += max(1, (w+width-1)/width)
+			continue
+		}
+
+		// terminals hold the cursor at the end of a full row until more
+		// is written, hence it is moved to the next one
+		row += w / width
+		if w > 0 && w%width == 0 {
+			sb.WriteString("\r\n")
+		}
+	}
+
+	if row > cursorRow {
+		fmt.Fprintf(&sb, "\x1b[%dA", row-cursorRow)
+	}
+	sb.WriteString("\r")
+	if cursorX > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dC", cursorX)
+	}
+	e.row = cursorRow
+
+	return e.write(sb.String())
+}
+
+// continuation returns the prompt shown in front of lines after the first
+// one, as wide as prompt.
+func continuation(prompt string) string {
+	const dots = "... "
+	return strings.Repeat(" ", max(runewidth.StringWidth(prompt)-len(dots), 0)) + dots
+}
+
+// expandTabs replaces tabs of line with spaces so that its width is known
+// when drawn.
+func expandTabs(line string) string {
+	return strings.ReplaceAll(line, "\t", "    ")
+}
@@ -0,0 +1,125 @@
+package lineedit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// chunkReader returns one chunk per read, as keys typed one at a time
+// reach a terminal.
+type chunkReader struct {
+	chunks []string
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.chunks[0])
+	r.chunks[0] = r.chunks[0][n:]
+	if len(r.chunks[0]) == 0 {
+		r.chunks = r.chunks[1:]
+	}
+
+	return n, nil
+}
+
+func newTestEditor(submit SubmitKey, history []string, chunks ...string) (*Editor, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	e := &Editor{
+		in:      bufio.NewReader(&chunkReader{chunks: chunks}),
+		out:     out,
+		fd:      -1,
+		history: &History{entries: history},
+		submit:  submit,
+	}
+
+	return e, out
+}
+
+func TestReadPrompt(t *testing.T) {
+	history := []string{"go build ./...", "go test ./...", "ls -l"}
+
+	tests := []struct {
+		name    string
+		submit  SubmitKey
+		chunks  []string
+		want    string
+		wantErr error
+	}{
+		{name: "double enter", chunks: []string{"hello", "\r", "\r"}, want: "hello"},
+		{name: "lines", chunks: []string{"a", "\r", "b", "\r", "\r"}, want: "a\nb"},
+		{name: "blank line", chunks: []string{"a", "\n", "\n", "b", "\r", "\r"}, want: "a\n\nb"},
+		{name: "enter", submit: SubmitEnter, chunks: []string{"hi", "\r"}, want: "hi"},
+		{name: "alt enter", submit: SubmitAltEnter, chunks: []string{"a", "\r", "\r", "b", "\x1b\r"}, want: "a\n\nb"},
+		{name: "ctrl-d", submit: SubmitCtrlD, chunks: []string{"a", "\r", "b", "\x04"}, want: "a\nb"},
+		{name: "empty", submit: SubmitAltEnter, chunks: []string{"\r"}, want: ""},
+		{name: "bracketed paste", chunks: []string{"\x1b[200~x\r\r\ry\x1b[201~", "\r", "\r"}, want: "x\n\n\ny"},
+		{name: "paste", chunks: []string{"x\r\ry", "\r", "\r"}, want: "x\n\ny"},
+		{name: "edit", chunks: []string{"helo", "\x1b[D", "l", "\x01", ">", "\x05", "\r", "\r"}, want: ">hello"},
+		{name: "kill word", chunks: []string{"one two", "\x17", "three", "\r", "\r"}, want: "one three"},
+		{name: "move between lines", chunks: []string{"ab", "\n", "cd", "\x1b[A", "X", "\x1b[B", "Y", "\r", "\r"}, want: "abX\ncdY"},
+		{name: "history", chunks: []string{"\x1b[A", "\x1b[A", "\r", "\r"}, want: "go test ./..."},
+		{name: "history draft", chunks: []string{"draft", "\x1b[A", "\x1b[B", "\r", "\r"}, want: "draft"},
+		{name: "search", chunks: []string{"\x12", "go", " b", "\r", "\r", "\r"}, want: "go build ./..."},
+		{name: "search again", chunks: []string{"\x12", "go", "\x12", "\x1b[C", "\r", "\r"}, want: "go build ./..."},
+		{name: "search cancelled", chunks: []string{"mine", "\x12", "ls", "\x07", "\r", "\r"}, want: "mine"},
+		{name: "interrupt clears", chunks: []string{"abc", "\x03", "x", "\r", "\r"}, want: "x"},
+		{name: "interrupt", chunks: []string{"\x03"}, wantErr: ErrInterrupted},
+		{name: "eof", chunks: []string{"\x04"}, wantErr: io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _ := newTestEditor(tt.submit, append([]string(nil), history...), tt.chunks...)
+
+			got, err := e.ReadPrompt("[1]>>> ")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPromptHistory(t *testing.T) {
+	e, _ := newTestEditor(SubmitEnter, nil, "first", "\r", "y", "\r", "\x1b[A", "\r")
+
+	if _, err := e.ReadPrompt("> "); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.ReadLine("? "); err != nil {
+		t.Fatal(err)
+	}
+	// answers are left out of history
+	got, err := e.ReadPrompt("> ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "first" {
+		t.Fatalf("got %q, want first", got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	e, out := newTestEditor(SubmitDoubleEnter, nil, "one", "\n", "two", "\r", "\r")
+
+	if _, err := e.ReadPrompt("[1]>>> "); err != nil {
+		t.Fatal(err)
+	}
+
+	// lines after the first are lined up with it
+	if !strings.Contains(out.String(), "[1]>>> one\r\n   ... two") {
+		t.Fatalf("output %q does not show both lines", out.String())
+	}
+	if !strings.Contains(out.String(), "\x1b[?2004h") {
+		t.Fatalf("output %q does not enable bracketed paste", out.String())
+	}
+}
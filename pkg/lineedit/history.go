@@ -0,0 +1,141 @@
+package lineedit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// History is a list of prompts kept in a file, one JSON string per line so
+// that prompts spanning multiple lines fit on one.
+type History struct {
+	path    string
+	max     int
+	entries []string
+}
+
+// LoadHistory reads up to max most recent prompts from the file at path,
+// which is created on first prompt added when it does not exist. History
+// is only kept in memory when path is empty.
+func LoadHistory(path string, max int) (*History, error) {
+	h := &History{path: path, max: max}
+	if len(path) == 0 {
+		return h, nil
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		var entry string
+		// lines left incomplete by an interrupted write are skipped
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		h.entries = append(h.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	// the file is compacted once it holds twice as many prompts as kept
+	if max > 0 && len(h.entries) > max {
+		compact := len(h.entries) > 2*max
+		h.entries = h.entries[len(h.entries)-max:]
+		if compact {
+			if err := h.rewrite(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return h, nil
+}
+
+// Entries returns prompts from the oldest to the most recent one.
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Add appends prompt to history and its file. Blank prompts and repeats of
+// the most recent one are left out.
+func (h *History) Add(prompt string) error {
+	if len(strings.TrimSpace(prompt)) == 0 {
+		return nil
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == prompt {
+		return nil
+	}
+
+	h.entries = append(h.entries, prompt)
+	if h.max > 0 && len(h.entries) > h.max {
+		h.entries = h.entries[len(h.entries)-h.max:]
+	}
+
+	if len(h.path) == 0 {
+		return nil
+	}
+
+	line, err := json.Marshal(prompt)
+	if err != nil {
+		return fmt.Errorf("failed to serialize prompt: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return fmt.Errorf("failed to create history dir: %w", err)
+	}
+
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write to history file: %w", err)
+	}
+
+	return nil
+}
+
+// Search returns the index of the most recent prompt containing query
+// found at or before index from, or -1 if there is none.
+func (h *History) Search(query string, from int) int {
+	for i := min(from, len(h.entries)-1); i >= 0; i-- {
+		if strings.Contains(h.entries[i], query) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (h *History) rewrite() error {
+	var sb strings.Builder
+	for _, entry := range h.entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to serialize prompt: %w", err)
+		}
+		sb.Write(line)
+		sb.WriteByte('\n')
+	}
+
+	if err := os.WriteFile(h.path, []byte(sb.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package lineedit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gini", "history.jsonl")
+
+	h, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, prompt := range []string{"one", "two\n\nlines", "two\n\nlines", "  ", "three", "four"} {
+		if err := h.Add(prompt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"two\n\nlines", "three", "four"}
+	if !reflect.DeepEqual(h.Entries(), want) {
+		t.Fatalf("got %q, want %q", h.Entries(), want)
+	}
+
+	h, err = LoadHistory(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(h.Entries(), want) {
+		t.Fatalf("got %q after reload, want %q", h.Entries(), want)
+	}
+
+	if i := h.Search("t", 2); i != 1 {
+		t.Fatalf("got match %d, want 1", i)
+	}
+	if i := h.Search("lines", 0); i != 0 {
+		t.Fatalf("got match %d, want 0", i)
+	}
+	if i := h.Search("none", 2); i != -1 {
+		t.Fatalf("got match %d, want -1", i)
+	}
+}
+
+func TestHistoryCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	if err := os.WriteFile(path, []byte("\"a\"\n\"b\"\n\"c\"\n{broken\n\"d\"\n\"e\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := LoadHistory(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"d", "e"}; !reflect.DeepEqual(h.Entries(), want) {
+		t.Fatalf("got %q, want %q", h.Entries(), want)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "\"d\"\n\"e\"\n"; got != want {
+		t.Fatalf("got file %q, want %q", got, want)
+	}
+}
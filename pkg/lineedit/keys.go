@@ -0,0 +1,188 @@
+package lineedit
+
+import (
+	"bufio"
+	"strings"
+)
+
+type keyKind int
+
+const (
+	keyRune keyKind = iota
+	keyEnter
+	keyNewline
+	keyAltEnter
+	keyBackspace
+	keyDelete
+	keyLeft
+	keyRight
+	keyUp
+	keyDown
+	keyHome
+	keyEnd
+	keyWordLeft
+	keyWordRight
+	keyKillEnd
+	keyKillStart
+	keyKillWord
+	keySearch
+	keyCancel
+	keyInterrupt
+	keyEOF
+	keyClear
+	keyPasteStart
+	keyPasteEnd
+	keyUnknown
+)
+
+// key is a key press decoded from terminal input.
+type key struct {
+	kind keyKind
+	r    rune
+	// more reports whether more input was already waiting when the key
+	// was read, as is the case for text pasted by terminals that do not
+	// support bracketed paste.
+	more bool
+}
+
+// controlKeys maps control characters to keys.
+var controlKeys = map[byte]keyKind{
+	'\r': keyEnter,
+	'\n': keyNewline,
+	0x7f: keyBackspace,
+	0x08: keyBackspace,
+	0x01: keyHome,
+	0x05: keyEnd,
+	0x02: keyLeft,
+	0x06: keyRight,
+	0x10: keyUp,
+	0x0e: keyDown,
+	0x0b: keyKillEnd,
+	0x15: keyKillStart,
+	0x17: keyKillWord,
+	0x12: keySearch,
+	0x07: keyCancel,
+	0x03: keyInterrupt,
+	0x04: keyEOF,
+	0x0c: keyClear,
+}
+
+// readKey reads the next key press from r.
+func readKey(r *bufio.Reader) (key, error) {
+	k, err := decodeKey(r)
+	k.more = r.Buffered() > 0
+
+	return k, err
+}
+
+func decodeKey(r *bufio.Reader) (key, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return key{}, err
+	}
+
+	if kind, ok := controlKeys[b]; ok {
+		return key{kind: kind}, nil
+	}
+
+	switch {
+	case b == 0x1b:
+		return decodeEscape(r)
+	case b == '\t':
+		return key{kind: keyRune, r: '\t'}, nil
+	case b < 0x20:
+		return key{kind: keyUnknown}, nil
+	}
+
+	if err := r.UnreadByte(); err != nil {
+		return key{}, err
+	}
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return key{}, err
+	}
+
+	return key{kind: keyRune, r: c}, nil
+}
+
+// decodeEscape decodes keys sent as escape sequences. Terminals send a
+// sequence at once, hence an escape with nothing following it is the
+// escape key itself.
+func decodeEscape(r *bufio.Reader) (key, error) {
+	if r.Buffered() == 0 {
+		return key{kind: keyCancel}, nil
+	}
+
+	b, err := r.ReadByte()
+	if err != nil {
+		return key{}, err
+	}
+
+	switch b {
+	case '\r':
+		return key{kind: keyAltEnter}, nil
+	case 'b':
+		return key{kind: keyWordLeft}, nil
+	case 'f':
+		return key{kind: keyWordRight}, nil
+	case '[', 'O':
+	default:
+		return key{kind: keyUnknown}, nil
+	}
+
+	// control sequences are made of parameter bytes ended by a final byte
+	var params strings.Builder
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return key{}, err
+		}
+		if b >= 0x30 && b <= 0x3f {
+			params.WriteByte(b)
+			continue
+		}
+
+		return key{kind: sequenceKey(params.String(), b)}, nil
+	}
+}
+
+func sequenceKey(params string, final byte) keyKind {
+	// modified arrows, such as 1;5C for ctrl-right, move by words
+	modified := strings.HasPrefix(params, "1;")
+
+	switch final {
+	case 'A':
+		return keyUp
+	case 'B':
+		return keyDown
+	case 'C':
+		if modified {
+			return keyWordRight
+		}
+		return keyRight
+	case 'D':
+		if modified {
+			return keyWordLeft
+		}
+		return keyLeft
+	case 'H':
+		return keyHome
+	case 'F':
+		return keyEnd
+	case '~':
+		switch params {
+		case "1", "7":
+			return keyHome
+		case "4", "8":
+			return keyEnd
+		case "3":
+			return keyDelete
+		case "200":
+			return keyPasteStart
+		case "201":
+			return keyPasteEnd
+		}
+	}
+
+	return keyUnknown
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package lineedit
+
+import "errors"
+
+type termState struct{}
+
+// makeRaw is not supported on this platform, where callers fall back to
+// reading lines as they are.
+func makeRaw(fd int) (*termState, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func restoreTerm(fd int, state *termState) error {
+	return nil
+}
+
+func termWidth(fd int) int {
+	return defaultWidth
+}
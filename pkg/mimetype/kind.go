@@ -0,0 +1,91 @@
+package mimetype
+
+import "strings"
+
+// kind is a group of MIME types models accept or reject as a whole.
+type kind string
+
+const (
+	kindUnknown  kind = "unknown"
+	kindText     kind = "text"
+	kindDocument kind = "document"
+	kindImage    kind = "image"
+	kindAudio    kind = "audio"
+	kindVideo    kind = "video"
+)
+
+var kinds = map[string]kind{
+	"text/plain":                kindText,
+	"text/html":                 kindText,
+	"text/css":                  kindText,
+	"text/csv":                  kindText,
+	"text/markdown":             kindText,
+	"text/javascript":           kindText,
+	"application/x-javascript":  kindText,
+	"text/x-typescript":         kindText,
+	"application/x-typescript":  kindText,
+	"text/x-python":             kindText,
+	"application/x-python-code": kindText,
+	"application/json":          kindText,
+	"text/xml":                  kindText,
+	"text/rtf":                  kindText,
+	"application/rtf":           kindText,
+	"application/pdf":           kindDocument,
+	"image/png":                 kindImage,
+	"image/jpeg":                kindImage,
+	"image/webp":                kindImage,
+	"image/heic":                kindImage,
+	"image/heif":                kindImage,
+	"audio/wav":                 kindAudio,
+	"audio/mp3":                 kindAudio,
+	"audio/mpeg":                kindAudio,
+	"audio/aiff":                kindAudio,
+	"audio/aac":                 kindAudio,
+	"audio/ogg":                 kindAudio,
+	"audio/flac":                kindAudio,
+	"video/mp4":                 kindVideo,
+	"video/mpeg":                kindVideo,
+	"video/mpg":                 kindVideo,
+	"video/mov":                 kindVideo,
+	"video/quicktime":           kindVideo,
+	"video/avi":                 kindVideo,
+	"video/x-flv":               kindVideo,
+	"video/webm":                kindVideo,
+	"video/wmv":                 kindVideo,
+	"video/x-ms-wmv":            kindVideo,
+	"video/3gpp":                kindVideo,
+}
+
+func kindOf(mimeType string) kind {
+	if k, ok := kinds[strings.ToLower(mimeType)]; ok {
+		return k
+	}
+
+	return kindUnknown
+}
+
+var (
+	allKinds    = []kind{kindText, kindDocument, kindImage, kindAudio, kindVideo}
+	textOnly    = []kind{kindText}
+	textImage   = []kind{kindText, kindImage}
+	visionKinds = []kind{kindText, kindImage, kindVideo}
+)
+
+// modelKinds returns kinds of files model accepts judging by its name.
+func modelKinds(model string) []kind {
+	name := strings.TrimPrefix(model, "models/")
+
+	switch {
+	case strings.Contains(name, "embedding"),
+		strings.HasSuffix(name, "-tts"),
+		strings.HasPrefix(name, "gemma-3-1b"):
+		return textOnly
+	case strings.Contains(name, "image-generation"),
+		strings.HasPrefix(name, "gemma-"):
+		return textImage
+	case strings.Contains(name, "pro-vision"):
+		return visionKinds
+	default:
+		return allKinds
+	}
+}
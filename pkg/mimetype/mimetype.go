@@ -0,0 +1,234 @@
+// Package mimetype detects MIME types of files attached to prompts and
+// checks whether a model accepts them.
+package mimetype
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OctetStream is the type of files whose contents are not recognized.
+const OctetStream = "application/octet-stream"
+
+// sniffLen is the number of leading bytes examined, same as
+// http.DetectContentType.
+const sniffLen = 512
+
+// signature identifies a type by bytes found at an offset.
+type signature struct {
+	offset   int
+	magic    []byte
+	mimeType string
+}
+
+// signatures cover types that http.DetectContentType does not recognize.
+var signatures = []signature{
+	{offset: 0, magic: []byte("fLaC"), mimeType: "audio/flac"},
+	{offset: 0, magic: []byte("FLV"), mimeType: "video/x-flv"},
+	{offset: 0, magic: []byte{0x30, 0x26, 0xb2, 0x75, 0x8e, 0x66, 0xcf, 0x11}, mimeType: "video/x-ms-wmv"},
+	{offset: 0, magic: []byte{0x00, 0x00, 0x01, 0xba}, mimeType: "video/mpeg"},
+	{offset: 0, magic: []byte{0x00, 0x00, 0x01, 0xb3}, mimeType: "video/mpeg"},
+	{offset: 0, magic: []byte{0xff, 0xf1}, mimeType: "audio/aac"},
+	{offset: 0, magic: []byte{0xff, 0xf9}, mimeType: "audio/aac"},
+	{offset: 0, magic: []byte{0xff, 0xfb}, mimeType: "audio/mp3"},
+	{offset: 0, magic: []byte{0xff, 0xf3}, mimeType: "audio/mp3"},
+	{offset: 0, magic: []byte{0xff, 0xf2}, mimeType: "audio/mp3"},
+}
+
+// brands maps major brands of ISO base media files, i.e. the ftyp box,
+// to types.
+var brands = map[string]string{
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"hevc": "image/heic",
+	"hevx": "image/heic",
+	"mif1": "image/heif",
+	"msf1": "image/heif",
+	"heif": "image/heif",
+	"qt  ": "video/quicktime",
+	"3gp4": "video/3gpp",
+	"3gp5": "video/3gpp",
+	"3g2a": "video/3gpp",
+}
+
+// aliases maps types reported by http.DetectContentType to the names
+// used by the API.
+var aliases = map[string]string{
+	"audio/mpeg":      "audio/mp3",
+	"audio/wave":      "audio/wav",
+	"application/ogg": "audio/ogg",
+}
+
+// extensions maps file extensions to types. It is consulted for text
+// files, which cannot be told apart by content, and for files whose
+// content is not recognized.
+var extensions = map[string]string{
+	".txt":      "text/plain",
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+	".csv":      "text/csv",
+	".html":     "text/html",
+	".htm":      "text/html",
+	".css":      "text/css",
+	".js":       "text/javascript",
+	".mjs":      "text/javascript",
+	".ts":       "text/x-typescript",
+	".py":       "text/x-python",
+	".json":     "application/json",
+	".xml":      "text/xml",
+	".rtf":      "text/rtf",
+	".pdf":      "application/pdf",
+	".png":      "image/png",
+	".jpg":      "image/jpeg",
+	".jpeg":     "image/jpeg",
+	".webp":     "image/webp",
+	".heic":     "image/heic",
+	".heif":     "image/heif",
+	".mp3":      "audio/mp3",
+	".wav":      "audio/wav",
+	".aif":      "audio/aiff",
+	".aiff":     "audio/aiff",
+	".aac":      "audio/aac",
+	".ogg":      "audio/ogg",
+	".flac":     "audio/flac",
+	".mp4":      "video/mp4",
+	".mpeg":     "video/mpeg",
+	".mpg":      "video/mpg",
+	".mov":      "video/mov",
+	".avi":      "video/avi",
+	".flv":      "video/x-flv",
+	".webm":     "video/webm",
+	".wmv":      "video/wmv",
+	".3gp":      "video/3gpp",
+}
+
+// Detect returns the MIME type of file at path. Content is examined first
+// and the extension is used to refine text types, such as source code,
+// or when content is not recognized. Text files of unknown extension are
+// reported as text/plain.
+func Detect(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	b := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	return detect(b[:n], filepath.Ext(path)), nil
+}
+
+func detect(b []byte, ext string) string {
+	byExt, knownExt := extensions[strings.ToLower(ext)]
+
+	mimeType := sniff(b)
+	switch {
+	case IsText(mimeType):
+		if knownExt && IsText(byExt) {
+			return byExt
+		}
+		return mimeType
+	case mimeType == OctetStream && knownExt:
+		return byExt
+	default:
+		return mimeType
+	}
+}
+
+// sniff returns the type of content b without any parameters such as
+// charset.
+func sniff(b []byte) string {
+	if len(b) >= 12 && string(b[4:8]) == "ftyp" {
+		if mimeType, ok := brands[string(b[8:12])]; ok {
+			return mimeType
+		}
+	}
+
+	for _, s := range signatures {
+		if len(b) >= s.offset+len(s.magic) && bytes.Equal(b[s.offset:s.offset+len(s.magic)], s.magic) {
+			return s.mimeType
+		}
+	}
+
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(b))
+	if err != nil {
+		return OctetStream
+	}
+	if alias, ok := aliases[mimeType]; ok {
+		mimeType = alias
+	}
+
+	return mimeType
+}
+
+// IsText reports whether mimeType is a text type, including source code
+// and data formats such as JSON.
+func IsText(mimeType string) bool {
+	return kindOf(mimeType) == kindText
+}
+
+// Check returns an error when mimeType is not supported or when model does
+// not accept files of that kind. Models that are not known are assumed
+// to accept all supported types.
+func Check(model, mimeType string) error {
+	kind := kindOf(mimeType)
+	if kind == kindUnknown {
+		return fmt.Errorf("file type %s is not supported", mimeType)
+	}
+
+	if len(model) == 0 {
+		return nil
+	}
+
+	for _, k := range modelKinds(model) {
+		if k == kind {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("model %s does not accept %s files of type %s",
+		strings.TrimPrefix(model, "models/"), kind, mimeType)
+}
+
+// preferredExtensions holds extensions of types that more than one
+// extension maps to.
+var preferredExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"text/html":       ".html",
+	"text/markdown":   ".md",
+	"text/javascript": ".js",
+	"audio/aiff":      ".aiff",
+}
+
+// Extension returns the file extension, including the leading dot, for
+// files of mimeType, which may carry parameters. Types without a known
+// extension get .bin.
+func Extension(mimeType string) string {
+	if t, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = strings.ToLower(t)
+	}
+
+	if ext, ok := preferredExtensions[mimeType]; ok {
+		return ext
+	}
+	for ext, t := range extensions {
+		if t == mimeType {
+			return ext
+		}
+	}
+	if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+
+	return ".bin"
+}
@@ -0,0 +1,95 @@
+package mimetype
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "photo.png", content: "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", want: "image/png"},
+		{name: "photo.dat", content: "\xff\xd8\xff\xe0\x00\x10JFIF\x00", want: "image/jpeg"},
+		{name: "IMG_0001.HEIC", content: "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00", want: "image/heic"},
+		{name: "doc", content: "%PDF-1.7\n", want: "application/pdf"},
+		{name: "clip.mov", content: "\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00", want: "video/quicktime"},
+		{name: "song.flac", content: "fLaC\x00\x00\x00\x22", want: "audio/flac"},
+		{name: "song.mp3", content: "ID3\x03\x00\x00\x00\x00\x00\x00", want: "audio/mp3"},
+		{name: "main.go", content: "package main\n\nfunc main() {}\n", want: "text/plain"},
+		{name: "script.py", content: "print('hi')\n", want: "text/x-python"},
+		{name: "README.md", content: "# title\n", want: "text/markdown"},
+		{name: "data.json", content: "{\"a\": 1}\n", want: "application/json"},
+		{name: "Makefile", content: "all:\n\tgo build\n", want: "text/plain"},
+		{name: "archive.zip", content: "PK\x03\x04\x14\x00", want: "application/zip"},
+		{name: "fake.png", content: "\x00\x01\x02\x03\x04", want: "image/png"},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Detect(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		model    string
+		mimeType string
+		wantErr  bool
+	}{
+		{model: "models/gemini-2.0-flash", mimeType: "video/mp4"},
+		{model: "models/gemini-2.0-flash", mimeType: "application/zip", wantErr: true},
+		{model: "models/gemini-2.5-flash-preview-tts", mimeType: "image/png", wantErr: true},
+		{model: "models/gemma-3-27b-it", mimeType: "image/png"},
+		{model: "models/gemma-3-27b-it", mimeType: "audio/wav", wantErr: true},
+		{model: "models/gemini-pro-vision", mimeType: "application/pdf", wantErr: true},
+		{model: "models/some-future-model", mimeType: "audio/ogg"},
+		{model: "", mimeType: "text/plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model+" "+tt.mimeType, func(t *testing.T) {
+			if err := Check(tt.model, tt.mimeType); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtension(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		want     string
+	}{
+		{mimeType: "image/png", want: ".png"},
+		{mimeType: "image/jpeg", want: ".jpg"},
+		{mimeType: "audio/wav", want: ".wav"},
+		{mimeType: "text/plain; charset=utf-8", want: ".txt"},
+		{mimeType: "image/gif", want: ".gif"},
+		{mimeType: "application/x-unknown", want: ".bin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mimeType, func(t *testing.T) {
+			if got := Extension(tt.mimeType); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
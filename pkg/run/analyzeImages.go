@@ -2,20 +2,24 @@ package run
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/google/generative-ai-go/genai"
-	"github.com/google/uuid"
+	"github.com/kubetrail/gini/pkg/backend"
 	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/imageprep"
+	"github.com/kubetrail/gini/pkg/session"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"google.golang.org/api/option"
 )
 
 func AnalyzeImages(cmd *cobra.Command, args []string) error {
@@ -26,18 +30,46 @@ func AnalyzeImages(cmd *cobra.Command, args []string) error {
 	_ = viper.BindPFlag(flags.Model, cmd.Flag(flags.Model))
 	_ = viper.BindPFlag(flags.File, cmd.Flag(flags.File))
 	_ = viper.BindPFlag(flags.Format, cmd.Flag(flags.Format))
+	_ = viper.BindPFlag(flags.Stream, cmd.Flag(flags.Stream))
+	_ = viper.BindPFlag(flags.MaxDimension, cmd.Flag(flags.MaxDimension))
+	_ = viper.BindPFlag(flags.ConvertTo, cmd.Flag(flags.ConvertTo))
+	_ = viper.BindPFlag(flags.Quality, cmd.Flag(flags.Quality))
+	_ = viper.BindPFlag(flags.KeepMetadata, cmd.Flag(flags.KeepMetadata))
+	_ = viper.BindPFlag(flags.OutputDir, cmd.Flag(flags.OutputDir))
 
 	pFlags := getPersistentFlags(cmd)
 
 	modelName := viper.GetString(flags.Model)
 	files := viper.GetStringSlice(flags.File)
 	formats := viper.GetStringSlice(flags.Format)
+	stream := viper.GetBool(flags.Stream)
+	outputDir := viper.GetString(flags.OutputDir)
+	prep := imageprep.Options{
+		MaxDimension: viper.GetInt(flags.MaxDimension),
+		Format:       viper.GetString(flags.ConvertTo),
+		Quality:      viper.GetInt(flags.Quality),
+		KeepMetadata: viper.GetBool(flags.KeepMetadata),
+	}
 
 	if len(pFlags.ApiKey) == 0 || len(modelName) == 0 {
 		return fmt.Errorf("api-key or model cannot be empty")
 	}
 
-	fileName := fmt.Sprintf("history-%s.txt", uuid.New().String())
+	if err := prep.Validate(); err != nil {
+		return err
+	}
+
+	system, err := getSystemInstruction(cmd)
+	if err != nil {
+		return err
+	}
+
+	sess, sessionFile, err := openSession("", modelName, pFlags.AutoSave)
+	if err != nil {
+		return err
+	}
+
+	fileName := transcriptPath(sessionFile)
 	var fileWriter *bufio.Writer
 	if pFlags.AutoSave {
 		f, err := os.Create(fileName)
@@ -56,98 +88,82 @@ func AnalyzeImages(cmd *cobra.Command, args []string) error {
 		); err != nil {
 			return fmt.Errorf("failed to write to history file: %w", err)
 		}
+
+		if len(system) > 0 {
+			if _, err := fileWriter.WriteString(fmt.Sprintf("[system]>>> %s\n", system)); err != nil {
+				return fmt.Errorf("failed to write to history file: %w", err)
+			}
+		}
 	}
 
-	client, err := genai.NewClient(ctx, option.WithAPIKey(pFlags.ApiKey))
+	client, err := connect(ctx, cmd, pFlags)
 	if err != nil {
-		return fmt.Errorf("failed to create new genai client: %w", err)
+		return err
 	}
 	defer client.Close()
 
-	model := client.GenerativeModel(modelName)
-	if pFlags.TopP >= 0 {
-		model.SetTopP(pFlags.TopP)
-	}
-	if pFlags.TopK >= 0 {
-		model.SetTopK(pFlags.TopK)
-	}
-	if pFlags.Temperature >= 0 {
-		model.SetTemperature(pFlags.Temperature)
-	}
-	if pFlags.CandidateCount >= 0 {
-		model.SetCandidateCount(pFlags.CandidateCount)
+	model := backend.NewModel(modelName)
+	if err := configureModel(model, pFlags); err != nil {
+		return err
 	}
-	if pFlags.MaxOutputTokens >= 0 {
-		model.SetMaxOutputTokens(pFlags.MaxOutputTokens)
+	model.SystemInstruction = systemContent(system)
+	if err := configureResponse(cmd, model); err != nil {
+		return err
 	}
+	// output is kept free of any decoration when responding with json
+	quiet := jsonOutput(model)
 
 	parts := make([]genai.Part, len(files)+1)
-	if formats == nil {
-		formats = make([]string, len(files))
-		for i := range formats {
-			formats[i] = flags.FormatJpeg
-		}
-	} else {
-		if len(formats) > len(files) {
-			return fmt.Errorf("cannot provide more formats than number of images")
-		}
-		for i := len(formats); i < len(files); i++ {
-			formats = append(formats, flags.FormatJpeg)
+	// image formats can be given without the image/ prefix
+	for i := range formats {
+		if path.Base(formats[i]) == formats[i] {
+			formats[i] = "image/" + formats[i]
 		}
 	}
+	formats, err = detectFormats(files, formats, modelName)
+	if err != nil {
+		return err
+	}
+
+	// upload progress is kept off stdout when responding with json
+	progress := cmd.OutOrStdout()
+	if quiet {
+		progress = cmd.ErrOrStderr()
+	}
+	tmpDir, err := os.MkdirTemp("", "gini-images-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
 
 	for i, file := range files {
-		b, err := os.ReadFile(file)
+		prepared, mimeType, err := prepareImage(file, formats[i], prep, tmpDir, progress)
 		if err != nil {
-			return fmt.Errorf("failed to read image file: %w", err)
-		}
-		if len(b) > flags.MaxBlobBufferSizeBytes {
-			return fmt.Errorf("%s file size needs to be less than %d bytes",
-				file, flags.MaxBlobBufferSizeBytes)
+			return err
 		}
 
-		if path.Base(formats[i]) == formats[i] {
-			formats[i] = "image/" + formats[i]
+		part, name, err := attachFile(ctx, client, prepared, mimeType, flags.MaxBlobBufferSizeBytes, progress)
+		if err != nil {
+			return err
 		}
-		parts[i] = genai.Blob{
-			MIMEType: formats[i],
-			Data:     b,
+		if len(name) > 0 {
+			defer func() { _ = client.DeleteFile(ctx, name) }()
 		}
+
+		parts[i] = part
 	}
 
 	var prompt string
 	if len(args) > 0 {
 		prompt = strings.Join(args, " ")
 	} else {
-		_, _ = fmt.Fprintf(cmd.OutOrStdout(), ">>> ")
-
-		scanner := bufio.NewScanner(os.Stdin)
-		var lines []string
-		var hold bool
-	InnerLoop:
-		for {
-			scanner.Scan()
-			line := scanner.Text()
-
-			select {
-			case <-ctx.Done():
-				break InnerLoop
-			default:
-				if len(line) == 0 && !hold {
-					break InnerLoop
-				}
-				if strings.TrimSpace(line) == startHold {
-					hold = true
-					continue InnerLoop
-				}
-				if strings.TrimSpace(line) == endHold && hold {
-					break InnerLoop
-				}
-				lines = append(lines, line)
-			}
+		if !quiet {
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), ">>> ")
 		}
 
-		if err := scanner.Err(); err != nil {
+		scanner := bufio.NewScanner(cmd.InOrStdin())
+		lines, err := readLines(ctx, scanner)
+		if err != nil {
 			return fmt.Errorf("error reading input: %w", err)
 		}
 
@@ -160,59 +176,133 @@ func AnalyzeImages(cmd *cobra.Command, args []string) error {
 
 	parts[len(files)] = genai.Text(prompt)
 
+	s := "...sending prompt... please wait"
 	send := func(msg string) (*genai.GenerateContentResponse, error) {
-		res, err := model.GenerateContent(ctx, parts...)
+		if stream {
+			return streamResponse(client.GenerateContentStream(ctx, model, parts...), cmd.OutOrStdout(), s)
+		}
+		res, err := client.GenerateContent(ctx, model, parts...)
 		if err != nil {
-			return nil, fmt.Errorf("failure at backend: %w", err)
+			return nil, fmt.Errorf("failure at backend: %w", explainBlocked(err))
 		}
 		return res, nil
 	}
 
-	s := "...sending prompt... please wait"
-	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\r", s)
+	if !stream && !quiet {
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\r", s)
+	}
 	res, err := send(prompt)
 	if err != nil {
 		return err
 	}
-	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\r", strings.Repeat(" ", len(s)+2))
-
-	if pFlags.AllowHarmProbability != flags.HarmProbabilityUnspecified {
-		var harmProbability genai.HarmProbability
-		switch pFlags.AllowHarmProbability {
-		case flags.HarmProbabilityNegligible:
-			harmProbability = genai.HarmProbabilityNegligible
-		case flags.HarmProbabilityLow:
-			harmProbability = genai.HarmProbabilityLow
-		case flags.HarmProbabilityMedium:
-			harmProbability = genai.HarmProbabilityMedium
-		case flags.HarmProbabilityHigh:
-			harmProbability = genai.HarmProbabilityHigh
-		default:
-			return fmt.Errorf("invalid harm probability:%s", pFlags.AllowHarmProbability)
-		}
-
-		if res != nil && res.PromptFeedback != nil {
-			for _, rating := range res.PromptFeedback.SafetyRatings {
-				if rating.Probability > harmProbability {
-					return fmt.Errorf("output harm probability threshold crossed")
-				}
-			}
-		}
+	if !stream && !quiet {
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\r", strings.Repeat(" ", len(s)+2))
+	}
+
+	if err := checkHarm(res, pFlags.AllowHarmProbability); err != nil {
+		return err
 	}
 
-	if err := printResponse(res, cmd.OutOrStdout(), pFlags.Render, pFlags.AutoSave, fileWriter); err != nil {
+	if quiet {
+		if err := printJSON(res, cmd.OutOrStdout(), model.ResponseSchema, fileWriter); err != nil {
+			return err
+		}
+	} else if err := printResponse(res, cmd.OutOrStdout(), pFlags.Render, pFlags.AutoSave, fileWriter, outputDir); err != nil {
 		return fmt.Errorf("failed to write response: %w", err)
 	}
 
+	notesWriter := cmd.OutOrStdout()
+	if quiet {
+		notesWriter = cmd.ErrOrStderr()
+	}
+	if err := printNotes(res, notesWriter, fileWriter); err != nil {
+		return err
+	}
+
 	if pFlags.AutoSave {
+		paths := make([]string, len(files))
+		for i, file := range files {
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				return fmt.Errorf("failed to resolve path of file %s: %w", file, err)
+			}
+			sess.AddFile(session.File{Path: abs, MIMEType: formats[i]})
+			paths[i] = abs
+		}
+		sess.SystemInstruction = system
+		sess.GenerationConfig = model.GenerationConfig
+		sess.AddUsage(res.UsageMetadata)
+		sess.AddTurn(session.Turn{
+			Prompt:       prompt,
+			Response:     responseText(res),
+			Files:        paths,
+			FinishReason: finishReason(res),
+			Citations:    citations(res),
+		})
+		if err := sess.Save(sessionFile); err != nil {
+			return err
+		}
+
 		if err := fileWriter.Flush(); err != nil {
 			return fmt.Errorf("failed to write to history file: %w", err)
 		}
 
-		if _, err := fmt.Fprintln(cmd.OutOrStdout(), fmt.Sprintf("history saved to %s", fileName)); err != nil {
+		w := cmd.OutOrStdout()
+		if quiet {
+			w = cmd.ErrOrStderr()
+		}
+		if _, err := fmt.Fprintln(w, fmt.Sprintf("history saved to %s", fileName)); err != nil {
 			return fmt.Errorf("failed to write to output: %w", err)
 		}
 	}
 
 	return nil
 }
+
+// prepareImage resizes, converts and removes metadata of an image file
+// as given by opts. The prepared image is written to dir and its path and
+// type are returned, the file itself is returned when left unchanged, as
+// are files other than images imageprep supports.
+func prepareImage(file, mimeType string, opts imageprep.Options, dir string, w io.Writer) (string, string, error) {
+	if !imageprep.Supported(mimeType) {
+		return file, mimeType, nil
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read image file: %w", err)
+	}
+
+	res, err := imageprep.Process(b, mimeType, opts)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to prepare image %s: %w", file, err)
+	}
+	if len(res.Warning) > 0 {
+		_, _ = fmt.Fprintf(w, "warning: %s was left at its size and format: %s\n", file, res.Warning)
+	}
+	if bytes.Equal(res.Data, b) {
+		return file, mimeType, nil
+	}
+
+	if res.Reencoded {
+		_, _ = fmt.Fprintf(w, "prepared %s: %dx%d %s, %s\n",
+			file, res.Width, res.Height, res.MIMEType, formatSize(int64(len(res.Data))))
+	}
+
+	// files are kept apart since images of different directories can
+	// have the same name
+	sub, err := os.MkdirTemp(dir, "")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	base := filepath.Base(file)
+	if res.MIMEType != mimeType {
+		base = strings.TrimSuffix(base, filepath.Ext(base)) + "." + path.Base(res.MIMEType)
+	}
+	prepared := filepath.Join(sub, base)
+	if err := os.WriteFile(prepared, res.Data, 0600); err != nil {
+		return "", "", fmt.Errorf("failed to write prepared image: %w", err)
+	}
+
+	return prepared, res.MIMEType, nil
+}
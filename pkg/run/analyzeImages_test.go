@@ -0,0 +1,324 @@
+package run
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/kubetrail/gini/pkg/flags"
+)
+
+func TestAnalyzeImages(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	file := filepath.Join(dir, "image.png")
+	if err := os.WriteFile(file, []byte("\x89PNG\r\n\x1a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pdf := filepath.Join(dir, "doc.pdf")
+	if err := os.WriteFile(pdf, []byte("%PDF-1.7\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		flags    []string
+		wantMIME string
+		wantText string
+		wantReqs int
+	}{
+		{
+			name:     "prompt from args",
+			flags:    []string{"--file", file, "--format", "png", "describe", "this"},
+			wantMIME: "image/png",
+			wantText: "describe this",
+			wantReqs: 1,
+		},
+		{
+			name:     "prompt from input",
+			input:    "{{\ndescribe\n\nthis\n}}\n",
+			flags:    []string{"--file", file},
+			wantMIME: "image/png",
+			wantText: "describe\n\nthis",
+			wantReqs: 1,
+		},
+		{
+			name:     "pdf left as is",
+			flags:    []string{"--file", pdf, "--max-dimension", "100", "summarize"},
+			wantMIME: "application/pdf",
+			wantText: "summarize",
+			wantReqs: 1,
+		},
+		{
+			name:     "empty prompt",
+			input:    "\n",
+			flags:    []string{"--file", file},
+			wantReqs: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := backend.NewFake(backend.TextResponse("a seagull"))
+			root, out := newTestCommand(t, AnalyzeImages, fake, tt.input, tt.flags...)
+
+			if err := root.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(fake.Requests) != tt.wantReqs {
+				t.Fatalf("got %d requests, want %d", len(fake.Requests), tt.wantReqs)
+			}
+			if tt.wantReqs == 0 {
+				return
+			}
+
+			parts := fake.Requests[0].Contents[0].Parts
+			blob, ok := parts[0].(genai.Blob)
+			if !ok {
+				t.Fatalf("got %T, want genai.Blob", parts[0])
+			}
+			if blob.MIMEType != tt.wantMIME {
+				t.Fatalf("got mime type %s, want %s", blob.MIMEType, tt.wantMIME)
+			}
+			if got := parts[1].(genai.Text); string(got) != tt.wantText {
+				t.Fatalf("got prompt %q, want %q", got, tt.wantText)
+			}
+			if !strings.Contains(out.String(), "a seagull") {
+				t.Fatalf("output %q does not contain response", out.String())
+			}
+		})
+	}
+}
+
+func TestAnalyzeImagesUploadsLargeFiles(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	file := filepath.Join(dir, "photo.png")
+	// a private chunk makes the image large while keeping it well formed
+	chunk := make([]byte, 12+flags.MaxBlobBufferSizeBytes)
+	binary.BigEndian.PutUint32(chunk, flags.MaxBlobBufferSizeBytes)
+	copy(chunk[4:], "prVt")
+	b := append([]byte("\x89PNG\r\n\x1a\n"), chunk...)
+	if err := os.WriteFile(file, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := backend.NewFake(backend.TextResponse("a seagull"))
+	root, out := newTestCommand(t, AnalyzeImages, fake, "", "--file", file, "describe", "this")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	parts := fake.Requests[0].Contents[0].Parts
+	if _, ok := parts[0].(genai.FileData); !ok {
+		t.Fatalf("got %T, want genai.FileData", parts[0])
+	}
+	if !strings.Contains(out.String(), "uploading "+file+"...done!") {
+		t.Errorf("output does not report upload:\n%s", out.String())
+	}
+	if len(fake.Files) != 0 {
+		t.Fatalf("uploaded files were not deleted: %v", fake.Files)
+	}
+}
+
+func TestAnalyzeImagesPreparesImages(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	img := image.NewNRGBA(image.Rect(0, 0, 300, 150))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	// the text chunk follows the header chunk
+	text := []byte("\x00\x00\x00\x07tEXtGPS\x00abc")
+	text = binary.BigEndian.AppendUint32(text, crc32.ChecksumIEEE(text[4:]))
+	data := append(append(append([]byte{}, buf.Bytes()[:33]...), text...), buf.Bytes()[33:]...)
+	file := filepath.Join(dir, "photo.png")
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		flags      []string
+		wantMIME   string
+		wantWidth  int
+		wantOutput string
+	}{
+		{
+			name:      "metadata removed",
+			wantMIME:  "image/png",
+			wantWidth: 300,
+		},
+		{
+			name:       "resized and converted",
+			flags:      []string{"--max-dimension", "100", "--convert-to", "jpeg"},
+			wantMIME:   "image/jpeg",
+			wantWidth:  100,
+			wantOutput: "prepared " + file + ": 100x50 image/jpeg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := backend.NewFake(backend.TextResponse("a seagull"))
+			args := append([]string{"--file", file}, tt.flags...)
+			root, out := newTestCommand(t, AnalyzeImages, fake, "", append(args, "describe")...)
+			if err := root.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			blob, ok := fake.Requests[0].Contents[0].Parts[0].(genai.Blob)
+			if !ok {
+				t.Fatalf("got %T, want genai.Blob", fake.Requests[0].Contents[0].Parts[0])
+			}
+			if blob.MIMEType != tt.wantMIME {
+				t.Errorf("got mime type %s, want %s", blob.MIMEType, tt.wantMIME)
+			}
+			if bytes.Contains(blob.Data, []byte("GPS")) {
+				t.Error("metadata was sent")
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(blob.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != tt.wantWidth {
+				t.Errorf("got width %d, want %d", cfg.Width, tt.wantWidth)
+			}
+			if !strings.Contains(out.String(), tt.wantOutput) {
+				t.Errorf("output does not contain %q:\n%s", tt.wantOutput, out.String())
+			}
+		})
+	}
+}
+
+func TestAnalyzeImagesKeepsUndecodableImages(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	file := filepath.Join(dir, "photo.heic")
+	data := []byte("\x00\x00\x00\x10ftypheic\x00\x00\x00\x00")
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := backend.NewFake(backend.TextResponse("a seagull"))
+	root, out := newTestCommand(t, AnalyzeImages, fake, "",
+		"--file", file, "--format", "image/heic", "--max-dimension", "100", "describe")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	blob, ok := fake.Requests[0].Contents[0].Parts[0].(genai.Blob)
+	if !ok {
+		t.Fatalf("got %T, want genai.Blob", fake.Requests[0].Contents[0].Parts[0])
+	}
+	if blob.MIMEType != "image/heic" || !bytes.Equal(blob.Data, data) {
+		t.Errorf("got %s image %q, want image as is", blob.MIMEType, blob.Data)
+	}
+	if want := "warning: " + file + " was left at its size and format"; !strings.Contains(out.String(), want) {
+		t.Errorf("output does not contain %q:\n%s", want, out.String())
+	}
+}
+
+func TestAnalyzeImagesSavesImages(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	file := filepath.Join(dir, "image.png")
+	if err := os.WriteFile(file, []byte("\x89PNG\r\n\x1a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	res := backend.TextResponse("a seagull")
+	res.Candidates[0].Content.Parts = append(res.Candidates[0].Content.Parts,
+		genai.Blob{MIMEType: "image/png", Data: []byte("png data")})
+
+	outputDir := filepath.Join(dir, "out")
+	fake := backend.NewFake(res)
+	root, _ := newTestCommand(t, AnalyzeImages, fake, "", "--file", file, "--output-dir", outputDir, "draw", "it")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := filepath.Glob(filepath.Join(outputDir, "image-*.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 {
+		t.Fatalf("got %d images in output directory, want 1", len(images))
+	}
+}
+
+func TestAnalyzeImagesJSON(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	file := filepath.Join(dir, "image.png")
+	if err := os.WriteFile(file, []byte("\x89PNG\r\n\x1a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	schemaFile := filepath.Join(dir, "schema.yaml")
+	if err := os.WriteFile(schemaFile, []byte("type: object\nproperties:\n  bird:\n    type: string\nrequired: [bird]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		response string
+		wantOut  string
+		wantErr  string
+	}{
+		{
+			name:     "valid response",
+			response: `{"bird": "seagull"}`,
+			wantOut:  "{\"bird\": \"seagull\"}\n",
+		},
+		{
+			name:     "response not matching schema",
+			response: `{"fish": "cod"}`,
+			wantErr:  `missing required property "bird"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := backend.NewFake(backend.TextResponse(tt.response))
+			root, out := newTestCommand(t, AnalyzeImages, fake, "what bird is this\n\n",
+				"--file", file, "--response-schema", schemaFile)
+
+			err := root.Execute()
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			model := fake.Requests[0].Model
+			if model.ResponseMIMEType != "application/json" || model.ResponseSchema == nil {
+				t.Fatalf("model is not configured for json: %q %v", model.ResponseMIMEType, model.ResponseSchema)
+			}
+			// output is raw json without prompt markers or placeholders
+			if out.String() != tt.wantOut {
+				t.Fatalf("got output %q, want %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/session"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func Ask(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	_ = viper.BindPFlag(flags.Model, cmd.Flag(flags.Model))
+	_ = viper.BindPFlag(flags.File, cmd.Flag(flags.File))
+	_ = viper.BindPFlag(flags.Format, cmd.Flag(flags.Format))
+	_ = viper.BindPFlag(flags.CachedContent, cmd.Flag(flags.CachedContent))
+	_ = viper.BindPFlag(flags.OutputDir, cmd.Flag(flags.OutputDir))
+
+	pFlags := getPersistentFlags(cmd)
+
+	modelName := viper.GetString(flags.Model)
+	files := viper.GetStringSlice(flags.File)
+	formats := viper.GetStringSlice(flags.Format)
+	cachedContent := viper.GetString(flags.CachedContent)
+	outputDir := viper.GetString(flags.OutputDir)
+
+	if len(pFlags.ApiKey) == 0 || len(modelName) == 0 {
+		return fmt.Errorf("api-key or model cannot be empty")
+	}
+
+	system, err := getSystemInstruction(cmd)
+	if err != nil {
+		return err
+	}
+
+	formats, err = detectFormats(files, formats, modelName)
+	if err != nil {
+		return err
+	}
+
+	// piped input is appended to the prompt given as arguments
+	prompt := strings.TrimSpace(strings.Join(args, " "))
+	if !isTerminal(cmd.InOrStdin()) {
+		b, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+
+		if input := strings.TrimSpace(string(b)); len(input) > 0 {
+			if len(prompt) > 0 {
+				prompt += "\n\n"
+			}
+			prompt += input
+		}
+	}
+
+	if len(prompt) == 0 {
+		return fmt.Errorf("prompt cannot be empty, provide it as arguments or via stdin")
+	}
+
+	client, err := connect(ctx, cmd, pFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	model := backend.NewModel(modelName)
+	if err := configureModel(model, pFlags); err != nil {
+		return err
+	}
+	model.SystemInstruction = systemContent(system)
+	if err := configureResponse(cmd, model); err != nil {
+		return err
+	}
+	if len(cachedContent) > 0 {
+		if err := useCachedContent(ctx, cmd, client, model, cachedContent); err != nil {
+			return err
+		}
+		modelName = model.Name
+	}
+
+	parts := []genai.Part{genai.Text(prompt)}
+	paths := make([]string, len(files))
+	for i, file := range files {
+		part, name, err := attachFile(ctx, client, file, formats[i], flags.MaxBlobBufferSizeBytes, cmd.ErrOrStderr())
+		if err != nil {
+			// files that cannot be read locally are not backend failures
+			var pathErr *fs.PathError
+			if errors.As(err, &pathErr) {
+				return err
+			}
+			return exitError(ExitCodeFailed, "failure at backend: %w", err)
+		}
+		if len(name) > 0 {
+			defer func() { _ = client.DeleteFile(ctx, name) }()
+		}
+
+		if paths[i], err = filepath.Abs(file); err != nil {
+			return fmt.Errorf("failed to resolve path of file %s: %w", file, err)
+		}
+		parts = append(parts, part)
+	}
+
+	res, err := client.GenerateContent(ctx, model, parts...)
+	if err != nil {
+		var blocked *genai.BlockedError
+		if errors.As(err, &blocked) {
+			return exitError(ExitCodeBlocked, "%w", explainBlocked(err))
+		}
+		return exitError(ExitCodeFailed, "failure at backend: %w", err)
+	}
+
+	if err := checkHarm(res, pFlags.AllowHarmProbability); err != nil {
+		return &ExitError{Code: ExitCodeBlocked, Err: err}
+	}
+
+	// images and other files the model responds with are saved and their
+	// paths printed after the text
+	var saved []string
+	for _, blob := range responseBlobs(res) {
+		path, err := saveBlob(blob, outputDir)
+		if err != nil {
+			return err
+		}
+		saved = append(saved, path)
+	}
+
+	text := strings.TrimSpace(responseText(res))
+	if len(text) == 0 && len(saved) == 0 {
+		return exitError(ExitCodeEmpty, "empty response from model")
+	}
+
+	if jsonOutput(model) {
+		if err := printJSON(res, cmd.OutOrStdout(), model.ResponseSchema, nil); err != nil {
+			return err
+		}
+	} else if len(text) > 0 {
+		if _, err := fmt.Fprintln(cmd.OutOrStdout(), text); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+	for _, path := range saved {
+		if _, err := fmt.Fprintln(cmd.OutOrStdout(), path); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+
+	// stdout is kept for the response only
+	if err := printNotes(res, cmd.ErrOrStderr(), nil); err != nil {
+		return err
+	}
+
+	if pFlags.AutoSave {
+		sess, sessionFile, err := openSession("", modelName, true)
+		if err != nil {
+			return err
+		}
+
+		for i, path := range paths {
+			sess.AddFile(session.File{Path: path, MIMEType: formats[i]})
+		}
+		sess.SystemInstruction = system
+		sess.GenerationConfig = model.GenerationConfig
+		sess.AddUsage(res.UsageMetadata)
+		sess.AddTurn(session.Turn{
+			Prompt:       prompt,
+			Response:     responseText(res),
+			Files:        paths,
+			FinishReason: finishReason(res),
+			Citations:    citations(res),
+		})
+		if err := sess.Save(sessionFile); err != nil {
+			return err
+		}
+
+		// stdout is kept for the response only
+		if _, err := fmt.Fprintf(cmd.ErrOrStderr(), "session saved to %s\n", sessionFile); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package run
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/kubetrail/gini/pkg/flags"
+)
+
+func TestAsk(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		args       []string
+		reply      backend.Reply
+		wantPrompt string
+		wantOut    string
+		wantCode   int
+	}{
+		{
+			name:       "prompt and piped input are combined",
+			input:      "diff --git a/x b/x\n",
+			args:       []string{"write", "a", "commit", "message"},
+			reply:      backend.Reply{Response: backend.TextResponse("Fix x\n")},
+			wantPrompt: "write a commit message\n\ndiff --git a/x b/x",
+			wantOut:    "Fix x\n",
+		},
+		{
+			name:       "prompt from input only",
+			input:      "hello",
+			reply:      backend.Reply{Response: backend.TextResponse("hi")},
+			wantPrompt: "hello",
+			wantOut:    "hi\n",
+		},
+		{
+			name:     "blocked response",
+			args:     []string{"hello"},
+			reply:    backend.Reply{Err: &genai.BlockedError{}},
+			wantCode: ExitCodeBlocked,
+		},
+		{
+			name:     "failed request",
+			args:     []string{"hello"},
+			reply:    backend.Reply{Err: errors.New("unavailable")},
+			wantCode: ExitCodeFailed,
+		},
+		{
+			name:     "empty response",
+			args:     []string{"hello"},
+			reply:    backend.Reply{Response: backend.TextResponse(" ")},
+			wantCode: ExitCodeEmpty,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &backend.Fake{Script: []backend.Reply{tt.reply}}
+			root, out := newTestCommand(t, Ask, fake, tt.input, tt.args...)
+
+			err := root.Execute()
+			if tt.wantCode != 0 {
+				var exitErr *ExitError
+				if !errors.As(err, &exitErr) || exitErr.Code != tt.wantCode {
+					t.Fatalf("got error %v, want exit code %d", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := fake.Requests[0].Contents[0].Parts[0].(genai.Text); string(got) != tt.wantPrompt {
+				t.Fatalf("got prompt %q, want %q", got, tt.wantPrompt)
+			}
+			// nothing but the response is printed
+			if out.String() != tt.wantOut {
+				t.Fatalf("got output %q, want %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestAskEmptyPrompt(t *testing.T) {
+	root, _ := newTestCommand(t, Ask, backend.NewFake(), "")
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "prompt cannot be empty") {
+		t.Fatalf("got error %v, want empty prompt error", err)
+	}
+}
+
+func TestAskSavesImages(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "images")
+	res := backend.TextResponse("a cat")
+	res.Candidates[0].Content.Parts = append(res.Candidates[0].Content.Parts,
+		genai.Blob{MIMEType: "image/png", Data: []byte("png data")})
+
+	fake := backend.NewFake(res)
+	root, out := newTestCommand(t, Ask, fake, "",
+		"draw a cat", "--response-modalities", "text,image", "--output-dir", dir)
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fake.Requests[0].Model.ResponseModalities, []string{backend.ModalityText, backend.ModalityImage}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got modalities %v, want %v", got, want)
+	}
+
+	images, err := filepath.Glob(filepath.Join(dir, "image-*.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 {
+		t.Fatalf("got %d images, want 1", len(images))
+	}
+	b, err := os.ReadFile(images[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "png data" {
+		t.Fatalf("got image data %q", b)
+	}
+
+	if want := "a cat\n" + images[0] + "\n"; out.String() != want {
+		t.Fatalf("got output %q, want %q", out.String(), want)
+	}
+}
+
+func TestAskInvalidModality(t *testing.T) {
+	root, _ := newTestCommand(t, Ask, backend.NewFake(), "", "hello", "--response-modalities", "video")
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "invalid response modality") {
+		t.Fatalf("got error %v, want invalid modality error", err)
+	}
+}
+
+func TestAskAttachFailure(t *testing.T) {
+	orig := filePollInterval
+	filePollInterval = time.Millisecond
+	t.Cleanup(func() { filePollInterval = orig })
+
+	dir := t.TempDir()
+	large := filepath.Join(dir, "large.pdf")
+	if err := os.WriteFile(large, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// too large to be sent inline, so it is uploaded
+	if err := os.Truncate(large, flags.MaxBlobBufferSizeBytes+1); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		file     string
+		wantCode int
+	}{
+		{name: "rejected upload", file: large, wantCode: ExitCodeFailed},
+		{name: "missing file", file: filepath.Join(dir, "missing.pdf")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := backend.NewFake()
+			fake.FileStates = []genai.FileState{genai.FileStateFailed}
+			root, _ := newTestCommand(t, Ask, fake, "", "summarize", "--file", tt.file, "--format", "application/pdf")
+
+			err := root.Execute()
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			var exitErr *ExitError
+			if got := errors.As(err, &exitErr); got != (tt.wantCode != 0) || (got && exitErr.Code != tt.wantCode) {
+				t.Fatalf("got error %v, want exit code %d", err, tt.wantCode)
+			}
+			if len(fake.Requests) != 0 {
+				t.Fatalf("prompt was sent without its file")
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package run
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/attach"
+	"github.com/kubetrail/gini/pkg/mimetype"
+	"github.com/kubetrail/gini/pkg/session"
+)
+
+// maxChatInlineBytes is the size up to which files attached to a chat are
+// sent inline rather than uploaded. It is lower than for one-shot commands
+// because attachments are sent again with the history of every turn.
+const maxChatInlineBytes = 65536
+
+// splitPatterns separates directories and glob patterns from files.
+// Formats apply to files in the same position, hence they cannot be
+// given for patterns.
+func splitPatterns(files, formats []string) ([]string, []string, error) {
+	var plain, patterns []string
+	for i, file := range files {
+		if !attach.IsPattern(file) {
+			plain = append(plain, file)
+			continue
+		}
+
+		if i < len(formats) {
+			return nil, nil, fmt.Errorf("format cannot be given for directory or pattern %s", file)
+		}
+		patterns = append(patterns, file)
+	}
+
+	return plain, patterns, nil
+}
+
+// attachPattern attaches text files of a directory or matching a glob
+// pattern. A summary of what was attached is printed.
+func (c *chat) attachPattern(pattern string) error {
+	e, err := attach.Expand(pattern)
+	if err != nil {
+		return err
+	}
+
+	inline, uploaded := 0, 0
+	for _, f := range e.Files {
+		if err := c.attach(f.Path, f.MIMEType); err != nil {
+			return err
+		}
+		if _, ok := c.inline[f.Path]; ok {
+			inline++
+		} else {
+			uploaded++
+		}
+	}
+
+	summary := fmt.Sprintf("attached %d files from %s (%s): %d inline, %d uploaded",
+		len(e.Files), pattern, formatSize(e.Size()), inline, uploaded)
+	if e.Binary > 0 || e.Ignored > 0 {
+		summary += fmt.Sprintf(", skipped %d binary and %d ignored", e.Binary, e.Ignored)
+	}
+	_, _ = fmt.Fprintln(c.cmd.OutOrStdout(), summary)
+
+	return nil
+}
+
+// readInline reads content of an inline session file.
+func (c *chat) readInline(file *session.File) error {
+	b, err := os.ReadFile(file.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", file.Path, err)
+	}
+	c.addInline(file.Path, genai.Blob{MIMEType: file.MIMEType, Data: b})
+
+	return nil
+}
+
+// addInline keeps blob of the file at path to be sent inline. Text is
+// kept as text to be bundled with other text files.
+func (c *chat) addInline(path string, blob genai.Blob) {
+	if c.inline == nil {
+		c.inline = make(map[string]genai.Part)
+	}
+	if mimetype.IsText(blob.MIMEType) {
+		c.inline[path] = genai.Text(blob.Data)
+	} else {
+		c.inline[path] = blob
+	}
+}
+
+// addAttached attaches the session file at path to subsequent prompts.
+func (c *chat) addAttached(path string) {
+	for _, p := range c.attached {
+		if p == path {
+			return
+		}
+	}
+
+	c.attached = append(c.attached, path)
+}
+
+// attachedParts returns parts of attached files.
+func (c *chat) attachedParts() ([]genai.Part, error) {
+	parts, err := c.filesParts(c.attached)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach files: %w", err)
+	}
+
+	return parts, nil
+}
+
+// filesParts returns parts of session files at paths. Inline text files
+// are concatenated into a single text part with a header naming every
+// file. An error is returned for files neither inline nor uploaded.
+func (c *chat) filesParts(paths []string) ([]genai.Part, error) {
+	var parts []genai.Part
+	var sb strings.Builder
+	for _, path := range paths {
+		var text string
+		switch part := c.inline[path].(type) {
+		case genai.Text:
+			text = string(part)
+		case nil:
+			uri := c.fileURI(path)
+			if len(uri) == 0 {
+				return nil, fmt.Errorf("file %s was not uploaded", path)
+			}
+			parts = append(parts, genai.FileData{URI: uri})
+			continue
+		default:
+			parts = append(parts, part)
+			continue
+		}
+
+		name := displayPath(path)
+		_, _ = fmt.Fprintf(&sb, "--- file: %s ---\n%s", name, text)
+		if !strings.HasSuffix(text, "\n") {
+			sb.WriteString("\n")
+		}
+		_, _ = fmt.Fprintf(&sb, "--- end of file: %s ---\n\n", name)
+	}
+
+	if sb.Len() == 0 {
+		return parts, nil
+	}
+
+	bundle := genai.Text("Following files are attached:\n\n" + strings.TrimRight(sb.String(), "\n"))
+	return append([]genai.Part{bundle}, parts...), nil
+}
+
+// displayPath returns path relative to the working directory when it is
+// below it.
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// formatSize formats n bytes using binary units.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
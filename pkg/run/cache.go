@@ -0,0 +1,323 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/iterator"
+)
+
+// cachedContentPrefix is the prefix of names of cached contents, which can
+// be omitted on command line.
+const cachedContentPrefix = "cachedContents/"
+
+func CacheCreate(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	_ = viper.BindPFlag(flags.Model, cmd.Flag(flags.Model))
+	_ = viper.BindPFlag(flags.File, cmd.Flag(flags.File))
+	_ = viper.BindPFlag(flags.Format, cmd.Flag(flags.Format))
+	_ = viper.BindPFlag(flags.DisplayName, cmd.Flag(flags.DisplayName))
+
+	pFlags := getPersistentFlags(cmd)
+
+	modelName := viper.GetString(flags.Model)
+	files := viper.GetStringSlice(flags.File)
+	formats := viper.GetStringSlice(flags.Format)
+	displayName := viper.GetString(flags.DisplayName)
+
+	if len(pFlags.ApiKey) == 0 || len(modelName) == 0 {
+		return fmt.Errorf("api-key or model cannot be empty")
+	}
+
+	system, err := getSystemInstruction(cmd)
+	if err != nil {
+		return err
+	}
+
+	expiration, err := getExpiration(cmd)
+	if err != nil {
+		return err
+	}
+
+	formats, err = detectFormats(files, formats, modelName)
+	if err != nil {
+		return err
+	}
+
+	var parts []genai.Part
+	if text := strings.TrimSpace(strings.Join(args, " ")); len(text) > 0 {
+		parts = append(parts, genai.Text(text))
+	}
+
+	if len(parts) == 0 && len(files) == 0 {
+		return fmt.Errorf("please provide text or files to cache")
+	}
+
+	client, err := connect(ctx, cmd, pFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// uploaded files are not deleted since cached content refers to them,
+	// they expire on their own after two days
+	for i, file := range files {
+		part, _, err := attachFile(ctx, client, file, formats[i], flags.MaxBlobBufferSizeBytes, cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+		parts = append(parts, part)
+	}
+
+	cc, err := client.CreateCachedContent(ctx, &genai.CachedContent{
+		Model:             modelName,
+		DisplayName:       displayName,
+		SystemInstruction: systemContent(system),
+		Contents:          []*genai.Content{genai.NewUserContent(parts...)},
+		Expiration:        expiration,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create cached content: %w", err)
+	}
+
+	if _, err := fmt.Fprintln(cmd.OutOrStdout(), cc.Name); err != nil {
+		return fmt.Errorf("failed to write to output: %w", err)
+	}
+
+	return nil
+}
+
+func CacheList(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	pFlags := getPersistentFlags(cmd)
+	if len(pFlags.ApiKey) == 0 {
+		return fmt.Errorf("api-key cannot be empty")
+	}
+
+	client, err := connect(ctx, cmd, pFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NAME\tEXPIRES\tTOKENS\tMODEL\tDISPLAY NAME")
+
+	it := client.ListCachedContents(ctx)
+	for {
+		cc, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to iterate over cached contents: %w", err)
+		}
+
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n",
+			cc.Name,
+			cc.Expiration.ExpireTime.Local().Format(time.DateTime),
+			cachedTokens(cc),
+			strings.TrimPrefix(cc.Model, "models/"),
+			cc.DisplayName,
+		)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write to output: %w", err)
+	}
+
+	return nil
+}
+
+func CacheGet(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	pFlags := getPersistentFlags(cmd)
+	if len(pFlags.ApiKey) == 0 {
+		return fmt.Errorf("api-key cannot be empty")
+	}
+
+	client, err := connect(ctx, cmd, pFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	cc, err := client.GetCachedContent(ctx, cachedContentName(args[0]))
+	if err != nil {
+		return fmt.Errorf("failed to get cached content: %w", err)
+	}
+
+	return printCachedContent(cmd, cc)
+}
+
+func CacheUpdate(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	pFlags := getPersistentFlags(cmd)
+	if len(pFlags.ApiKey) == 0 {
+		return fmt.Errorf("api-key cannot be empty")
+	}
+
+	if !cmd.Flags().Changed(flags.TTL) && !cmd.Flags().Changed(flags.ExpireTime) {
+		return fmt.Errorf("please provide either --%s or --%s", flags.TTL, flags.ExpireTime)
+	}
+
+	expiration, err := getExpiration(cmd)
+	if err != nil {
+		return err
+	}
+
+	client, err := connect(ctx, cmd, pFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	cc, err := client.UpdateCachedContent(ctx,
+		&genai.CachedContent{Name: cachedContentName(args[0])},
+		&genai.CachedContentToUpdate{Expiration: &expiration},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update cached content: %w", err)
+	}
+
+	return printCachedContent(cmd, cc)
+}
+
+func CacheDelete(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	pFlags := getPersistentFlags(cmd)
+	if len(pFlags.ApiKey) == 0 {
+		return fmt.Errorf("api-key cannot be empty")
+	}
+
+	client, err := connect(ctx, cmd, pFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for _, arg := range args {
+		name := cachedContentName(arg)
+		if err := client.DeleteCachedContent(ctx, name); err != nil {
+			return fmt.Errorf("failed to delete cached content %s: %w", name, err)
+		}
+
+		if _, err := fmt.Fprintf(cmd.OutOrStdout(), "deleted %s\n", name); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// useCachedContent configures model to use the cached content with given
+// name. The model of the cached content takes precedence over the one on
+// command line since they need to match.
+func useCachedContent(ctx context.Context, cmd *cobra.Command, client backend.Backend, model *backend.Model, name string) error {
+	// system instruction and tools can only be set when creating the cache,
+	// hence a system instruction of the config file is left out
+	if cmd.Flags().Changed(flags.System) || cmd.Flags().Changed(flags.SystemFile) {
+		return fmt.Errorf("system instruction cannot be used with cached content, include it in the cache instead")
+	}
+	model.SystemInstruction = nil
+	if len(model.Tools) > 0 {
+		return fmt.Errorf("tools cannot be used with cached content")
+	}
+
+	cc, err := client.GetCachedContent(ctx, cachedContentName(name))
+	if err != nil {
+		return fmt.Errorf("failed to get cached content: %w", err)
+	}
+
+	model.Name = cc.Model
+	model.CachedContent = cc.Name
+
+	return nil
+}
+
+// getExpiration returns expiration of cached content from either the
+// TTL or the expire time flag.
+func getExpiration(cmd *cobra.Command) (genai.ExpireTimeOrTTL, error) {
+	ttl, _ := cmd.Flags().GetDuration(flags.TTL)
+	expireTime, _ := cmd.Flags().GetString(flags.ExpireTime)
+
+	if cmd.Flags().Changed(flags.TTL) && cmd.Flags().Changed(flags.ExpireTime) {
+		return genai.ExpireTimeOrTTL{}, fmt.Errorf("please use either --%s or --%s, not both", flags.TTL, flags.ExpireTime)
+	}
+
+	if len(expireTime) > 0 {
+		t, err := time.Parse(time.RFC3339, expireTime)
+		if err != nil {
+			return genai.ExpireTimeOrTTL{}, fmt.Errorf("invalid expire time, expected RFC3339 format: %w", err)
+		}
+		if !t.After(time.Now()) {
+			return genai.ExpireTimeOrTTL{}, fmt.Errorf("expire time needs to be in the future")
+		}
+		return genai.ExpireTimeOrTTL{ExpireTime: t}, nil
+	}
+
+	if ttl < 0 {
+		return genai.ExpireTimeOrTTL{}, fmt.Errorf("ttl cannot be negative")
+	}
+
+	return genai.ExpireTimeOrTTL{TTL: ttl}, nil
+}
+
+func cachedContentName(name string) string {
+	if strings.HasPrefix(name, cachedContentPrefix) {
+		return name
+	}
+
+	return cachedContentPrefix + name
+}
+
+func cachedTokens(cc *genai.CachedContent) int32 {
+	if cc.UsageMetadata == nil {
+		return 0
+	}
+
+	return cc.UsageMetadata.TotalTokenCount
+}
+
+func printCachedContent(cmd *cobra.Command, cc *genai.CachedContent) error {
+	if _, err := fmt.Fprintf(cmd.OutOrStdout(),
+		"name: %s\ndisplay name: %s\nmodel: %s\ntokens: %d\ncreated: %s\nupdated: %s\nexpires: %s\n",
+		cc.Name,
+		cc.DisplayName,
+		cc.Model,
+		cachedTokens(cc),
+		cc.CreateTime.Local().Format(time.DateTime),
+		cc.UpdateTime.Local().Format(time.DateTime),
+		cc.Expiration.ExpireTime.Local().Format(time.DateTime),
+	); err != nil {
+		return fmt.Errorf("failed to write to output: %w", err)
+	}
+
+	return nil
+}
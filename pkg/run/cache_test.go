@@ -0,0 +1,141 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/spf13/viper"
+)
+
+func TestCache(t *testing.T) {
+	fake := backend.NewFake()
+
+	file := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(file, []byte("%PDF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	root, out := newTestCommand(t, CacheCreate, fake, "",
+		"--model", "gemini-1.5-flash-001", "--file", file, "--ttl", "2h",
+		"--display-name", "report", "--system", "be brief", "summarize", "this")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "cachedContents/fake-1\n" {
+		t.Fatalf("create printed %q", got)
+	}
+
+	cc := fake.CachedContents["cachedContents/fake-1"]
+	if cc == nil {
+		t.Fatal("cached content was not created")
+	}
+	if cc.Model != "models/gemini-1.5-flash-001" || cc.DisplayName != "report" {
+		t.Errorf("got model %q and display name %q", cc.Model, cc.DisplayName)
+	}
+	if cc.SystemInstruction == nil || cc.SystemInstruction.Parts[0] != genai.Text("be brief") {
+		t.Errorf("got system instruction %v", cc.SystemInstruction)
+	}
+	if parts := cc.Contents[0].Parts; len(parts) != 2 || parts[0] != genai.Text("summarize this") {
+		t.Errorf("got contents %v", parts)
+	} else if _, ok := parts[1].(genai.Blob); !ok {
+		t.Errorf("got %T, want small file inline", parts[1])
+	}
+	if d := time.Until(cc.Expiration.ExpireTime); d < time.Hour || d > 2*time.Hour {
+		t.Errorf("got expiration in %s", d)
+	}
+
+	root, out = newTestCommand(t, CacheList, fake, "")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "cachedContents/fake-1") || !strings.Contains(out.String(), "report") {
+		t.Errorf("list output:\n%s", out.String())
+	}
+
+	expire := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+	root, out = newTestCommand(t, CacheUpdate, fake, "", "fake-1", "--expire-time", expire.Format(time.RFC3339))
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.CachedContents["cachedContents/fake-1"].Expiration.ExpireTime; !got.Equal(expire) {
+		t.Errorf("got expire time %s, want %s", got, expire)
+	}
+
+	root, out = newTestCommand(t, CacheGet, fake, "", "fake-1")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "model: models/gemini-1.5-flash-001") {
+		t.Errorf("get output:\n%s", out.String())
+	}
+
+	root, _ = newTestCommand(t, CacheDelete, fake, "", "cachedContents/fake-1")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.CachedContents) != 0 {
+		t.Errorf("cached content was not deleted")
+	}
+}
+
+func TestCacheExpirationFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags []string
+	}{
+		{name: "both ttl and expire time", flags: []string{"--ttl", "1h", "--expire-time", "2030-01-01T00:00:00Z"}},
+		{name: "invalid expire time", flags: []string{"--expire-time", "tomorrow"}},
+		{name: "past expire time", flags: []string{"--expire-time", "2000-01-01T00:00:00Z"}},
+		{name: "no expiration", flags: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, _ := newTestCommand(t, CacheUpdate, backend.NewFake(), "", append([]string{"fake-1"}, tt.flags...)...)
+			if err := root.Execute(); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestAskCachedContent(t *testing.T) {
+	fake := backend.NewFake(backend.TextResponse("short summary"), backend.TextResponse("brief summary"))
+	fake.CachedContents = map[string]*genai.CachedContent{
+		"cachedContents/abc": {Name: "cachedContents/abc", Model: "models/gemini-1.5-flash-001"},
+	}
+
+	root, out := newTestCommand(t, Ask, fake, "", "--cached-content", "abc", "summarize")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "short summary\n" {
+		t.Errorf("got output %q", out.String())
+	}
+
+	model := fake.Requests[0].Model
+	if model.CachedContent != "cachedContents/abc" || model.Name != "models/gemini-1.5-flash-001" {
+		t.Errorf("got model %q with cached content %q", model.Name, model.CachedContent)
+	}
+
+	root, _ = newTestCommand(t, Ask, fake, "", "--cached-content", "abc", "--system", "be brief", "summarize")
+	if err := root.Execute(); err == nil {
+		t.Error("expected an error using system instruction with cached content")
+	}
+
+	// a system instruction of the config file is left out
+	root, _ = newTestCommand(t, Ask, fake, "", "--cached-content", "abc", "summarize")
+	viper.Set(flags.System, "be brief")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if si := fake.Requests[len(fake.Requests)-1].Model.SystemInstruction; si != nil {
+		t.Errorf("got system instruction %v with cached content", si)
+	}
+}
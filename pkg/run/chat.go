@@ -2,176 +2,330 @@ package run
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/google/generative-ai-go/genai"
-	"github.com/google/uuid"
+	"github.com/kubetrail/gini/pkg/backend"
 	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/index"
+	"github.com/kubetrail/gini/pkg/lineedit"
+	"github.com/kubetrail/gini/pkg/session"
+	"github.com/kubetrail/gini/pkg/tools"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"google.golang.org/api/option"
 )
 
+// maxToolRounds limits consecutive rounds of function calls in a turn so
+// that a model repeatedly calling tools cannot loop forever.
+const maxToolRounds = 10
+
+// maxContinuations limits turns sent in a row to continue responses cut
+// off by the token limit.
+const maxContinuations = 5
+
+// notifyInterrupt relays interrupts, that is Ctrl-C, to c until the
+// returned function is called. It is a variable so that tests can
+// interrupt chats.
+var notifyInterrupt = func(c chan<- os.Signal) func() {
+	signal.Notify(c, os.Interrupt)
+	return func() { signal.Stop(c) }
+}
+
+// continuePrompt asks the model to carry on with a response that was cut
+// off.
+const continuePrompt = "continue"
+
+// chat holds the state of an interactive chat session.
+type chat struct {
+	ctx         context.Context
+	cmd         *cobra.Command
+	pFlags      persistentFlagValues
+	client      backend.Backend
+	model       *backend.Model
+	cs          backend.ChatSession
+	sess        *session.Session
+	sessionFile string
+	saveSession bool
+	// fileWriter writes chat history to historyFile named historyName,
+	// nil when history is not saved
+	fileWriter  *bufio.Writer
+	historyFile *os.File
+	historyName string
+	stream      bool
+	usage       bool
+	keepUploads bool
+	scanner     *bufio.Scanner
+	// editor reads prompts typed at a terminal, nil when input is read
+	// line by line using scanner
+	editor *lineedit.Editor
+	// registry holds tools the model can call, nil when tools are disabled
+	registry *tools.Registry
+	// index is searched for context of every prompt, nil when not used
+	index     *index.Index
+	indexTopK int
+	// attached lists paths of session files sent along with every prompt
+	attached []string
+	// uploaded lists names of files uploaded during this chat
+	uploaded []string
+	// inline holds content of inline session files by path
+	inline map[string]genai.Part
+	// outputDir is where images and other files the model responds with
+	// are saved
+	outputDir string
+	// autoContinue continues responses cut off by the token limit
+	autoContinue bool
+	// interrupted receives interrupts arriving while there is no request
+	// in flight, that is, while waiting for a prompt
+	interrupted chan struct{}
+	// input relays lines read by scanner and is closed at the end of input,
+	// leaving scanErr set to the error that ended it, if any
+	input   chan string
+	scanErr error
+	// mu guards cancel, which cancels the request in flight and is nil
+	// when there is none
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
 func Chat(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
-	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	// interrupts cancel requests rather than the whole chat
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM)
 	defer stop()
 
 	pFlags := getPersistentFlags(cmd)
 	_ = viper.BindPFlag(flags.Model, cmd.Flag(flags.Model))
 	_ = viper.BindPFlag(flags.File, cmd.Flag(flags.File))
 	_ = viper.BindPFlag(flags.Format, cmd.Flag(flags.Format))
+	_ = viper.BindPFlag(flags.Stream, cmd.Flag(flags.Stream))
+	_ = viper.BindPFlag(flags.Resume, cmd.Flag(flags.Resume))
+	_ = viper.BindPFlag(flags.Usage, cmd.Flag(flags.Usage))
+	_ = viper.BindPFlag(flags.EnableTools, cmd.Flag(flags.EnableTools))
+	_ = viper.BindPFlag(flags.Index, cmd.Flag(flags.Index))
+	_ = viper.BindPFlag(flags.IndexTopK, cmd.Flag(flags.IndexTopK))
+	_ = viper.BindPFlag(flags.CachedContent, cmd.Flag(flags.CachedContent))
+	_ = viper.BindPFlag(flags.KeepUploads, cmd.Flag(flags.KeepUploads))
+	_ = viper.BindPFlag(flags.FileUri, cmd.Flag(flags.FileUri))
+	_ = viper.BindPFlag(flags.OutputDir, cmd.Flag(flags.OutputDir))
+	_ = viper.BindPFlag(flags.AutoContinue, cmd.Flag(flags.AutoContinue))
+	_ = viper.BindPFlag(flags.SubmitKey, cmd.Flag(flags.SubmitKey))
 
 	modelName := viper.GetString(flags.Model)
 	files := viper.GetStringSlice(flags.File)
 	formats := viper.GetStringSlice(flags.Format)
+	stream := viper.GetBool(flags.Stream)
+	resume := viper.GetString(flags.Resume)
+	usage := viper.GetBool(flags.Usage)
+	enableTools := viper.GetBool(flags.EnableTools)
+	indexName := viper.GetString(flags.Index)
+	indexTopK := viper.GetInt(flags.IndexTopK)
+	cachedContent := viper.GetString(flags.CachedContent)
+	keepUploads := viper.GetBool(flags.KeepUploads)
+	fileURIs := viper.GetStringSlice(flags.FileUri)
+	outputDir := viper.GetString(flags.OutputDir)
+	autoContinue := viper.GetBool(flags.AutoContinue)
+	submitKey := viper.GetString(flags.SubmitKey)
+
+	// a resumed session is always saved back so that further turns are
+	// appended to it
+	saveSession := pFlags.AutoSave || len(resume) > 0
+
+	sess, sessionFile, err := openSession(resume, modelName, saveSession)
+	if err != nil {
+		return err
+	}
+
+	if len(resume) > 0 && !cmd.Flags().Changed(flags.Model) && len(sess.Model) > 0 {
+		modelName = sess.Model
+	}
 
 	if len(pFlags.ApiKey) == 0 || len(modelName) == 0 {
 		return fmt.Errorf("api-key or model cannot be empty")
 	}
+	sess.Model = modelName
 
-	fileName := fmt.Sprintf("history-%s.txt", uuid.New().String())
-	var fileWriter *bufio.Writer
-	if pFlags.AutoSave {
-		f, err := os.Create(fileName)
-		if err != nil {
-			return fmt.Errorf("failed to create history file: %w", err)
-		}
-		defer f.Close()
+	system, err := getSystemInstruction(cmd)
+	if err != nil {
+		return err
+	}
+	// a resumed session keeps its system instruction unless a new one is given
+	if len(resume) > 0 && !cmd.Flags().Changed(flags.System) && !cmd.Flags().Changed(flags.SystemFile) {
+		system = sess.SystemInstruction
+	}
+	sess.SystemInstruction = system
 
-		fileWriter = bufio.NewWriter(f)
+	files, patterns, err := splitPatterns(files, formats)
+	if err != nil {
+		return err
+	}
 
-		if _, err := fileWriter.WriteString(
-			fmt.Sprintf("Command: %s\nTimestamp: %s\n",
-				strings.Join(os.Args, " "),
-				time.Now().String(),
-			),
-		); err != nil {
-			return fmt.Errorf("failed to write to history file: %w", err)
-		}
+	formats, err = detectFormats(files, formats, modelName)
+	if err != nil {
+		return err
 	}
 
-	if formats == nil {
-		formats = make([]string, len(files))
-		for i := range formats {
-			formats[i] = flags.FormatPdf
-		}
-	} else {
-		if len(formats) > len(files) {
-			return fmt.Errorf("cannot provide more formats than number of files")
-		}
-		for i := len(formats); i < len(files); i++ {
-			formats = append(formats, flags.FormatPdf)
-		}
+	editor, err := newEditor(cmd, submitKey)
+	if err != nil {
+		return err
+	}
+	if editor != nil {
+		defer editor.Close()
 	}
 
-	client, err := genai.NewClient(ctx, option.WithAPIKey(pFlags.ApiKey))
+	client, err := connect(ctx, cmd, pFlags)
 	if err != nil {
-		return fmt.Errorf("failed to create new genai client: %w", err)
+		return err
 	}
 	defer client.Close()
 
-	uris := make([]string, len(files))
-	if len(files) > 0 {
-		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "uploading files...")
+	c := &chat{
+		ctx:          ctx,
+		cmd:          cmd,
+		pFlags:       pFlags,
+		client:       client,
+		sess:         sess,
+		sessionFile:  sessionFile,
+		saveSession:  saveSession,
+		stream:       stream,
+		usage:        usage,
+		keepUploads:  keepUploads,
+		outputDir:    outputDir,
+		autoContinue: autoContinue,
+		scanner:      bufio.NewScanner(cmd.InOrStdin()),
+		editor:       editor,
+		interrupted:  make(chan struct{}, 1),
 	}
-	for i, file := range files {
-		f, err := client.UploadFileFromPath(ctx, file, &genai.UploadFileOptions{
-			DisplayName: filepath.Base(file),
-			MIMEType:    formats[i],
-		})
-		if err != nil {
-			return fmt.Errorf("failed to upload file %s: %w", file, err)
+	defer c.deleteUploads()
+
+	if pFlags.AutoSave {
+		if err := c.openHistory(); err != nil {
+			return err
 		}
+		defer func() { _ = c.closeHistory() }()
+	}
 
-		uris[i] = f.URI
+	interrupts := make(chan os.Signal, 1)
+	stopInterrupts := notifyInterrupt(interrupts)
+	defer func() {
+		stopInterrupts()
+		close(interrupts)
+	}()
+	go c.handleInterrupts(interrupts)
 
-		defer func() {
-			err := client.DeleteFile(ctx, f.Name)
-			if err != nil {
-				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "failed to delete file %s...\n", f.Name)
-			}
-		}()
+	// files of a resumed session are uploaded again since its history refers
+	// to them unless their uploads were kept, however, only the ones attached
+	// to the last turn stay attached
+	for i := range sess.Files {
+		if err := c.reuse(&sess.Files[i]); err != nil {
+			return err
+		}
 	}
-	if len(files) > 0 {
-		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "done!\n")
-		defer func() {
-			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "deleting uploaded files...\n")
-		}()
+	if n := len(sess.Turns); n > 0 {
+		c.attached = append(c.attached, sess.Turns[n-1].Files...)
+	} else {
+		for _, file := range sess.Files {
+			c.attached = append(c.attached, file.Path)
+		}
 	}
 
-	model := client.GenerativeModel(modelName)
-	if pFlags.TopP >= 0 {
-		model.SetTopP(pFlags.TopP)
+	for i, file := range files {
+		if err := c.attach(file, formats[i]); err != nil {
+			return err
+		}
 	}
-	if pFlags.TopK >= 0 {
-		model.SetTopK(pFlags.TopK)
+
+	for _, pattern := range patterns {
+		if err := c.attachPattern(pattern); err != nil {
+			return err
+		}
 	}
-	if pFlags.Temperature >= 0 {
-		model.SetTemperature(pFlags.Temperature)
+
+	for _, name := range fileURIs {
+		if err := c.attachRemote(name); err != nil {
+			return err
+		}
 	}
-	if pFlags.CandidateCount >= 0 {
-		model.SetCandidateCount(pFlags.CandidateCount)
+
+	c.model = backend.NewModel(modelName)
+	c.model.GenerationConfig = sess.GenerationConfig
+	c.model.SystemInstruction = systemContent(system)
+	if err := configureModel(c.model, pFlags); err != nil {
+		return err
 	}
-	if pFlags.MaxOutputTokens >= 0 {
-		model.SetMaxOutputTokens(pFlags.MaxOutputTokens)
+	if err := configureResponse(cmd, c.model); err != nil {
+		return err
 	}
-	cs := model.StartChat()
+	sess.GenerationConfig = c.model.GenerationConfig
 
-	sendMessage := func(msg string) (*genai.GenerateContentResponse, error) {
-		parts := make([]genai.Part, len(files)+1)
-		parts[0] = genai.Text(msg)
-		for i, uri := range uris {
-			parts[i+1] = genai.FileData{URI: uri}
+	if len(indexName) > 0 {
+		if indexTopK <= 0 {
+			return fmt.Errorf("number of chunks to retrieve needs to be positive")
 		}
-		res, err := cs.SendMessage(ctx, parts...)
+
+		ix, err := loadIndex(indexName)
 		if err != nil {
-			return nil, fmt.Errorf("failed to send message: %w", err)
+			return err
 		}
-		return res, nil
+		c.index = ix
+		c.indexTopK = indexTopK
 	}
 
-	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "please type prompt below and press enter twice to send it\n")
-	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "see more info: gini chat --help\n")
-	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "hit enter with no prompt to quit\n")
-
-OuterLoop:
-	for i := 0; ; i++ {
-		_, _ = fmt.Fprintf(cmd.OutOrStdout(), fmt.Sprintf("[%d]>>> ", i+1))
+	if enableTools {
+		registry, err := tools.Load(viper.ConfigFileUsed())
+		if err != nil {
+			return err
+		}
+		c.registry = registry
+		c.model.Tools = registry.Tools()
+	}
 
-		scanner := bufio.NewScanner(os.Stdin)
-		var lines []string
-		var hold bool
-	InnerLoop:
-		for {
-			scanner.Scan()
-			line := scanner.Text()
-
-			select {
-			case <-ctx.Done():
-				break InnerLoop
-			default:
-				if len(line) == 0 && !hold {
-					break InnerLoop
-				}
-				if strings.TrimSpace(line) == startHold {
-					hold = true
-					continue InnerLoop
-				}
-				if strings.TrimSpace(line) == endHold && hold {
-					break InnerLoop
-				}
-				lines = append(lines, line)
-			}
+	if len(cachedContent) > 0 {
+		if err := useCachedContent(ctx, cmd, client, c.model, cachedContent); err != nil {
+			return err
 		}
+		sess.Model = c.model.Name
+	}
+
+	if err := c.restart(); err != nil {
+		return err
+	}
+
+	send := "press enter twice"
+	if editor != nil {
+		send = submitHints[submitKey]
+	}
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "please type prompt below and %s to send it\n", send)
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "see more info: gini chat --help or type /help\n")
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "hit enter with no prompt or press Ctrl-C to quit\n")
+	if len(resume) > 0 {
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "resuming session %s with %d turns\n", sess.ID, len(sess.Turns))
+	}
+	if len(c.model.CachedContent) > 0 {
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "using cached content %s\n", c.model.CachedContent)
+	}
+	if c.index != nil {
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "using index %s of %s with %d chunks\n",
+			c.index.Name, c.index.Root, len(c.index.Chunks))
+	}
+	if c.registry != nil {
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "tools enabled: %s\n", strings.Join(c.registry.Names(), ", "))
+	}
 
-		if err := scanner.Err(); err != nil {
+OuterLoop:
+	for {
+		lines, err := c.readPrompt(fmt.Sprintf("[%d]>>> ", len(c.sess.Turns)+1))
+		if err != nil {
 			return fmt.Errorf("error reading input: %w", err)
 		}
 
@@ -183,60 +337,679 @@ OuterLoop:
 		case <-ctx.Done():
 			break OuterLoop
 		default:
-			s := "     >>> sending prompt... please wait"
-			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\r", s)
 			prompt := strings.Join(lines, "\n")
-			res, err := sendMessage(prompt)
-			if err != nil {
+			if name, cmdArgs, ok := parseSlashCommand(prompt); ok {
+				if err := c.runSlashCommand(name, cmdArgs); err != nil {
+					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "/%s: %s\n", name, err)
+				}
+				continue OuterLoop
+			}
+
+			if err := c.send(unescapeSlash(prompt)); err != nil && !errors.Is(err, errCancelled) {
 				return err
 			}
-			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\r", strings.Repeat(" ", len(s)+2))
-
-			if pFlags.AllowHarmProbability != flags.HarmProbabilityUnspecified {
-				var harmProbability genai.HarmProbability
-				switch pFlags.AllowHarmProbability {
-				case flags.HarmProbabilityNegligible:
-					harmProbability = genai.HarmProbabilityNegligible
-				case flags.HarmProbabilityLow:
-					harmProbability = genai.HarmProbabilityLow
-				case flags.HarmProbabilityMedium:
-					harmProbability = genai.HarmProbabilityMedium
-				case flags.HarmProbabilityHigh:
-					harmProbability = genai.HarmProbabilityHigh
-				default:
-					return fmt.Errorf("invalid harm probability:%s", pFlags.AllowHarmProbability)
-				}
+		}
+	}
 
-				if res != nil && res.PromptFeedback != nil {
-					for _, rating := range res.PromptFeedback.SafetyRatings {
-						if rating.Probability > harmProbability {
-							return fmt.Errorf("output harm probability threshold crossed")
-						}
-					}
-				}
+	if c.historyFile != nil {
+		if err := c.closeHistory(); err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintln(cmd.OutOrStdout(), fmt.Sprintf("history saved to %s", c.historyName)); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+
+	if c.saveSession && len(c.sess.Turns) > 0 {
+		if _, err := fmt.Fprintln(cmd.OutOrStdout(), fmt.Sprintf("session saved to %s", c.sessionFile)); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// send sends prompt along with attached files, prints the response and
+// records the turn in session. Responses cut off by the token limit are
+// continued when auto continue is set. An interrupt cancels the request
+// in flight, returning errCancelled, without ending the chat. Blocked and
+// harmful responses are explained and leave the chat going as well.
+func (c *chat) send(prompt string) error {
+	ctx, done := c.request()
+	defer done()
+
+	parts := []genai.Part{genai.Text(prompt)}
+
+	var results []index.Result
+	if c.index != nil {
+		var err error
+		if results, err = c.retrieve(ctx, prompt); err != nil {
+			return c.cancelled(ctx, err)
+		}
+		if len(results) > 0 {
+			parts = append(parts, retrievalContext(results))
+		}
+	}
+
+	attached, err := c.attachedParts()
+	if err != nil {
+		return err
+	}
+	parts = append(parts, attached...)
+
+	if c.fileWriter != nil {
+		if _, err := c.fileWriter.WriteString(fmt.Sprintf("[%d]>>> %s\n", len(c.sess.Turns)+1, prompt)); err != nil {
+			return fmt.Errorf("failed to write to history file: %w", err)
+		}
+	}
+
+	res, err := c.exchange(ctx, parts)
+	if err != nil {
+		return c.failed(ctx, err)
+	}
+	if err := c.finishTurn(prompt, res, results, c.attached); err != nil {
+		return err
+	}
+
+	// responses cut off by the token limit are continued in new turns
+	for n := 0; c.autoContinue && truncated(res); n++ {
+		if n == maxContinuations {
+			c.printf("[continue]>>> stopped after %d continuations\n", maxContinuations)
+			break
+		}
+
+		c.printf("[%d]>>> %s\n", len(c.sess.Turns)+1, continuePrompt)
+		if c.fileWriter != nil {
+			if _, err := c.fileWriter.WriteString(fmt.Sprintf("[%d]>>> %s\n", len(c.sess.Turns)+1, continuePrompt)); err != nil {
+				return fmt.Errorf("failed to write to history file: %w", err)
 			}
+		}
 
-			if pFlags.AutoSave {
-				if _, err := fileWriter.WriteString(fmt.Sprintf("[%d]>>> %s\n", i+1, prompt)); err != nil {
-					return fmt.Errorf("failed to write to history file: %w", err)
-				}
+		if res, err = c.exchange(ctx, []genai.Part{genai.Text(continuePrompt)}); err != nil {
+			return c.failed(ctx, err)
+		}
+		// continuations carry the attached files along for resumed sessions
+		if err := c.finishTurn(continuePrompt, res, nil, c.attached); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exchange sends parts to the chat session and returns the response.
+// Functions called by the model are run and their responses sent back
+// until the model responds with text. Contents added to the history of
+// the chat session are removed again when the request fails or is
+// cancelled so that the next prompt follows the last complete turn.
+func (c *chat) exchange(ctx context.Context, parts []genai.Part) (*genai.GenerateContentResponse, error) {
+	n := len(c.cs.History())
+	res, err := c.sendAndCallTools(ctx, parts)
+	if err != nil {
+		c.cs.SetHistory(c.cs.History()[:n])
+	}
+
+	return res, err
+}
+
+func (c *chat) sendAndCallTools(ctx context.Context, parts []genai.Part) (*genai.GenerateContentResponse, error) {
+	res, err := c.sendParts(ctx, parts)
+	if err != nil {
+		return nil, err
+	}
+
+	for round := 0; c.registry != nil; round++ {
+		calls := tools.FunctionCalls(res)
+		if len(calls) == 0 {
+			break
+		}
+		if round >= maxToolRounds {
+			return nil, fmt.Errorf("model called tools more than %d times in a row", maxToolRounds)
+		}
+
+		c.sess.AddUsage(res.UsageMetadata)
+
+		responses := make([]genai.Part, len(calls))
+		for i, call := range calls {
+			fr, err := c.callTool(ctx, call)
+			if err != nil {
+				return nil, err
 			}
+			responses[i] = fr
+		}
+
+		if res, err = c.sendParts(ctx, responses); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// request returns the context of a request to the model, which is
+// cancelled by an interrupt, along with a function to call once the
+// request is done.
+func (c *chat) request() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(c.ctx)
+
+	c.mu.Lock()
+	c.cancel = cancel
+	c.mu.Unlock()
+
+	return ctx, func() {
+		c.mu.Lock()
+		c.cancel = nil
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+// failed reports a blocked or harmful response as a note, which leaves
+// the chat going without recording the turn, and passes other errors on
+// to cancelled.
+func (c *chat) failed(ctx context.Context, err error) error {
+	reason, ok := blockReason(err)
+	if !ok {
+		return c.cancelled(ctx, err)
+	}
+
+	note := fmt.Sprintf("[finish]>>> %s, the turn was not recorded\n", reason)
+	c.printf("%s", note)
+	if c.fileWriter != nil {
+		if _, err := c.fileWriter.WriteString(note); err != nil {
+			return fmt.Errorf("failed to write to history file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// errCancelled is returned for requests cancelled by an interrupt, which
+// leave the chat going.
+var errCancelled = errors.New("request cancelled")
 
-			if err := printResponse(res, cmd.OutOrStdout(), pFlags.Render, pFlags.AutoSave, fileWriter); err != nil {
-				return fmt.Errorf("failed to write response: %w", err)
+// cancelled reports a request cancelled by an interrupt, returning
+// errCancelled, and returns any other error as is.
+func (c *chat) cancelled(ctx context.Context, err error) error {
+	if ctx.Err() == nil || c.ctx.Err() != nil {
+		return err
+	}
+
+	c.printf("[cancelled]>>> request cancelled, press Ctrl-C again to quit\n")
+	if c.fileWriter != nil {
+		if _, err := c.fileWriter.WriteString("[cancelled]>>>\n"); err != nil {
+			return fmt.Errorf("failed to write to history file: %w", err)
+		}
+	}
+
+	return errCancelled
+}
+
+// handleInterrupts cancels the request in flight on every interrupt or
+// passes it on to interrupted when there is none, that is, while waiting
+// for a prompt.
+func (c *chat) handleInterrupts(interrupts <-chan os.Signal) {
+	for range interrupts {
+		c.mu.Lock()
+		cancel := c.cancel
+		c.mu.Unlock()
+
+		if cancel != nil {
+			cancel()
+			continue
+		}
+
+		select {
+		case c.interrupted <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// readPrompt reads lines of the next prompt shown after prompt. No lines
+// are returned when chat is interrupted at an empty prompt or its context
+// is done while waiting for input.
+func (c *chat) readPrompt(prompt string) ([]string, error) {
+	if c.editor == nil {
+		return c.readLines(prompt)
+	}
+
+	type input struct {
+		lines []string
+		err   error
+	}
+
+	// input cannot be interrupted, hence it is read in the background and
+	// left behind when chat ends
+	read := make(chan input, 1)
+	go func() {
+		// Ctrl-C and Ctrl-D at an empty prompt end chat as an empty
+		// prompt does, since interrupts are read as keys, while Ctrl-C
+		// clears a prompt that is not empty
+		text, err := c.editor.ReadPrompt(prompt)
+		if errors.Is(err, lineedit.ErrInterrupted) || errors.Is(err, io.EOF) {
+			err = nil
+		}
+		var lines []string
+		if len(text) > 0 {
+			lines = strings.Split(text, "\n")
+		}
+		read <- input{lines: lines, err: err}
+	}()
+
+	select {
+	case p := <-read:
+		return p.lines, p.err
+	case <-c.ctx.Done():
+		return nil, nil
+	}
+}
+
+// readLines reads lines of the next prompt shown after prompt using
+// scanner. An interrupt drops lines read so far and starts the prompt
+// over, or ends chat when there are none.
+func (c *chat) readLines(prompt string) ([]string, error) {
+	// input cannot be interrupted, hence it is read in the background and
+	// left behind when chat ends
+	if c.input == nil {
+		c.input = make(chan string)
+		go c.scan()
+	}
+
+	c.printf("%s", prompt)
+
+	var p promptLines
+	for {
+		select {
+		case line, ok := <-c.input:
+			if !ok {
+				return p.lines, c.scanErr
+			}
+			if p.add(line) {
+				return p.lines, nil
+			}
+		case <-c.interrupted:
+			// the prompt is left on the line
+			c.printf("\n")
+			if len(p.lines) == 0 && !p.hold {
+				return nil, nil
 			}
+			p = promptLines{}
+			c.printf("%s", prompt)
+		case <-c.ctx.Done():
+			return nil, nil
 		}
 	}
+}
 
-	if pFlags.AutoSave {
-		if err := fileWriter.Flush(); err != nil {
+// scan relays lines read by scanner to input until input is exhausted.
+func (c *chat) scan() {
+	for c.scanner.Scan() {
+		c.input <- c.scanner.Text()
+	}
+
+	c.scanErr = c.scanner.Err()
+	close(c.input)
+}
+
+// finishTurn prints the response to prompt along with sources retrieved
+// for it and notes on how it ended, and records the turn in session.
+func (c *chat) finishTurn(prompt string, res *genai.GenerateContentResponse, results []index.Result, attached []string) error {
+	w := c.cmd.OutOrStdout()
+
+	if jsonOutput(c.model) {
+		if err := printJSON(res, w, c.model.ResponseSchema, c.fileWriter); err != nil {
+			return err
+		}
+	} else if err := printResponse(res, w, c.pFlags.Render, c.fileWriter != nil, c.fileWriter, c.outputDir); err != nil {
+		return fmt.Errorf("failed to write response: %w", err)
+	}
+
+	if len(results) > 0 {
+		c.printf("[sources]>>> %s\n", sources(results))
+		if c.fileWriter != nil {
+			if _, err := c.fileWriter.WriteString(fmt.Sprintf("[sources]>>> %s\n", sources(results))); err != nil {
+				return fmt.Errorf("failed to write to history file: %w", err)
+			}
+		}
+	}
+
+	if err := printNotes(res, w, c.fileWriter); err != nil {
+		return err
+	}
+
+	c.sess.AddUsage(res.UsageMetadata)
+	if err := c.printUsage(res.UsageMetadata); err != nil {
+		return err
+	}
+	c.sess.AddTurn(session.Turn{
+		Prompt:       prompt,
+		Response:     responseText(res),
+		Files:        append([]string(nil), attached...),
+		FinishReason: finishReason(res),
+		Citations:    citations(res),
+	})
+
+	return c.save()
+}
+
+// sendParts sends parts to the chat session and checks the response
+// for harmful content.
+func (c *chat) sendParts(ctx context.Context, parts []genai.Part) (*genai.GenerateContentResponse, error) {
+	w := c.cmd.OutOrStdout()
+	placeholder := "     >>> sending prompt... please wait"
+
+	var res *genai.GenerateContentResponse
+	var err error
+	if c.stream {
+		res, err = streamResponse(c.cs.SendMessageStream(ctx, parts...), w, placeholder)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// placeholder would corrupt json output piped to other tools
+		quiet := jsonOutput(c.model)
+		if !quiet {
+			_, _ = fmt.Fprintf(w, "%s\r", placeholder)
+		}
+		res, err = c.cs.SendMessage(ctx, parts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send message: %w", explainBlocked(err))
+		}
+		if !quiet {
+			_, _ = fmt.Fprintf(w, "%s\r", strings.Repeat(" ", len(placeholder)+2))
+		}
+	}
+
+	if err := checkHarm(res, c.pFlags.AllowHarmProbability); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// readAnswer reads a single line answering question. Interrupting it
+// gives an empty answer.
+func (c *chat) readAnswer(question string) (string, error) {
+	if c.editor != nil {
+		answer, err := c.editor.ReadLine(question)
+		if errors.Is(err, lineedit.ErrInterrupted) || errors.Is(err, io.EOF) {
+			return "", nil
+		}
+		return answer, err
+	}
+
+	c.printf("%s", question)
+	var answer string
+	if c.scanner.Scan() {
+		answer = c.scanner.Text()
+	}
+
+	return answer, c.scanner.Err()
+}
+
+// callTool asks for confirmation and runs the function called by model.
+// A declined call is reported back to the model instead of being run.
+func (c *chat) callTool(ctx context.Context, call genai.FunctionCall) (genai.FunctionResponse, error) {
+	args, err := json.Marshal(call.Args)
+	if err != nil {
+		return genai.FunctionResponse{}, fmt.Errorf("failed to serialize arguments of tool %s: %w", call.Name, err)
+	}
+
+	c.printf("[tool]>>> %s %s\n", call.Name, args)
+	question := fmt.Sprintf("run tool %s? [y/N] ", call.Name)
+
+	answer, err := c.readAnswer(question)
+	if err != nil {
+		return genai.FunctionResponse{}, fmt.Errorf("error reading input: %w", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	var fr genai.FunctionResponse
+	if answer == "y" || answer == "yes" {
+		fr = c.registry.Call(ctx, call)
+	} else {
+		fr = tools.ErrorResponse(call.Name, fmt.Errorf("user declined to run the tool"))
+	}
+
+	out, err := json.Marshal(fr.Response)
+	if err != nil {
+		return genai.FunctionResponse{}, fmt.Errorf("failed to serialize response of tool %s: %w", call.Name, err)
+	}
+
+	if c.fileWriter != nil {
+		if _, err := c.fileWriter.WriteString(
+			fmt.Sprintf("[tool]>>> %s %s\n[tool response]>>> %s\n", call.Name, args, out),
+		); err != nil {
+			return genai.FunctionResponse{}, fmt.Errorf("failed to write to history file: %w", err)
+		}
+	}
+
+	return fr, nil
+}
+
+// printUsage prints token usage of a response along with session totals
+// when enabled and records them in history file.
+func (c *chat) printUsage(usage *genai.UsageMetadata) error {
+	if usage == nil {
+		return nil
+	}
+
+	footer := fmt.Sprintf("[usage]>>> prompt: %d, candidates: %d, total: %d (session total: %d)\n",
+		usage.PromptTokenCount,
+		usage.CandidatesTokenCount,
+		usage.TotalTokenCount,
+		c.sess.Usage.TotalTokens,
+	)
+
+	if c.usage {
+		c.printf("%s", footer)
+	}
+
+	if c.fileWriter != nil {
+		if _, err := c.fileWriter.WriteString(footer); err != nil {
 			return fmt.Errorf("failed to write to history file: %w", err)
 		}
+	}
 
-		if _, err := fmt.Fprintln(cmd.OutOrStdout(), fmt.Sprintf("history saved to %s", fileName)); err != nil {
-			return fmt.Errorf("failed to write to output: %w", err)
+	return nil
+}
+
+// save writes session to its file when saving is enabled.
+func (c *chat) save() error {
+	if !c.saveSession {
+		return nil
+	}
+
+	return c.sess.Save(c.sessionFile)
+}
+
+// openHistory starts writing chat history to the history file of the
+// session, closing the one written so far, if any.
+func (c *chat) openHistory() error {
+	if err := c.closeHistory(); err != nil {
+		return err
+	}
+
+	name := transcriptPath(c.sessionFile)
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to create history file: %w", err)
+	}
+
+	c.historyFile = f
+	c.historyName = name
+	c.fileWriter = bufio.NewWriter(f)
+
+	if _, err := c.fileWriter.WriteString(
+		fmt.Sprintf("Command: %s\nTimestamp: %s\n",
+			strings.Join(os.Args, " "),
+			time.Now().String(),
+		),
+	); err != nil {
+		return fmt.Errorf("failed to write to history file: %w", err)
+	}
+
+	if len(c.sess.SystemInstruction) > 0 {
+		if _, err := c.fileWriter.WriteString(fmt.Sprintf("[system]>>> %s\n", c.sess.SystemInstruction)); err != nil {
+			return fmt.Errorf("failed to write to history file: %w", err)
 		}
 	}
 
 	return nil
 }
+
+// closeHistory writes out and closes the history file, if any.
+func (c *chat) closeHistory() error {
+	if c.historyFile == nil {
+		return nil
+	}
+
+	err := c.fileWriter.Flush()
+	if closeErr := c.historyFile.Close(); err == nil {
+		err = closeErr
+	}
+	c.historyFile = nil
+	c.fileWriter = nil
+
+	if err != nil {
+		return fmt.Errorf("failed to write to history file: %w", err)
+	}
+
+	return nil
+}
+
+// restart starts a new chat session with current model config and
+// history rebuilt from session turns.
+func (c *chat) restart() error {
+	history, err := c.sess.History(c.filesParts)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild chat history: %w", err)
+	}
+
+	c.cs = c.client.StartChat(c.model)
+	c.cs.SetHistory(history)
+
+	return nil
+}
+
+// attach records a local file in session and attaches it to subsequent
+// prompts. Small files are sent inline and larger ones are uploaded.
+func (c *chat) attach(file, format string) error {
+	// absolute paths allow resuming the session from another directory
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path of file %s: %w", file, err)
+	}
+
+	part, name, err := attachFile(c.ctx, c.client, abs, format, maxChatInlineBytes, c.cmd.OutOrStdout())
+	if err != nil {
+		return err
+	}
+
+	f := session.File{Path: abs, MIMEType: format}
+	switch part := part.(type) {
+	case genai.Blob:
+		f.Inline = true
+		c.addInline(abs, part)
+	case genai.FileData:
+		f.Name, f.URI = name, part.URI
+		c.uploaded = append(c.uploaded, name)
+	}
+	c.sess.AddFile(f)
+	c.addAttached(abs)
+
+	return nil
+}
+
+// attachRemote attaches a file uploaded beforehand, for instance, using
+// gini files upload. It is never deleted by the chat.
+func (c *chat) attachRemote(name string) error {
+	f, err := c.client.GetFile(c.ctx, fileName(name))
+	if err != nil {
+		return fmt.Errorf("failed to get file %s: %w", name, err)
+	}
+
+	c.sess.AddFile(session.File{
+		Path:     f.Name,
+		MIMEType: f.MIMEType,
+		Name:     f.Name,
+		URI:      f.URI,
+		Remote:   true,
+	})
+	c.addAttached(f.Name)
+
+	return nil
+}
+
+// reuse keeps the upload of a session file when it still exists and
+// uploads the file again otherwise. Remote files cannot be uploaded again
+// and inline files are read again.
+func (c *chat) reuse(file *session.File) error {
+	if file.Inline {
+		return c.readInline(file)
+	}
+
+	if len(file.Name) > 0 {
+		f, err := c.client.GetFile(c.ctx, file.Name)
+		if err == nil {
+			f, err = waitForFile(c.ctx, c.client, f, c.cmd.OutOrStdout())
+		}
+		if err == nil {
+			file.URI = f.URI
+			return nil
+		}
+	}
+
+	if file.Remote {
+		return fmt.Errorf("file %s is no longer available, please upload it again", file.Name)
+	}
+
+	return c.upload(file)
+}
+
+// upload uploads file and records its name and URI.
+func (c *chat) upload(file *session.File) error {
+	f, err := uploadFile(c.ctx, c.client, file.Path, file.MIMEType, c.cmd.OutOrStdout())
+	if err != nil {
+		return err
+	}
+
+	file.Name = f.Name
+	file.URI = f.URI
+	c.uploaded = append(c.uploaded, f.Name)
+
+	return nil
+}
+
+// fileURI returns the URI of the session file at path.
+func (c *chat) fileURI(path string) string {
+	for _, file := range c.sess.Files {
+		if file.Path == path {
+			return file.URI
+		}
+	}
+
+	return ""
+}
+
+// deleteUploads deletes files uploaded during this chat unless they are
+// to be kept for later use.
+func (c *chat) deleteUploads() {
+	if len(c.uploaded) == 0 {
+		return
+	}
+
+	if c.keepUploads {
+		_, _ = fmt.Fprintf(c.cmd.OutOrStdout(), "keeping uploaded files: %s\n", strings.Join(c.uploaded, ", "))
+		return
+	}
+
+	_, _ = fmt.Fprintf(c.cmd.OutOrStdout(), "deleting uploaded files...\n")
+	for _, name := range c.uploaded {
+		if err := c.client.DeleteFile(c.ctx, name); err != nil {
+			_, _ = fmt.Fprintf(c.cmd.OutOrStdout(), "failed to delete file %s...\n", name)
+		}
+	}
+}
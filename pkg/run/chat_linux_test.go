@@ -0,0 +1,140 @@
+package run
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+	"golang.org/x/sys/unix"
+)
+
+// terminal is the controlling side of a pseudo terminal collecting all
+// output written to it.
+type terminal struct {
+	master *os.File
+	mu     sync.Mutex
+	out    strings.Builder
+}
+
+// openTerminal returns a pseudo terminal and its device, which is read
+// and written to as a terminal would be by a user.
+func openTerminal(t *testing.T) (*terminal, *os.File) {
+	t.Helper()
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("pseudo terminals are not available: %v", err)
+	}
+	t.Cleanup(func() { _ = master.Close() })
+
+	rc, err := master.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := rc.Control(func(fd uintptr) {
+		if err = unix.IoctlSetPointerInt(int(fd), unix.TIOCSPTLCK, 0); err == nil {
+			n, err = unix.IoctlGetInt(int(fd), unix.TIOCGPTN)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dev, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = dev.Close() })
+
+	term := &terminal{master: master}
+	go func() {
+		b := make([]byte, 1024)
+		for {
+			n, err := master.Read(b)
+			term.mu.Lock()
+			term.out.Write(b[:n])
+			term.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return term, dev
+}
+
+// waitFor waits until s was written to the terminal count times.
+func (term *terminal) waitFor(t *testing.T, s string, count int) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		term.mu.Lock()
+		n := strings.Count(term.out.String(), s)
+		term.mu.Unlock()
+		if n >= count {
+			return
+		}
+	}
+
+	t.Fatalf("terminal output does not show %q %d times", s, count)
+}
+
+func (term *terminal) typeKeys(t *testing.T, keys string) {
+	t.Helper()
+
+	if _, err := term.master.WriteString(keys); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChatInterruptEditor(t *testing.T) {
+	chdir(t, t.TempDir())
+	useTempDataDir(t)
+
+	term, dev := openTerminal(t)
+
+	fake := backend.NewFake(backend.TextResponse("reply"))
+	root, _ := newTestCommand(t, Chat, fake, "", "--submit-key", "enter")
+	root.SetIn(dev)
+	root.SetOut(dev)
+	root.SetErr(dev)
+
+	done := make(chan error, 1)
+	go func() { done <- root.Execute() }()
+
+	// keys are typed once the editor reads them, as marked by bracketed
+	// paste being enabled, and Ctrl-C clears what was typed
+	const reading = "\x1b[?2004h"
+	term.waitFor(t, reading, 1)
+	term.typeKeys(t, "typed text\x03x")
+	term.waitFor(t, ">>> x", 1)
+	term.typeKeys(t, "\r")
+
+	// Ctrl-C at an empty prompt ends chat
+	term.waitFor(t, reading, 2)
+	term.typeKeys(t, "\x03")
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("chat did not end")
+	}
+
+	if len(fake.Requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(fake.Requests))
+	}
+	if got := fake.Requests[0].Contents[0].Parts[0].(genai.Text); got != "x" {
+		t.Fatalf("got prompt %q, want x", got)
+	}
+}
@@ -0,0 +1,861 @@
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/kubetrail/gini/pkg/session"
+	"github.com/spf13/cobra"
+)
+
+func TestChat(t *testing.T) {
+	harmful := backend.TextResponse("harmful")
+	harmful.PromptFeedback = &genai.PromptFeedback{
+		SafetyRatings: []*genai.SafetyRating{
+			{Category: genai.HarmCategoryDangerousContent, Probability: genai.HarmProbabilityHigh},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		input       string
+		flags       []string
+		script      []backend.Reply
+		wantPrompts []string
+		wantOut     []string
+		wantHistory []string
+		wantErr     string
+	}{
+		{
+			name:        "quit on empty prompt",
+			input:       "\n",
+			wantPrompts: nil,
+		},
+		{
+			name:  "single turn",
+			input: "hello\n\n\n",
+			script: []backend.Reply{
+				{Response: backend.TextResponse("hi there")},
+			},
+			wantPrompts: []string{"hello"},
+			wantOut:     []string{"[1]>>> ", "hi there", "[2]>>> "},
+		},
+		{
+			name:  "multiple turns share history",
+			input: "one\n\ntwo\nlines\n\n\n",
+			script: []backend.Reply{
+				{Response: backend.TextResponse("first")},
+				{Response: backend.TextResponse("second")},
+			},
+			wantPrompts: []string{"one", "two\nlines"},
+			wantOut:     []string{"first", "second"},
+		},
+		{
+			name:  "hold mode keeps blank lines",
+			input: "{{\nfunc main() {\n\n}\n}}\n\n",
+			script: []backend.Reply{
+				{Response: backend.TextResponse("looks good")},
+			},
+			wantPrompts: []string{"func main() {\n\n}"},
+			wantOut:     []string{"looks good"},
+		},
+		{
+			name:  "harm threshold crossed",
+			input: "hello\n\n\n",
+			flags: []string{"--auto-save"},
+			script: []backend.Reply{
+				{Response: harmful},
+			},
+			wantPrompts: []string{"hello"},
+			wantOut:     []string{"[finish]>>> prompt harm probability threshold crossed", "history saved to "},
+			wantHistory: []string{"[1]>>> hello\n[finish]>>> prompt harm probability threshold crossed"},
+		},
+		{
+			name:  "harm check disabled",
+			input: "hello\n\n\n",
+			flags: []string{"--allow-harm-probability=unspecified"},
+			script: []backend.Reply{
+				{Response: harmful},
+			},
+			wantPrompts: []string{"hello"},
+			wantOut:     []string{"harmful"},
+		},
+		{
+			name:  "backend failure",
+			input: "hello\n\n",
+			script: []backend.Reply{
+				{Err: errors.New("quota exceeded")},
+			},
+			wantPrompts: []string{"hello"},
+			wantErr:     "quota exceeded",
+		},
+		{
+			name:  "streaming",
+			input: "hello\n\n\n",
+			flags: []string{"--stream"},
+			script: []backend.Reply{
+				{Response: backend.TextResponse("streamed")},
+			},
+			wantPrompts: []string{"hello"},
+			wantOut:     []string{"streamed"},
+		},
+		{
+			name:  "history is written",
+			input: "hello\n\nagain\n\n\n",
+			flags: []string{"--auto-save"},
+			script: []backend.Reply{
+				{Response: backend.TextResponse("hi there")},
+				{Response: backend.TextResponse("hi again")},
+			},
+			wantPrompts: []string{"hello", "again"},
+			wantOut:     []string{"history saved to ", "session saved to "},
+			wantHistory: []string{
+				"[1]>>> hello\n[response]>>>\nhi there\n",
+				"[2]>>> again\n[response]>>>\nhi again\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdir(t, t.TempDir())
+			useTempDataDir(t)
+
+			fake := backend.NewFake()
+			fake.Script = tt.script
+			root, out := newTestCommand(t, Chat, fake, tt.input, tt.flags...)
+
+			err := root.Execute()
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(fake.Requests) != len(tt.wantPrompts) {
+				t.Fatalf("got %d requests, want %d", len(fake.Requests), len(tt.wantPrompts))
+			}
+			for i, req := range fake.Requests {
+				// chat requests carry entire history, i.e. two contents per previous turn
+				if got, want := len(req.Contents), 2*i+1; got != want {
+					t.Fatalf("request %d: got %d contents, want %d", i, got, want)
+				}
+				last := req.Contents[len(req.Contents)-1]
+				if got := last.Parts[0].(genai.Text); string(got) != tt.wantPrompts[i] {
+					t.Fatalf("request %d: got prompt %q, want %q", i, got, tt.wantPrompts[i])
+				}
+			}
+
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Fatalf("output %q does not contain %q", out.String(), want)
+				}
+			}
+
+			if !fake.Closed {
+				t.Fatal("backend was not closed")
+			}
+
+			matches := sessionFiles(t, "*.txt")
+			if len(tt.wantHistory) == 0 {
+				if len(matches) != 0 {
+					t.Fatalf("unexpected history files: %v", matches)
+				}
+				return
+			}
+			if len(matches) != 1 {
+				t.Fatalf("got %d history files, want 1", len(matches))
+			}
+			b, err := os.ReadFile(matches[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.wantHistory {
+				if !strings.Contains(string(b), want) {
+					t.Fatalf("history %q does not contain %q", b, want)
+				}
+			}
+		})
+	}
+}
+
+func TestChatUploadsAndDeletesFiles(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	file := filepath.Join(dir, "doc.pdf")
+	if err := os.WriteFile(file, largePDF(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := backend.NewFake(backend.TextResponse("summary"))
+	root, _ := newTestCommand(t, Chat, fake, "summarize\n\n\n", "--file", file)
+
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.Requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(fake.Requests))
+	}
+	parts := fake.Requests[0].Contents[0].Parts
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(parts))
+	}
+	if _, ok := parts[1].(genai.FileData); !ok {
+		t.Fatalf("got %T, want genai.FileData", parts[1])
+	}
+	if len(fake.Files) != 0 {
+		t.Fatalf("uploaded files were not deleted: %v", fake.Files)
+	}
+}
+
+func TestChatInlinesSmallFiles(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	useTempDataDir(t)
+
+	file := filepath.Join(dir, "doc.pdf")
+	if err := os.WriteFile(file, []byte("%PDF-1.4"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := backend.NewFake(backend.TextResponse("summary"), backend.TextResponse("again"))
+	root, out := newTestCommand(t, Chat, fake, "summarize\n\n\n", "--auto-save", "--file", file)
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	parts := fake.Requests[0].Contents[0].Parts
+	if len(parts) != 2 || !reflect.DeepEqual(parts[1], genai.Blob{MIMEType: "application/pdf", Data: []byte("%PDF-1.4")}) {
+		t.Fatalf("got parts %v", parts)
+	}
+	if len(fake.Files) != 0 || strings.Contains(out.String(), "uploading") {
+		t.Fatalf("small file was uploaded:\n%s", out.String())
+	}
+
+	// resumed session reads the file again
+	matches := sessionFiles(t, "*.json")
+	if len(matches) != 1 {
+		t.Fatalf("got %d session files, want 1", len(matches))
+	}
+	id := strings.TrimSuffix(filepath.Base(matches[0]), ".json")
+	root, _ = newTestCommand(t, Chat, fake, "again\n\n\n", "--resume", id)
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	parts = fake.Requests[1].Contents[len(fake.Requests[1].Contents)-1].Parts
+	if _, ok := parts[len(parts)-1].(genai.Blob); !ok {
+		t.Fatalf("got parts %v, want inline file", parts)
+	}
+}
+
+// largePDF returns content of a PDF file too large to be sent inline in
+// a chat.
+func largePDF() []byte {
+	return append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte(" "), maxChatInlineBytes)...)
+}
+
+func TestChatResume(t *testing.T) {
+	chdir(t, t.TempDir())
+	useTempDataDir(t)
+
+	fake := backend.NewFake(backend.TextResponse("first answer"))
+	root, _ := newTestCommand(t, Chat, fake, "first\n\n\n", "--auto-save", "--temperature", "0.3")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	matches := sessionFiles(t, "*.json")
+	if len(matches) != 1 {
+		t.Fatalf("got %d session files, want 1", len(matches))
+	}
+	id := strings.TrimSuffix(filepath.Base(matches[0]), ".json")
+
+	// resume using an id prefix
+	fake = backend.NewFake(backend.TextResponse("second answer"))
+	root, out := newTestCommand(t, Chat, fake, "second\n\n\n", "--resume", id[:8])
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "[2]>>> ") {
+		t.Fatalf("output %q does not continue turn numbering", out.String())
+	}
+	if len(fake.Requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(fake.Requests))
+	}
+
+	req := fake.Requests[0]
+	if len(req.Contents) != 3 {
+		t.Fatalf("got %d contents, want 3", len(req.Contents))
+	}
+	if got := req.Contents[1].Parts[0].(genai.Text); got != "first answer" {
+		t.Fatalf("got restored response %q", got)
+	}
+	if req.Model.Temperature == nil || *req.Model.Temperature != float32(0.3) {
+		t.Fatalf("generation config was not restored: %v", req.Model.Temperature)
+	}
+
+	// further turns are appended to the same session
+	matches = sessionFiles(t, "*.json")
+	if len(matches) != 1 {
+		t.Fatalf("got %d session files, want 1", len(matches))
+	}
+	b, err := os.ReadFile(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "second answer") {
+		t.Fatalf("session %s does not contain resumed turn", b)
+	}
+}
+
+func TestChatSystemInstruction(t *testing.T) {
+	chdir(t, t.TempDir())
+	useTempDataDir(t)
+
+	if err := os.WriteFile("system.txt", []byte("answer in french\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := backend.NewFake(backend.TextResponse("bonjour"))
+	root, _ := newTestCommand(t, Chat, fake, "hello\n\n\n", "--auto-save", "--system-file", "system.txt")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &genai.Content{Parts: []genai.Part{genai.Text("answer in french")}}
+	if got := fake.Requests[0].Model.SystemInstruction; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got system instruction %v, want %v", got, want)
+	}
+
+	matches := sessionFiles(t, "*.json")
+	if len(matches) != 1 {
+		t.Fatalf("got %d session files, want 1", len(matches))
+	}
+	id := strings.TrimSuffix(filepath.Base(matches[0]), ".json")
+
+	// resumed session keeps its system instruction
+	fake = backend.NewFake(backend.TextResponse("au revoir"))
+	root, _ = newTestCommand(t, Chat, fake, "bye\n\n\n", "--resume", id)
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.Requests[0].Model.SystemInstruction; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got system instruction %v after resume, want %v", got, want)
+	}
+
+	// both flags cannot be given together
+	root, _ = newTestCommand(t, Chat, backend.NewFake(), "\n", "--system", "x", "--system-file", "system.txt")
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "cannot use both") {
+		t.Fatalf("got error %v, want cannot use both", err)
+	}
+}
+
+func TestChatUsage(t *testing.T) {
+	chdir(t, t.TempDir())
+	useTempDataDir(t)
+
+	first := backend.TextResponse("one")
+	first.UsageMetadata = &genai.UsageMetadata{PromptTokenCount: 3, CandidatesTokenCount: 2, TotalTokenCount: 5}
+	second := backend.TextResponse("two")
+	second.UsageMetadata = &genai.UsageMetadata{PromptTokenCount: 8, CandidatesTokenCount: 1, TotalTokenCount: 9}
+
+	fake := backend.NewFake(first, second)
+	root, out := newTestCommand(t, Chat, fake, "a\n\nb\n\n\n", "--usage", "--auto-save")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"[usage]>>> prompt: 3, candidates: 2, total: 5 (session total: 5)",
+		"[usage]>>> prompt: 8, candidates: 1, total: 9 (session total: 14)",
+	}
+	transcripts := sessionFiles(t, "*.txt")
+	if len(transcripts) != 1 {
+		t.Fatalf("got %d transcripts, want 1", len(transcripts))
+	}
+	b, err := os.ReadFile(transcripts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range want {
+		if !strings.Contains(out.String(), w) {
+			t.Fatalf("output %q does not contain %q", out.String(), w)
+		}
+		if !strings.Contains(string(b), w) {
+			t.Fatalf("history %q does not contain %q", b, w)
+		}
+	}
+}
+
+func TestChatSavesImages(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	useTempDataDir(t)
+
+	res := backend.TextResponse("here it is")
+	res.Candidates[0].Content.Parts = append(res.Candidates[0].Content.Parts,
+		genai.Blob{MIMEType: "image/jpeg", Data: []byte("jpeg data")})
+
+	fake := backend.NewFake(res)
+	root, out := newTestCommand(t, Chat, fake, "draw a cat\n\n\n", "--auto-save", "--output-dir", "out")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := filepath.Glob(filepath.Join("out", "image-*.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 {
+		t.Fatalf("got %d images, want 1", len(images))
+	}
+	if strings.Contains(out.String(), "jpeg data") {
+		t.Fatal("image data was printed")
+	}
+
+	ref := "[image saved to " + images[0] + "]"
+	if !strings.Contains(out.String(), ref) {
+		t.Fatalf("output %q does not contain %q", out.String(), ref)
+	}
+	transcripts := sessionFiles(t, "*.txt")
+	if len(transcripts) != 1 {
+		t.Fatalf("got %d transcripts, want 1", len(transcripts))
+	}
+	b, err := os.ReadFile(transcripts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), ref) {
+		t.Fatalf("history %q does not contain %q", b, ref)
+	}
+}
+
+func TestChatAutoContinue(t *testing.T) {
+	truncatedRes := func(text string) *genai.GenerateContentResponse {
+		res := backend.TextResponse(text)
+		res.Candidates[0].FinishReason = genai.FinishReasonMaxTokens
+		return res
+	}
+
+	tests := []struct {
+		name         string
+		responses    []*genai.GenerateContentResponse
+		autoContinue bool
+		wantRequests int
+	}{
+		{
+			name:         "continued until complete",
+			responses:    []*genai.GenerateContentResponse{truncatedRes("one"), truncatedRes("two"), backend.TextResponse("three")},
+			autoContinue: true,
+			wantRequests: 3,
+		},
+		{
+			name:         "not continued without flag",
+			responses:    []*genai.GenerateContentResponse{truncatedRes("one")},
+			wantRequests: 1,
+		},
+		{
+			name: "continued up to limit",
+			responses: []*genai.GenerateContentResponse{
+				truncatedRes("1"), truncatedRes("2"), truncatedRes("3"),
+				truncatedRes("4"), truncatedRes("5"), truncatedRes("6"),
+			},
+			autoContinue: true,
+			wantRequests: maxContinuations + 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			chdir(t, dir)
+			useTempDataDir(t)
+
+			file := filepath.Join(dir, "notes.txt")
+			if err := os.WriteFile(file, []byte("notes\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			args := []string{"--auto-save", "--file", file}
+			if tt.autoContinue {
+				args = append(args, "--auto-continue")
+			}
+			fake := backend.NewFake(tt.responses...)
+			root, out := newTestCommand(t, Chat, fake, "write a story\n\n\n", args...)
+			if err := root.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(fake.Requests) != tt.wantRequests {
+				t.Fatalf("got %d requests, want %d", len(fake.Requests), tt.wantRequests)
+			}
+			if !strings.Contains(out.String(), "[finish]>>> response was cut off at the output token limit") {
+				t.Fatalf("output %q does not explain truncation", out.String())
+			}
+			for _, req := range fake.Requests[1:] {
+				last := req.Contents[len(req.Contents)-1]
+				if got := last.Parts[0].(genai.Text); got != continuePrompt {
+					t.Fatalf("got prompt %q, want %q", got, continuePrompt)
+				}
+			}
+
+			matches := sessionFiles(t, "*.json")
+			if len(matches) != 1 {
+				t.Fatalf("got %d session files, want 1", len(matches))
+			}
+			sess, err := session.Load(matches[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sess.Turns) != tt.wantRequests {
+				t.Fatalf("got %d turns, want %d", len(sess.Turns), tt.wantRequests)
+			}
+			if sess.Turns[0].FinishReason != "max tokens" {
+				t.Fatalf("got finish reason %q, want max tokens", sess.Turns[0].FinishReason)
+			}
+			// resuming reattaches files of the last turn
+			if last := sess.Turns[len(sess.Turns)-1]; len(last.Files) != 1 {
+				t.Fatalf("got files %q in last turn, want the attached file", last.Files)
+			}
+		})
+	}
+}
+
+// interruptChat returns a channel interrupting chats started afterwards.
+func interruptChat(t *testing.T) chan<- os.Signal {
+	t.Helper()
+
+	interrupts := make(chan os.Signal)
+	notifyInterrupt = func(c chan<- os.Signal) func() {
+		done := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case sig := <-interrupts:
+					c <- sig
+				case <-done:
+					return
+				}
+			}
+		}()
+		return func() { close(done) }
+	}
+
+	return interrupts
+}
+
+func TestChatCancelRequest(t *testing.T) {
+	chdir(t, t.TempDir())
+	useTempDataDir(t)
+
+	fake := &backend.Fake{
+		Script:  []backend.Reply{{Wait: true}, {Response: backend.TextResponse("fast answer")}},
+		Waiting: make(chan struct{}),
+	}
+	root, out := newTestCommand(t, Chat, fake, "slow question\n\nfast question\n\n\n", "--auto-save")
+	interrupts := interruptChat(t)
+	go func() {
+		<-fake.Waiting
+		interrupts <- os.Interrupt
+	}()
+
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "[cancelled]>>>") {
+		t.Fatalf("output %q does not report cancellation", out.String())
+	}
+	if len(fake.Requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(fake.Requests))
+	}
+	// the cancelled prompt is no longer part of chat history
+	if n := len(fake.Requests[1].Contents); n != 1 {
+		t.Fatalf("got %d contents in second request, want 1", n)
+	}
+
+	matches := sessionFiles(t, "*.json")
+	if len(matches) != 1 {
+		t.Fatalf("got %d session files, want 1", len(matches))
+	}
+	sess, err := session.Load(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sess.Turns) != 1 || sess.Turns[0].Prompt != "fast question" {
+		t.Fatalf("got turns %+v, want only the fast question", sess.Turns)
+	}
+}
+
+func TestChatCancelRetry(t *testing.T) {
+	chdir(t, t.TempDir())
+	useTempDataDir(t)
+
+	fake := &backend.Fake{
+		Script: []backend.Reply{
+			{Response: backend.TextResponse("first answer")},
+			{Wait: true},
+			{Response: backend.TextResponse("second answer")},
+		},
+		Waiting: make(chan struct{}),
+	}
+	root, out := newTestCommand(t, Chat, fake, "question\n\n/retry\n\nnext\n\n\n")
+	interrupts := interruptChat(t)
+	go func() {
+		<-fake.Waiting
+		interrupts <- os.Interrupt
+	}()
+
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(out.String(), "/retry:") {
+		t.Fatalf("output %q reports cancelled retry as an error", out.String())
+	}
+	if len(fake.Requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(fake.Requests))
+	}
+	// the previous turn is kept when the retry is cancelled
+	var got []string
+	for _, content := range fake.Requests[2].Contents {
+		got = append(got, string(content.Parts[0].(genai.Text)))
+	}
+	if want := []string{"question", "first answer", "next"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got contents %q, want %q", got, want)
+	}
+}
+
+func TestChatBlockedResponse(t *testing.T) {
+	chdir(t, t.TempDir())
+	useTempDataDir(t)
+
+	blocked := &genai.BlockedError{Candidate: &genai.Candidate{FinishReason: genai.FinishReasonSafety}}
+	fake := backend.NewFake()
+	fake.Script = []backend.Reply{{Err: blocked}, {Response: backend.TextResponse("safe answer")}}
+	root, out := newTestCommand(t, Chat, fake, "bad question\n\ngood question\n\n\n")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "[finish]>>> response blocked for safety reasons") {
+		t.Fatalf("output %q does not explain the block", out.String())
+	}
+	if len(fake.Requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(fake.Requests))
+	}
+	// the blocked turn is no longer part of chat history
+	if n := len(fake.Requests[1].Contents); n != 1 {
+		t.Fatalf("got %d contents in second request, want 1", n)
+	}
+}
+
+func TestChatInterruptAtPrompt(t *testing.T) {
+	chdir(t, t.TempDir())
+	useTempDataDir(t)
+
+	// input that never ends, as when typed at a terminal
+	r, w := io.Pipe()
+	defer w.Close()
+
+	fake := backend.NewFake()
+	root, _ := newTestCommand(t, Chat, fake, "")
+	root.SetIn(r)
+	interrupts := interruptChat(t)
+	go func() { interrupts <- os.Interrupt }()
+
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Requests) != 0 {
+		t.Fatalf("got %d requests, want none", len(fake.Requests))
+	}
+}
+
+func TestChatDetectsFormats(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	file := filepath.Join(dir, "photo.png")
+	if err := os.WriteFile(file, []byte("\x89PNG\r\n\x1a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := backend.NewFake(backend.TextResponse("a photo"))
+	root, _ := newTestCommand(t, Chat, fake, "describe\n\n\n", "--file", file)
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(fake.Requests))
+	}
+
+	fake = backend.NewFake()
+	root, _ = newTestCommand(t, Chat, fake, "", "--file", file, "--model", "models/gemini-2.5-flash-preview-tts")
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "does not accept image files") {
+		t.Fatalf("got error %v, want rejected image", err)
+	}
+	if len(fake.Files) != 0 {
+		t.Fatalf("rejected file was uploaded")
+	}
+}
+
+func TestChatAttachDirectory(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	for name, content := range map[string]string{
+		"src/a.go":    "package a\n",
+		"src/b.go":    "package b",
+		"src/big.txt": strings.Repeat("x", maxChatInlineBytes+1),
+		"src/ok.log":  "log\n",
+		".gitignore":  "*.log\n",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := backend.NewFake(backend.TextResponse("two packages"))
+	root, out := newTestCommand(t, Chat, fake, "describe\n\n\n", "--file", "./src/...")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "attached 3 files from ./src/... (64.0 KiB): 2 inline, 1 uploaded, skipped 0 binary and 1 ignored") {
+		t.Errorf("output does not contain summary:\n%s", out.String())
+	}
+
+	parts := fake.Requests[0].Contents[0].Parts
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts, want prompt, inline files and upload", len(parts))
+	}
+	want := "Following files are attached:\n\n" +
+		"--- file: src/a.go ---\npackage a\n--- end of file: src/a.go ---\n\n" +
+		"--- file: src/b.go ---\npackage b\n--- end of file: src/b.go ---"
+	if got := parts[1].(genai.Text); string(got) != want {
+		t.Errorf("got inline files %q, want %q", got, want)
+	}
+	if _, ok := parts[2].(genai.FileData); !ok {
+		t.Errorf("got %T, want large file uploaded", parts[2])
+	}
+}
+
+func TestChatAttachPatternWithFormat(t *testing.T) {
+	chdir(t, t.TempDir())
+
+	root, _ := newTestCommand(t, Chat, backend.NewFake(), "", "--file", "**/*.go", "--format", "text/plain")
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected an error giving format for a pattern")
+	}
+}
+
+func TestChatInvalidSubmitKey(t *testing.T) {
+	chdir(t, t.TempDir())
+	useTempDataDir(t)
+
+	root, _ := newTestCommand(t, Chat, backend.NewFake(), "", "--submit-key", "space")
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "invalid submit-key") {
+		t.Fatalf("got error %v, want invalid submit key", err)
+	}
+}
+
+func TestChatAttachedPartsError(t *testing.T) {
+	fake := backend.NewFake(backend.TextResponse("hi"))
+	c := &chat{
+		ctx:      context.Background(),
+		client:   fake,
+		sess:     session.New("models/gemini-2.0-flash"),
+		attached: []string{"/data/missing.pdf"},
+	}
+	c.cs = fake.StartChat(backend.NewModel(c.sess.Model))
+
+	// the prompt is not sent without the files it goes with
+	if err := c.send("summarize"); err == nil || !strings.Contains(err.Error(), "missing.pdf was not uploaded") {
+		t.Fatalf("got error %v, want missing file error", err)
+	}
+	if len(fake.Requests) != 0 {
+		t.Fatalf("got %d requests, want none", len(fake.Requests))
+	}
+}
+
+func TestChatInterruptTypedPrompt(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	out := &bytes.Buffer{}
+	cmd := &cobra.Command{}
+	cmd.SetOut(out)
+	c := &chat{
+		ctx:         context.Background(),
+		cmd:         cmd,
+		scanner:     bufio.NewScanner(r),
+		interrupted: make(chan struct{}),
+	}
+
+	type result struct {
+		lines []string
+		err   error
+	}
+	read := func() <-chan result {
+		done := make(chan result, 1)
+		go func() {
+			lines, err := c.readPrompt("[1]>>> ")
+			done <- result{lines: lines, err: err}
+		}()
+		return done
+	}
+	write := func(s string) {
+		if _, err := io.WriteString(w, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// writes return once input before them was read, so the interrupt
+	// comes after the first line and before the second one ends
+	done := read()
+	write("typed line\n")
+	write("x")
+	c.interrupted <- struct{}{}
+	write("\n\n")
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if want := []string{"x"}; !reflect.DeepEqual(res.lines, want) {
+		t.Fatalf("got lines %q, want %q", res.lines, want)
+	}
+	if want := "[1]>>> \n[1]>>> "; !strings.Contains(out.String(), want) {
+		t.Fatalf("output %q does not start the prompt over", out.String())
+	}
+
+	// an interrupt at an empty prompt ends chat
+	done = read()
+	c.interrupted <- struct{}{}
+	if res := <-done; res.err != nil || res.lines != nil {
+		t.Fatalf("got lines %q and error %v, want neither", res.lines, res.err)
+	}
+}
@@ -0,0 +1,122 @@
+package run
+
+import (
+	"bufio"
+	"fmt"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func CountTokens(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	_ = viper.BindPFlag(flags.Model, cmd.Flag(flags.Model))
+	_ = viper.BindPFlag(flags.File, cmd.Flag(flags.File))
+	_ = viper.BindPFlag(flags.Format, cmd.Flag(flags.Format))
+
+	pFlags := getPersistentFlags(cmd)
+
+	modelName := viper.GetString(flags.Model)
+	files := viper.GetStringSlice(flags.File)
+	formats := viper.GetStringSlice(flags.Format)
+
+	if len(pFlags.ApiKey) == 0 || len(modelName) == 0 {
+		return fmt.Errorf("api-key or model cannot be empty")
+	}
+
+	system, err := getSystemInstruction(cmd)
+	if err != nil {
+		return err
+	}
+
+	formats, err = detectFormats(files, formats, modelName)
+	if err != nil {
+		return err
+	}
+
+	var prompt string
+	if len(args) > 0 {
+		prompt = strings.Join(args, " ")
+	} else if len(files) == 0 {
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), ">>> ")
+
+		scanner := bufio.NewScanner(cmd.InOrStdin())
+		lines, err := readLines(ctx, scanner)
+		if err != nil {
+			return fmt.Errorf("error reading input: %w", err)
+		}
+
+		prompt = strings.Join(lines, "\n")
+	}
+
+	if len(prompt) == 0 && len(files) == 0 {
+		return fmt.Errorf("prompt or files are required to count tokens")
+	}
+
+	client, err := connect(ctx, cmd, pFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	model := backend.NewModel(modelName)
+	model.SystemInstruction = systemContent(system)
+
+	// each input is counted separately to show what it contributes
+	// followed by a count of all inputs together
+	type input struct {
+		name string
+		part genai.Part
+	}
+	var inputs []input
+	if len(prompt) > 0 {
+		inputs = append(inputs, input{name: "prompt", part: genai.Text(prompt)})
+	}
+
+	for i, file := range files {
+		part, name, err := attachFile(ctx, client, file, formats[i], flags.MaxBlobBufferSizeBytes, cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+		if len(name) > 0 {
+			defer func() { _ = client.DeleteFile(ctx, name) }()
+		}
+
+		inputs = append(inputs, input{name: file, part: part})
+	}
+
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "INPUT\tTOKENS")
+
+	parts := make([]genai.Part, len(inputs))
+	for i, in := range inputs {
+		res, err := client.CountTokens(ctx, backend.NewModel(modelName), in.part)
+		if err != nil {
+			return fmt.Errorf("failed to count tokens of %s: %w", in.name, err)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%d\n", in.name, res.TotalTokens)
+		parts[i] = in.part
+	}
+
+	res, err := client.CountTokens(ctx, model, parts...)
+	if err != nil {
+		return fmt.Errorf("failed to count tokens: %w", err)
+	}
+	_, _ = fmt.Fprintf(tw, "total\t%d\n", res.TotalTokens)
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write to output: %w", err)
+	}
+
+	return nil
+}
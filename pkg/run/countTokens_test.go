@@ -0,0 +1,45 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/kubetrail/gini/pkg/backend"
+)
+
+func TestCountTokens(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "doc.pdf")
+	if err := os.WriteFile(file, []byte("%PDF-1.4"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := backend.NewFake()
+	root, out := newTestCommand(t, CountTokens, fake, "", "--file", file, "--", "how many tokens")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`prompt\s+3\n`,
+		regexp.QuoteMeta(file) + `\s+0\n`,
+		`total\s+3\n`,
+	} {
+		if !regexp.MustCompile(want).MatchString(out.String()) {
+			t.Fatalf("output %q does not match %q", out.String(), want)
+		}
+	}
+
+	if len(fake.Files) != 0 {
+		t.Fatalf("uploaded files were not deleted: %v", fake.Files)
+	}
+}
+
+func TestCountTokensRequiresInput(t *testing.T) {
+	root, _ := newTestCommand(t, CountTokens, backend.NewFake(), "\n")
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected error for empty input")
+	}
+}
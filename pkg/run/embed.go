@@ -0,0 +1,202 @@
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/kubetrail/gini/pkg/embedding"
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// embeddingRecord is a single embedding in json and jsonl output. Input is
+// either the embedded text or the path of the embedded file.
+type embeddingRecord struct {
+	Input  string    `json:"input"`
+	Values []float32 `json:"values"`
+}
+
+func Embed(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	_ = viper.BindPFlag(flags.Model, cmd.Flag(flags.Model))
+	_ = viper.BindPFlag(flags.File, cmd.Flag(flags.File))
+	_ = viper.BindPFlag(flags.TaskType, cmd.Flag(flags.TaskType))
+	_ = viper.BindPFlag(flags.Title, cmd.Flag(flags.Title))
+	_ = viper.BindPFlag(flags.OutputFormat, cmd.Flag(flags.OutputFormat))
+	_ = viper.BindPFlag(flags.Output, cmd.Flag(flags.Output))
+
+	pFlags := getPersistentFlags(cmd)
+
+	modelName := viper.GetString(flags.Model)
+	files := viper.GetStringSlice(flags.File)
+	taskType := viper.GetString(flags.TaskType)
+	title := viper.GetString(flags.Title)
+	outputFormat := viper.GetString(flags.OutputFormat)
+	output := viper.GetString(flags.Output)
+
+	if len(pFlags.ApiKey) == 0 || len(modelName) == 0 {
+		return fmt.Errorf("api-key or model cannot be empty")
+	}
+
+	tt, err := parseTaskType(taskType)
+	if err != nil {
+		return err
+	}
+	if len(title) > 0 && tt != genai.TaskTypeRetrievalDocument {
+		return fmt.Errorf("title can only be used with task type %s", flags.TaskTypeRetrievalDocument)
+	}
+
+	switch outputFormat {
+	case flags.OutputFormatJson, flags.OutputFormatJsonl, flags.OutputFormatBinary:
+	default:
+		return fmt.Errorf("invalid output format: %s", outputFormat)
+	}
+
+	// each positional argument and each file is embedded as a whole,
+	// otherwise every non-blank line of input is embedded separately
+	inputs := append([]string(nil), args...)
+	texts := append([]string(nil), args...)
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		inputs = append(inputs, file)
+		texts = append(texts, string(b))
+	}
+
+	if len(texts) == 0 {
+		scanner := bufio.NewScanner(cmd.InOrStdin())
+		scanner.Buffer(nil, flags.MaxBlobBufferSizeBytes)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); len(line) > 0 {
+				inputs = append(inputs, line)
+				texts = append(texts, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("error reading input: %w", err)
+		}
+	}
+
+	if len(texts) == 0 {
+		return fmt.Errorf("nothing to embed, provide text as arguments, files or input lines")
+	}
+
+	// output file is written only once all vectors are encoded so that
+	// a failed request does not leave a partial file behind
+	var w io.Writer = cmd.OutOrStdout()
+	buf := &bytes.Buffer{}
+	if len(output) > 0 {
+		w = buf
+	} else if outputFormat == flags.OutputFormatBinary && isTerminal(w) {
+		return fmt.Errorf("refusing to write binary output to terminal, use --%s", flags.Output)
+	}
+
+	client, err := connect(ctx, cmd, pFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	vectors, err := client.EmbedContents(ctx, &backend.EmbeddingModel{Name: modelName, TaskType: tt}, title, texts...)
+	if err != nil {
+		return fmt.Errorf("failed to embed contents: %w", err)
+	}
+
+	switch outputFormat {
+	case flags.OutputFormatBinary:
+		if err := embedding.WriteBinary(w, vectors); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	case flags.OutputFormatJsonl:
+		enc := json.NewEncoder(w)
+		for i, v := range vectors {
+			if err := enc.Encode(embeddingRecord{Input: inputs[i], Values: v}); err != nil {
+				return fmt.Errorf("failed to write to output: %w", err)
+			}
+		}
+	default:
+		records := make([]embeddingRecord, len(vectors))
+		for i, v := range vectors {
+			records[i] = embeddingRecord{Input: inputs[i], Values: v}
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(records); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+
+	if len(output) > 0 {
+		return writeOutputFile(output, buf.Bytes())
+	}
+
+	return nil
+}
+
+// writeOutputFile writes b to file name, replacing it atomically.
+func writeOutputFile(name string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0644); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	return nil
+}
+
+// parseTaskType returns the embedding task type for its flag value.
+func parseTaskType(taskType string) (genai.TaskType, error) {
+	switch taskType {
+	case "", flags.TaskTypeUnspecified:
+		return genai.TaskTypeUnspecified, nil
+	case flags.TaskTypeRetrievalQuery:
+		return genai.TaskTypeRetrievalQuery, nil
+	case flags.TaskTypeRetrievalDocument:
+		return genai.TaskTypeRetrievalDocument, nil
+	case flags.TaskTypeSemanticSimilarity:
+		return genai.TaskTypeSemanticSimilarity, nil
+	case flags.TaskTypeClassification:
+		return genai.TaskTypeClassification, nil
+	case flags.TaskTypeClustering:
+		return genai.TaskTypeClustering, nil
+	case flags.TaskTypeQuestionAnswering:
+		return genai.TaskTypeQuestionAnswering, nil
+	case flags.TaskTypeFactVerification:
+		return genai.TaskTypeFactVerification, nil
+	default:
+		return genai.TaskTypeUnspecified, fmt.Errorf("invalid task type: %s", taskType)
+	}
+}
@@ -0,0 +1,157 @@
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/kubetrail/gini/pkg/embedding"
+)
+
+func TestEmbed(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "doc.txt")
+	if err := os.WriteFile(file, []byte("a whole\ndocument"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		flags      []string
+		wantInputs []string
+		wantErr    string
+	}{
+		{
+			name:       "arguments and files",
+			flags:      []string{"--output-format", "json", "--file", file, "first text", "second"},
+			wantInputs: []string{"first text", "second", file},
+		},
+		{
+			name:       "input lines",
+			input:      "one\n\ntwo\n",
+			flags:      []string{"--output-format", "jsonl"},
+			wantInputs: []string{"one", "two"},
+		},
+		{
+			name:    "title needs retrieval document task type",
+			flags:   []string{"--output-format", "json", "--title", "x", "text"},
+			wantErr: "title can only be used",
+		},
+		{
+			name:    "invalid task type",
+			flags:   []string{"--output-format", "json", "--task-type", "nope", "text"},
+			wantErr: "invalid task type",
+		},
+		{
+			name:    "nothing to embed",
+			flags:   []string{"--output-format", "json"},
+			wantErr: "nothing to embed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := backend.NewFake()
+			root, out := newTestCommand(t, Embed, fake, tt.input, tt.flags...)
+
+			err := root.Execute()
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var records []embeddingRecord
+			if strings.HasPrefix(out.String(), "[") {
+				if err := json.Unmarshal(out.Bytes(), &records); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+					var r embeddingRecord
+					if err := json.Unmarshal([]byte(line), &r); err != nil {
+						t.Fatal(err)
+					}
+					records = append(records, r)
+				}
+			}
+
+			if len(records) != len(tt.wantInputs) {
+				t.Fatalf("got %d records, want %d", len(records), len(tt.wantInputs))
+			}
+			for i, r := range records {
+				if r.Input != tt.wantInputs[i] || len(r.Values) != backend.FakeEmbeddingSize {
+					t.Fatalf("got record %d input %q with %d values", i, r.Input, len(r.Values))
+				}
+			}
+		})
+	}
+}
+
+func TestEmbedBinary(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "vectors.bin")
+
+	fake := backend.NewFake()
+	root, _ := newTestCommand(t, Embed, fake, "",
+		"--output-format", "binary", "--output", output, "--task-type", "retrieval_document", "--title", "doc", "a", "b")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors, err := embedding.ReadBinary(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != 2 {
+		t.Fatalf("got %d vectors, want 2", len(vectors))
+	}
+
+	if got := len(fake.Requests[0].Contents); got != 2 {
+		t.Fatalf("got %d contents embedded, want 2", got)
+	}
+}
+
+func TestEmbedOutputOnFailure(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "vectors.json")
+	if err := os.WriteFile(output, []byte("previous"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := backend.NewFake()
+	fake.EmbedErr = errors.New("unavailable")
+	root, _ := newTestCommand(t, Embed, fake, "", "--output-format", "json", "--output", output, "text")
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	b, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "previous" {
+		t.Fatalf("output file was changed to %q", b)
+	}
+
+	// no temporary files are left behind either
+	matches, err := filepath.Glob(output + ".tmp*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Fatalf("temporary files left: %v", matches)
+	}
+}
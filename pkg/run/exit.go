@@ -0,0 +1,30 @@
+package run
+
+import "fmt"
+
+// Exit codes returned by one-shot commands so that scripts can tell
+// failures apart. Usage and other errors exit with 1.
+const (
+	ExitCodeBlocked = 2
+	ExitCodeEmpty   = 3
+	ExitCodeFailed  = 4
+)
+
+// ExitError is an error that sets the exit code of the process.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// exitError wraps err so that the process exits with code.
+func exitError(code int, format string, a ...any) error {
+	return &ExitError{Code: code, Err: fmt.Errorf(format, a...)}
+}
@@ -0,0 +1,282 @@
+package run
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/iterator"
+)
+
+// filePrefix is the prefix of names of uploaded files, which can be
+// omitted on command line.
+const filePrefix = "files/"
+
+func FilesUpload(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	_ = viper.BindPFlag(flags.Format, cmd.Flag(flags.Format))
+
+	pFlags := getPersistentFlags(cmd)
+	formats := viper.GetStringSlice(flags.Format)
+
+	if len(pFlags.ApiKey) == 0 {
+		return fmt.Errorf("api-key cannot be empty")
+	}
+
+	formats, err := detectFormats(args, formats, "")
+	if err != nil {
+		return err
+	}
+
+	client, err := connect(ctx, cmd, pFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for i, file := range args {
+		f, err := uploadFile(ctx, client, file, formats[i], cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintln(cmd.OutOrStdout(), f.Name); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func FilesList(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	pFlags := getPersistentFlags(cmd)
+	if len(pFlags.ApiKey) == 0 {
+		return fmt.Errorf("api-key cannot be empty")
+	}
+
+	client, err := connect(ctx, cmd, pFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NAME\tCREATED\tEXPIRES\tSIZE\tSTATE\tMIME TYPE\tDISPLAY NAME")
+
+	it := client.ListFiles(ctx)
+	for {
+		f, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to iterate over files: %w", err)
+		}
+
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			f.Name,
+			f.CreateTime.Local().Format(time.DateTime),
+			f.ExpirationTime.Local().Format(time.DateTime),
+			f.SizeBytes,
+			fileState(f.State),
+			f.MIMEType,
+			f.DisplayName,
+		)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write to output: %w", err)
+	}
+
+	return nil
+}
+
+func FilesGet(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	pFlags := getPersistentFlags(cmd)
+	if len(pFlags.ApiKey) == 0 {
+		return fmt.Errorf("api-key cannot be empty")
+	}
+
+	client, err := connect(ctx, cmd, pFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	f, err := client.GetFile(ctx, fileName(args[0]))
+	if err != nil {
+		return fmt.Errorf("failed to get file: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(cmd.OutOrStdout(),
+		"name: %s\ndisplay name: %s\nmime type: %s\nsize: %d\nstate: %s\nuri: %s\ncreated: %s\nexpires: %s\n",
+		f.Name,
+		f.DisplayName,
+		f.MIMEType,
+		f.SizeBytes,
+		fileState(f.State),
+		f.URI,
+		f.CreateTime.Local().Format(time.DateTime),
+		f.ExpirationTime.Local().Format(time.DateTime),
+	); err != nil {
+		return fmt.Errorf("failed to write to output: %w", err)
+	}
+
+	return nil
+}
+
+func FilesDelete(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	pFlags := getPersistentFlags(cmd)
+	if len(pFlags.ApiKey) == 0 {
+		return fmt.Errorf("api-key cannot be empty")
+	}
+
+	client, err := connect(ctx, cmd, pFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for _, arg := range args {
+		name := fileName(arg)
+		if err := client.DeleteFile(ctx, name); err != nil {
+			return fmt.Errorf("failed to delete file %s: %w", name, err)
+		}
+
+		if _, err := fmt.Fprintf(cmd.OutOrStdout(), "deleted %s\n", name); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func FilesPrune(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	_ = viper.BindPFlag(flags.OlderThan, cmd.Flag(flags.OlderThan))
+	_ = viper.BindPFlag(flags.All, cmd.Flag(flags.All))
+	_ = viper.BindPFlag(flags.DryRun, cmd.Flag(flags.DryRun))
+	_ = viper.BindPFlag(flags.Yes, cmd.Flag(flags.Yes))
+
+	pFlags := getPersistentFlags(cmd)
+	olderThan := viper.GetDuration(flags.OlderThan)
+	all := viper.GetBool(flags.All)
+	dryRun := viper.GetBool(flags.DryRun)
+	yes := viper.GetBool(flags.Yes)
+
+	if len(pFlags.ApiKey) == 0 {
+		return fmt.Errorf("api-key cannot be empty")
+	}
+	if olderThan < 0 {
+		return fmt.Errorf("age of files to prune cannot be negative")
+	}
+	// pruning every file needs to be asked for
+	olderThanChanged := cmd.Flags().Changed(flags.OlderThan)
+	if all && olderThanChanged {
+		return fmt.Errorf("cannot use both --%s and --%s", flags.All, flags.OlderThan)
+	}
+	if !all && !olderThanChanged {
+		return fmt.Errorf("provide --%s or --%s to delete all files", flags.OlderThan, flags.All)
+	}
+
+	client, err := connect(ctx, cmd, pFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// names are collected first so that deleting does not affect listing
+	var names []string
+	it := client.ListFiles(ctx)
+	for {
+		f, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to iterate over files: %w", err)
+		}
+
+		if time.Since(f.CreateTime) >= olderThan {
+			names = append(names, f.Name)
+		}
+	}
+
+	if dryRun || !yes {
+		for _, name := range names {
+			if _, err := fmt.Fprintf(cmd.OutOrStdout(), "would delete %s\n", name); err != nil {
+				return fmt.Errorf("failed to write to output: %w", err)
+			}
+		}
+	}
+	if dryRun || len(names) == 0 {
+		return nil
+	}
+
+	if !yes {
+		if _, err := fmt.Fprintf(cmd.OutOrStdout(), "delete %d files? [y/N] ", len(names)); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+		scanner := bufio.NewScanner(cmd.InOrStdin())
+		scanner.Scan()
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("error reading input: %w", err)
+		}
+		if answer := strings.ToLower(strings.TrimSpace(scanner.Text())); answer != "y" && answer != "yes" {
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), "no files deleted")
+			return nil
+		}
+	}
+
+	for _, name := range names {
+		if err := client.DeleteFile(ctx, name); err != nil {
+			return fmt.Errorf("failed to delete file %s: %w", name, err)
+		}
+
+		if _, err := fmt.Fprintf(cmd.OutOrStdout(), "deleted %s\n", name); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func fileName(name string) string {
+	if strings.HasPrefix(name, filePrefix) {
+		return name
+	}
+
+	return filePrefix + name
+}
+
+// fileState returns a short lower case name of state.
+func fileState(state genai.FileState) string {
+	return strings.ToLower(strings.TrimPrefix(state.String(), "FileState"))
+}
@@ -0,0 +1,163 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+)
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.pdf", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fake := backend.NewFake()
+	root, out := newTestCommand(t, FilesUpload, fake, "",
+		filepath.Join(dir, "a.pdf"), filepath.Join(dir, "b.txt"), "--format", "application/pdf,text/plain")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	// upload progress is written to stderr, which is captured as well
+	if got := out.String(); !strings.Contains(got, "done!\nfiles/fake-1\n") || !strings.Contains(got, "done!\nfiles/fake-2\n") {
+		t.Fatalf("upload printed %q", got)
+	}
+	if got := fake.Files["files/fake-2"].MIMEType; got != "text/plain" {
+		t.Errorf("got mime type %q", got)
+	}
+
+	root, out = newTestCommand(t, FilesList, fake, "")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "files/fake-1") || !strings.Contains(out.String(), "active") {
+		t.Errorf("list output:\n%s", out.String())
+	}
+
+	root, out = newTestCommand(t, FilesGet, fake, "", "fake-2")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "display name: b.txt") {
+		t.Errorf("get output:\n%s", out.String())
+	}
+
+	root, _ = newTestCommand(t, FilesDelete, fake, "", "fake-1")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Files["files/fake-1"]; ok {
+		t.Error("file was not deleted")
+	}
+}
+
+func TestFilesPrune(t *testing.T) {
+	now := time.Now()
+	fake := backend.NewFake()
+	fake.Files["files/old"] = &genai.File{Name: "files/old", CreateTime: now.Add(-2 * time.Hour)}
+	fake.Files["files/new"] = &genai.File{Name: "files/new", CreateTime: now}
+
+	root, out := newTestCommand(t, FilesPrune, fake, "", "--older-than", "1h", "--dry-run")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "would delete files/old\n" || len(fake.Files) != 2 {
+		t.Fatalf("dry run printed %q and left %d files", out.String(), len(fake.Files))
+	}
+
+	root, out = newTestCommand(t, FilesPrune, fake, "n\n", "--older-than", "1h")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "delete 1 files? [y/N] no files deleted") || len(fake.Files) != 2 {
+		t.Fatalf("declined prune printed %q and left %d files", out.String(), len(fake.Files))
+	}
+
+	root, _ = newTestCommand(t, FilesPrune, fake, "y\n", "--older-than", "1h")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Files["files/new"]; !ok || len(fake.Files) != 1 {
+		t.Fatalf("got files %v, want only files/new", fake.Files)
+	}
+
+	// every file is deleted only when asked for
+	root, _ = newTestCommand(t, FilesPrune, fake, "")
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected an error pruning without --older-than or --all")
+	}
+	root, _ = newTestCommand(t, FilesPrune, fake, "", "--all", "--yes")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Files) != 0 {
+		t.Fatalf("got files %v, want none", fake.Files)
+	}
+}
+
+func TestChatFileURI(t *testing.T) {
+	chdir(t, t.TempDir())
+
+	fake := backend.NewFake(backend.TextResponse("summary"))
+	fake.Files["files/abc"] = &genai.File{
+		Name:     "files/abc",
+		MIMEType: "application/pdf",
+		URI:      "https://fake.invalid/files/abc",
+		State:    genai.FileStateActive,
+	}
+
+	root, _ := newTestCommand(t, Chat, fake, "summarize\n\n\n", "--file-uri", "abc")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	parts := fake.Requests[0].Contents[0].Parts
+	if len(parts) != 2 || parts[1] != (genai.FileData{URI: "https://fake.invalid/files/abc"}) {
+		t.Fatalf("got parts %v", parts)
+	}
+	if _, ok := fake.Files["files/abc"]; !ok {
+		t.Fatal("file uploaded beforehand was deleted")
+	}
+}
+
+func TestChatKeepUploads(t *testing.T) {
+	chdir(t, t.TempDir())
+	useTempDataDir(t)
+
+	file := filepath.Join(t.TempDir(), "doc.pdf")
+	if err := os.WriteFile(file, largePDF(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := backend.NewFake(backend.TextResponse("first answer"), backend.TextResponse("second answer"))
+	root, out := newTestCommand(t, Chat, fake, "first\n\n\n", "--auto-save", "--keep-uploads", "--file", file)
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Files) != 1 {
+		t.Fatalf("got %d files, want upload kept", len(fake.Files))
+	}
+	if !strings.Contains(out.String(), "keeping uploaded files: files/fake-1") {
+		t.Errorf("output does not mention kept files:\n%s", out.String())
+	}
+
+	// resumed session reuses the kept upload
+	matches := sessionFiles(t, "*.json")
+	if len(matches) != 1 {
+		t.Fatalf("got %d session files, want 1", len(matches))
+	}
+	root, _ = newTestCommand(t, Chat, fake, "second\n\n\n", "--resume", matches[0], "--keep-uploads")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Files) != 1 {
+		t.Fatalf("got %d files, want kept upload reused", len(fake.Files))
+	}
+}
@@ -0,0 +1,106 @@
+package run
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// finishReason returns why the first candidate of res ended in words, such
+// as max tokens, or an empty string when it ended normally.
+func finishReason(res *genai.GenerateContentResponse) string {
+	if res == nil || len(res.Candidates) == 0 {
+		return ""
+	}
+
+	switch reason := res.Candidates[0].FinishReason; reason {
+	case genai.FinishReasonUnspecified, genai.FinishReasonStop:
+		return ""
+	default:
+		return humanize(reason, "FinishReason")
+	}
+}
+
+// truncated reports whether the response was cut off by the output
+// token limit.
+func truncated(res *genai.GenerateContentResponse) bool {
+	return len(res.Candidates) > 0 && res.Candidates[0].FinishReason == genai.FinishReasonMaxTokens
+}
+
+// finishNote explains a finish reason returned by finishReason.
+func finishNote(reason string) string {
+	switch reason {
+	case "max tokens":
+		return "response was cut off at the output token limit"
+	case "safety":
+		return "response was stopped for safety reasons"
+	case "recitation":
+		return "response was stopped for reciting training data"
+	default:
+		return fmt.Sprintf("response ended for %s reasons", reason)
+	}
+}
+
+// citations returns sources cited by the first candidate of res, each
+// followed by its license when given.
+func citations(res *genai.GenerateContentResponse) []string {
+	if res == nil || len(res.Candidates) == 0 {
+		return nil
+	}
+
+	return citationSources(res.Candidates[0].CitationMetadata)
+}
+
+func citationSources(metadata *genai.CitationMetadata) []string {
+	if metadata == nil {
+		return nil
+	}
+
+	var sources []string
+	seen := make(map[string]bool)
+	for _, src := range metadata.CitationSources {
+		var source string
+		if src.URI != nil {
+			source = *src.URI
+		}
+		if len(src.License) > 0 {
+			source = strings.TrimSpace(fmt.Sprintf("%s (license: %s)", source, src.License))
+		}
+		if len(source) == 0 || seen[source] {
+			continue
+		}
+		seen[source] = true
+		sources = append(sources, source)
+	}
+
+	return sources
+}
+
+// printNotes prints why the response ended, when it did not end normally,
+// and sources it cites, writing them to history as well when fileWriter
+// is not nil.
+func printNotes(res *genai.GenerateContentResponse, w io.Writer, fileWriter *bufio.Writer) error {
+	var notes []string
+	if reason := finishReason(res); len(reason) > 0 {
+		notes = append(notes, fmt.Sprintf("[finish]>>> %s\n", finishNote(reason)))
+	}
+	for _, source := range citations(res) {
+		notes = append(notes, fmt.Sprintf("[citation]>>> %s\n", source))
+	}
+
+	for _, note := range notes {
+		if _, err := fmt.Fprint(w, note); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+		if fileWriter != nil {
+			if _, err := fileWriter.WriteString(note); err != nil {
+				return fmt.Errorf("failed to write to history file: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
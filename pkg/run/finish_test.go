@@ -0,0 +1,54 @@
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+)
+
+func TestPrintNotes(t *testing.T) {
+	uri := "https://example.com/source"
+	truncatedRes := backend.TextResponse("partial")
+	truncatedRes.Candidates[0].FinishReason = genai.FinishReasonMaxTokens
+	cited := backend.TextResponse("code")
+	cited.Candidates[0].CitationMetadata = &genai.CitationMetadata{
+		CitationSources: []*genai.CitationSource{
+			{URI: &uri, License: "mit"},
+			{URI: &uri, License: "mit"},
+			{},
+		},
+	}
+
+	tests := []struct {
+		name string
+		res  *genai.GenerateContentResponse
+		want string
+	}{
+		{name: "normal", res: backend.TextResponse("done")},
+		{name: "truncated", res: truncatedRes, want: "[finish]>>> response was cut off at the output token limit\n"},
+		{name: "citations", res: cited, want: "[citation]>>> https://example.com/source (license: mit)\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, history bytes.Buffer
+			fileWriter := bufio.NewWriter(&history)
+			if err := printNotes(tt.res, &out, fileWriter); err != nil {
+				t.Fatal(err)
+			}
+			if err := fileWriter.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if out.String() != tt.want {
+				t.Fatalf("got output %q, want %q", out.String(), tt.want)
+			}
+			if history.String() != tt.want {
+				t.Fatalf("got history %q, want %q", history.String(), tt.want)
+			}
+		})
+	}
+}
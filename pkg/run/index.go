@@ -0,0 +1,156 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/index"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func IndexBuild(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	_ = viper.BindPFlag(flags.Model, cmd.Flag(flags.Model))
+	_ = viper.BindPFlag(flags.Name, cmd.Flag(flags.Name))
+	_ = viper.BindPFlag(flags.ChunkSize, cmd.Flag(flags.ChunkSize))
+
+	pFlags := getPersistentFlags(cmd)
+
+	modelName := viper.GetString(flags.Model)
+	name := viper.GetString(flags.Name)
+	chunkSize := viper.GetInt(flags.ChunkSize)
+
+	if len(pFlags.ApiKey) == 0 || len(modelName) == 0 {
+		return fmt.Errorf("api-key or model cannot be empty")
+	}
+	if chunkSize <= 0 {
+		return fmt.Errorf("chunk size needs to be positive")
+	}
+
+	dir, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to resolve path of dir %s: %w", args[0], err)
+	}
+	if len(name) == 0 {
+		name = filepath.Base(dir)
+	}
+
+	store, err := index.NewStore()
+	if err != nil {
+		return err
+	}
+
+	chunks, err := index.Collect(dir, chunkSize)
+	if err != nil {
+		return err
+	}
+	if len(chunks) == 0 {
+		return fmt.Errorf("no text files found in %s", dir)
+	}
+
+	// path is embedded along with the text since it often says what
+	// the chunk is about
+	texts := make([]string, len(chunks))
+	files := make(map[string]struct{})
+	for i, chunk := range chunks {
+		texts[i] = fmt.Sprintf("%s\n%s", chunk.Path, chunk.Text)
+		files[chunk.Path] = struct{}{}
+	}
+
+	client, err := connect(ctx, cmd, pFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "embedding %d chunks of %d files...", len(chunks), len(files))
+	vectors, err := client.EmbedContents(ctx,
+		&backend.EmbeddingModel{Name: modelName, TaskType: genai.TaskTypeRetrievalDocument}, "", texts...)
+	if err != nil {
+		_, _ = fmt.Fprintln(cmd.OutOrStdout())
+		return fmt.Errorf("failed to embed contents: %w", err)
+	}
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "done!\n")
+
+	ix := &index.Index{
+		Name:       name,
+		Root:       dir,
+		Model:      modelName,
+		ChunkSize:  chunkSize,
+		CreateTime: time.Now(),
+		Chunks:     chunks,
+		Vectors:    vectors,
+	}
+	if err := store.Save(ix); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(cmd.OutOrStdout(), "index %s saved to %s\n", name, store.Path(name)); err != nil {
+		return fmt.Errorf("failed to write to output: %w", err)
+	}
+
+	return nil
+}
+
+// loadIndex loads the index with given name from the index store.
+func loadIndex(name string) (*index.Index, error) {
+	store, err := index.NewStore()
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Load(name)
+}
+
+// retrieve returns the index chunks most relevant to prompt.
+func (c *chat) retrieve(ctx context.Context, prompt string) ([]index.Result, error) {
+	vectors, err := c.client.EmbedContents(ctx,
+		&backend.EmbeddingModel{Name: c.index.Model, TaskType: genai.TaskTypeRetrievalQuery}, "", prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed prompt: %w", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("got %d embeddings for prompt", len(vectors))
+	}
+
+	return c.index.Search(vectors[0], c.indexTopK), nil
+}
+
+// retrievalContext returns the text part carrying retrieved chunks
+// along with instructions to cite their sources.
+func retrievalContext(results []index.Result) genai.Text {
+	var sb strings.Builder
+	sb.WriteString("Use the following excerpts of local files if they are relevant to the prompt above. ")
+	sb.WriteString("Cite the file paths of the excerpts used in the answer.\n")
+	for i, r := range results {
+		_, _ = fmt.Fprintf(&sb, "\n[%d] %s\n%s\n", i+1, source(r.Chunk), r.Text)
+	}
+
+	return genai.Text(sb.String())
+}
+
+// sources returns a comma separated list of sources of results.
+func sources(results []index.Result) string {
+	s := make([]string, len(results))
+	for i, r := range results {
+		s[i] = source(r.Chunk)
+	}
+
+	return strings.Join(s, ", ")
+}
+
+func source(chunk index.Chunk) string {
+	return fmt.Sprintf("%s:%d-%d", chunk.Path, chunk.StartLine, chunk.EndLine)
+}
@@ -0,0 +1,72 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+)
+
+func TestIndexBuildAndChat(t *testing.T) {
+	useTempDataDir(t)
+
+	dir := filepath.Join(t.TempDir(), "runbooks")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"database.md": "restart the database with systemctl restart postgres",
+		"network.md":  "check firewall rules when packets drop",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fake := backend.NewFake()
+	root, out := newTestCommand(t, IndexBuild, fake, "", dir)
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "index runbooks saved to") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	if got := len(fake.Requests[0].Contents); got != 2 {
+		t.Fatalf("got %d chunks embedded, want 2", got)
+	}
+
+	fake = backend.NewFake(backend.TextResponse("run systemctl restart postgres (database.md)"))
+	root, out = newTestCommand(t, Chat, fake, "how do I restart the database\n\n\n",
+		"--index", "runbooks", "--index-top-k", "1")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// first request embeds the prompt, second one sends it
+	if len(fake.Requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(fake.Requests))
+	}
+	parts := fake.Requests[1].Contents[0].Parts
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(parts))
+	}
+	context := string(parts[1].(genai.Text))
+	if !strings.Contains(context, "database.md:1-1") || strings.Contains(context, "network.md") {
+		t.Fatalf("unexpected context %q", context)
+	}
+	if !strings.Contains(out.String(), "[sources]>>> database.md:1-1") {
+		t.Fatalf("output %q does not cite sources", out.String())
+	}
+}
+
+func TestChatMissingIndex(t *testing.T) {
+	useTempDataDir(t)
+
+	root, _ := newTestCommand(t, Chat, backend.NewFake(), "\n", "--index", "missing")
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "index missing not found") {
+		t.Fatalf("got error %v, want index not found", err)
+	}
+}
@@ -6,12 +6,8 @@ import (
 	"os/signal"
 	"syscall"
 
-	"github.com/google/generative-ai-go/genai"
-	"github.com/kubetrail/gini/pkg/flags"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"google.golang.org/api/iterator"
-	"google.golang.org/api/option"
 	"gopkg.in/yaml.v3"
 )
 
@@ -20,18 +16,15 @@ func ListModels(cmd *cobra.Command, args []string) error {
 	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	_ = viper.BindPFlag(flags.ApiKey, cmd.Flag(flags.ApiKey))
-	_ = viper.BindEnv(flags.ApiKey, flags.ApiKeyEnv)
+	pFlags := getPersistentFlags(cmd)
 
-	apiKey := viper.GetString(flags.ApiKey)
-
-	if len(apiKey) == 0 {
+	if len(pFlags.ApiKey) == 0 {
 		return fmt.Errorf("api-key cannot be empty")
 	}
 
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	client, err := connect(ctx, cmd, pFlags)
 	if err != nil {
-		return fmt.Errorf("failed to create new genai client: %w", err)
+		return err
 	}
 	defer client.Close()
 
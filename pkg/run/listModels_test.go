@@ -0,0 +1,32 @@
+package run
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+)
+
+func TestListModels(t *testing.T) {
+	fake := backend.NewFake()
+	fake.Models = []*genai.ModelInfo{
+		{Name: "models/gemini-2.0-flash", InputTokenLimit: 1048576},
+		{Name: "models/text-embedding-004", InputTokenLimit: 2048},
+	}
+	root, out := newTestCommand(t, ListModels, fake, "")
+
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"name: models/gemini-2.0-flash",
+		"inputtokenlimit: 1048576",
+		"name: models/text-embedding-004",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("output %q does not contain %q", out.String(), want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package run
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/lineedit"
+	"github.com/kubetrail/gini/pkg/session"
+	"github.com/spf13/cobra"
+)
+
+// maxPromptHistory is the number of prompts kept in prompt history.
+const maxPromptHistory = 1000
+
+// promptHistoryFile is the name of the prompt history file, kept next to
+// sessions.
+const promptHistoryFile = "history.jsonl"
+
+// submitKeys maps submit key flag values to keys.
+var submitKeys = map[string]lineedit.SubmitKey{
+	flags.SubmitKeyDoubleEnter: lineedit.SubmitDoubleEnter,
+	flags.SubmitKeyEnter:       lineedit.SubmitEnter,
+	flags.SubmitKeyAltEnter:    lineedit.SubmitAltEnter,
+	flags.SubmitKeyCtrlD:       lineedit.SubmitCtrlD,
+}
+
+// submitHints tell how to send a prompt using each submit key.
+var submitHints = map[string]string{
+	flags.SubmitKeyDoubleEnter: "press enter twice",
+	flags.SubmitKeyEnter:       "press enter",
+	flags.SubmitKeyAltEnter:    "press alt-enter",
+	flags.SubmitKeyCtrlD:       "press Ctrl-D",
+}
+
+// newEditor returns a line editor reading prompts typed at the terminal
+// of cmd, or nil when input is not a terminal or cannot be edited, in which
+// case it is read line by line.
+func newEditor(cmd *cobra.Command, submitKey string) (*lineedit.Editor, error) {
+	submit, ok := submitKeys[submitKey]
+	if !ok {
+		return nil, fmt.Errorf("invalid %s: %s", flags.SubmitKey, submitKey)
+	}
+
+	in, ok := cmd.InOrStdin().(*os.File)
+	if !ok || !isTerminal(in) || !isTerminal(cmd.OutOrStdout()) {
+		return nil, nil
+	}
+
+	dir, err := session.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := lineedit.LoadHistory(filepath.Join(filepath.Dir(dir), promptHistoryFile), maxPromptHistory)
+	if err != nil {
+		return nil, err
+	}
+
+	// terminals that cannot be put in raw mode are read line by line
+	editor, err := lineedit.New(in, cmd.OutOrStdout(), history, submit)
+	if err != nil {
+		return nil, nil
+	}
+
+	return editor, nil
+}
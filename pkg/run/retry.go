@@ -0,0 +1,42 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/spf13/cobra"
+)
+
+// retryInitialDelay is the delay before the first retry of a failing
+// request. It is a variable so that tests need not wait.
+var retryInitialDelay = time.Second
+
+// connect creates the backend of cmd, retrying requests that fail with
+// transient errors as set by persistent flags. Each retry is reported on
+// the error output of cmd.
+func connect(ctx context.Context, cmd *cobra.Command, pFlags persistentFlagValues) (backend.Backend, error) {
+	if pFlags.RetryMaxAttempts < 1 {
+		return nil, fmt.Errorf("invalid %s, must be at least 1: %d", flags.RetryMaxAttempts, pFlags.RetryMaxAttempts)
+	}
+	if pFlags.RetryMaxElapsed < 0 {
+		return nil, fmt.Errorf("invalid %s, cannot be negative: %s", flags.RetryMaxElapsed, pFlags.RetryMaxElapsed)
+	}
+
+	client, err := newBackend(ctx, pFlags.ApiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	w := cmd.ErrOrStderr()
+	return backend.WithRetry(client, backend.RetryPolicy{
+		MaxAttempts:  pFlags.RetryMaxAttempts,
+		MaxElapsed:   pFlags.RetryMaxElapsed,
+		InitialDelay: retryInitialDelay,
+		Notify: func(attempt, maxAttempts int, delay time.Duration, err error) {
+			_, _ = fmt.Fprintf(w, "%v\nretrying (%d/%d) in %s...\n", err, attempt, maxAttempts, delay.Round(time.Millisecond))
+		},
+	}), nil
+}
@@ -0,0 +1,52 @@
+package run
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubetrail/gini/pkg/backend"
+	"google.golang.org/api/googleapi"
+)
+
+func TestChatRetry(t *testing.T) {
+	chdir(t, t.TempDir())
+	useTempDataDir(t)
+
+	orig := retryInitialDelay
+	retryInitialDelay = time.Millisecond
+	t.Cleanup(func() { retryInitialDelay = orig })
+
+	fake := &backend.Fake{Script: []backend.Reply{
+		{Err: &googleapi.Error{Code: http.StatusServiceUnavailable}},
+		{Response: backend.TextResponse("first answer")},
+		{Err: &googleapi.Error{Code: http.StatusBadRequest, Message: "invalid argument"}},
+	}}
+	root, out := newTestCommand(t, Chat, fake, "first\n\nsecond\n\n\n")
+
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "invalid argument") {
+		t.Fatalf("got error %v, want bad request", err)
+	}
+	if !strings.Contains(out.String(), "retrying (2/5)") {
+		t.Fatalf("output %q does not report retry", out.String())
+	}
+	if !strings.Contains(out.String(), "first answer") {
+		t.Fatalf("output %q does not contain answer", out.String())
+	}
+	// bad requests are not retried
+	if len(fake.Requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(fake.Requests))
+	}
+	if n := len(fake.Requests[1].Contents); n != 1 {
+		t.Fatalf("got %d contents in retried request, want 1", n)
+	}
+}
+
+func TestAskInvalidRetryAttempts(t *testing.T) {
+	root, _ := newTestCommand(t, Ask, backend.NewFake(), "", "--retry-max-attempts", "0", "hello")
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "retry-max-attempts") {
+		t.Fatalf("got error %v, want invalid retry attempts", err)
+	}
+}
@@ -0,0 +1,224 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/flags"
+)
+
+// harmBlockThresholds maps block threshold flag values to thresholds.
+var harmBlockThresholds = map[string]genai.HarmBlockThreshold{
+	flags.HarmBlockNone:           genai.HarmBlockNone,
+	flags.HarmBlockOnlyHigh:       genai.HarmBlockOnlyHigh,
+	flags.HarmBlockMediumAndAbove: genai.HarmBlockMediumAndAbove,
+	flags.HarmBlockLowAndAbove:    genai.HarmBlockLowAndAbove,
+}
+
+// harmProbabilities maps allowed harm probability flag values to
+// probabilities.
+var harmProbabilities = map[string]genai.HarmProbability{
+	flags.HarmProbabilityNegligible: genai.HarmProbabilityNegligible,
+	flags.HarmProbabilityLow:        genai.HarmProbabilityLow,
+	flags.HarmProbabilityMedium:     genai.HarmProbabilityMedium,
+	flags.HarmProbabilityHigh:       genai.HarmProbabilityHigh,
+}
+
+// safetySettings returns safety settings of categories whose block
+// threshold is given. Categories left unspecified are not sent so that
+// the default threshold of the model applies.
+func safetySettings(pFlags persistentFlagValues) ([]*genai.SafetySetting, error) {
+	categories := []struct {
+		flag     string
+		value    string
+		category genai.HarmCategory
+	}{
+		{flag: flags.BlockHarassment, value: pFlags.BlockHarassment, category: genai.HarmCategoryHarassment},
+		{flag: flags.BlockHateSpeech, value: pFlags.BlockHateSpeech, category: genai.HarmCategoryHateSpeech},
+		{flag: flags.BlockSexual, value: pFlags.BlockSexual, category: genai.HarmCategorySexuallyExplicit},
+		{flag: flags.BlockDangerous, value: pFlags.BlockDangerous, category: genai.HarmCategoryDangerousContent},
+	}
+
+	var settings []*genai.SafetySetting
+	for _, c := range categories {
+		if len(c.value) == 0 || c.value == flags.HarmBlockUnspecified {
+			continue
+		}
+
+		threshold, ok := harmBlockThresholds[c.value]
+		if !ok {
+			return nil, fmt.Errorf("invalid %s threshold: %s", c.flag, c.value)
+		}
+		settings = append(settings, &genai.SafetySetting{Category: c.category, Threshold: threshold})
+	}
+
+	return settings, nil
+}
+
+// checkHarm returns an error if the prompt or a candidate of res was
+// blocked or if any of their safety ratings crosses the allowed harm
+// probability. The error names the category and probability at fault.
+func checkHarm(res *genai.GenerateContentResponse, allowHarmProbability string) error {
+	harmProbability, ok := harmProbabilities[allowHarmProbability]
+	if !ok && allowHarmProbability != flags.HarmProbabilityUnspecified {
+		return fmt.Errorf("invalid harm probability:%s", allowHarmProbability)
+	}
+	if res == nil {
+		return nil
+	}
+
+	if feedback := res.PromptFeedback; feedback != nil {
+		if feedback.BlockReason != genai.BlockReasonUnspecified {
+			return harmErrorf("prompt blocked for %s reasons%s",
+				humanize(feedback.BlockReason, "BlockReason"), blockedRatings(feedback.SafetyRatings))
+		}
+		if ok {
+			if rating := crossedRating(feedback.SafetyRatings, harmProbability); rating != nil {
+				return harmErrorf("prompt harm probability threshold crossed: %s probability is %s, allowed up to %s",
+					humanize(rating.Category, "HarmCategory"), humanize(rating.Probability, "HarmProbability"), allowHarmProbability)
+			}
+		}
+	}
+
+	for i, cand := range res.Candidates {
+		if cand.FinishReason == genai.FinishReasonSafety {
+			return harmErrorf("response %d blocked for safety reasons%s", i+1, blockedRatings(cand.SafetyRatings))
+		}
+		if ok {
+			if rating := crossedRating(cand.SafetyRatings, harmProbability); rating != nil {
+				return harmErrorf("response %d harm probability threshold crossed: %s probability is %s, allowed up to %s",
+					i+1, humanize(rating.Category, "HarmCategory"), humanize(rating.Probability, "HarmProbability"), allowHarmProbability)
+			}
+		}
+	}
+
+	return nil
+}
+
+// harmError is returned by checkHarm for prompts and responses that were
+// blocked or crossed the allowed harm probability.
+type harmError struct {
+	msg string
+}
+
+func harmErrorf(format string, a ...any) error {
+	return &harmError{msg: fmt.Sprintf(format, a...)}
+}
+
+func (e *harmError) Error() string {
+	return e.msg
+}
+
+// explainBlocked adds the reason and the categories at fault to errors
+// returned by the backend when the prompt or response is blocked. Other
+// errors are returned as they are.
+func explainBlocked(err error) error {
+	var blocked *genai.BlockedError
+	if !errors.As(err, &blocked) {
+		return err
+	}
+
+	msg := blockedMessage(blocked)
+	if len(msg) == 0 {
+		return err
+	}
+
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// blockedMessage returns the reason and the categories at fault of a
+// blocked prompt or response.
+func blockedMessage(blocked *genai.BlockedError) string {
+	switch {
+	case blocked.PromptFeedback != nil:
+		return fmt.Sprintf("prompt blocked for %s reasons%s",
+			humanize(blocked.PromptFeedback.BlockReason, "BlockReason"), blockedRatings(blocked.PromptFeedback.SafetyRatings))
+	case blocked.Candidate != nil:
+		msg := fmt.Sprintf("response blocked for %s reasons%s",
+			humanize(blocked.Candidate.FinishReason, "FinishReason"), blockedRatings(blocked.Candidate.SafetyRatings))
+		if sources := citationSources(blocked.Candidate.CitationMetadata); len(sources) > 0 {
+			msg += fmt.Sprintf(" citing %s", strings.Join(sources, ", "))
+		}
+		return msg
+	default:
+		return ""
+	}
+}
+
+// blockReason returns why a prompt or response was blocked or found
+// harmful when err tells so, as opposed to a failed request.
+func blockReason(err error) (string, bool) {
+	var harm *harmError
+	if errors.As(err, &harm) {
+		return harm.msg, true
+	}
+
+	var blocked *genai.BlockedError
+	if errors.As(err, &blocked) {
+		if msg := blockedMessage(blocked); len(msg) > 0 {
+			return msg, true
+		}
+	}
+
+	return "", false
+}
+
+// crossedRating returns the first rating above probability, if any.
+func crossedRating(ratings []*genai.SafetyRating, probability genai.HarmProbability) *genai.SafetyRating {
+	for _, rating := range ratings {
+		if rating.Probability > probability {
+			return rating
+		}
+	}
+
+	return nil
+}
+
+// blockedRatings describes ratings that caused content to be blocked,
+// falling back to the most probable harm when none is marked as such.
+func blockedRatings(ratings []*genai.SafetyRating) string {
+	var parts []string
+	var highest *genai.SafetyRating
+	for _, rating := range ratings {
+		if rating.Blocked {
+			parts = append(parts, fmt.Sprintf("%s probability is %s",
+				humanize(rating.Category, "HarmCategory"), humanize(rating.Probability, "HarmProbability")))
+		}
+		if highest == nil || rating.Probability > highest.Probability {
+			highest = rating
+		}
+	}
+
+	if len(parts) == 0 {
+		if highest == nil || highest.Probability <= genai.HarmProbabilityNegligible {
+			return ""
+		}
+		parts = append(parts, fmt.Sprintf("%s probability is %s",
+			humanize(highest.Category, "HarmCategory"), humanize(highest.Probability, "HarmProbability")))
+	}
+
+	return ": " + strings.Join(parts, ", ")
+}
+
+// humanize turns names of genai enum values such as
+// HarmCategorySexuallyExplicit into lower case words, sexually explicit,
+// after removing prefix.
+func humanize(v fmt.Stringer, prefix string) string {
+	name := strings.TrimPrefix(v.String(), prefix)
+
+	var sb strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
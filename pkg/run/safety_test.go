@@ -0,0 +1,169 @@
+package run
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/kubetrail/gini/pkg/flags"
+)
+
+func TestSafetySettings(t *testing.T) {
+	got, err := safetySettings(persistentFlagValues{
+		BlockHarassment: flags.HarmBlockNone,
+		BlockHateSpeech: flags.HarmBlockUnspecified,
+		BlockDangerous:  flags.HarmBlockLowAndAbove,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*genai.SafetySetting{
+		{Category: genai.HarmCategoryHarassment, Threshold: genai.HarmBlockNone},
+		{Category: genai.HarmCategoryDangerousContent, Threshold: genai.HarmBlockLowAndAbove},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if _, err := safetySettings(persistentFlagValues{BlockSexual: "bogus"}); err == nil ||
+		!strings.Contains(err.Error(), flags.BlockSexual) {
+		t.Fatalf("got error %v, want invalid threshold error", err)
+	}
+}
+
+func TestChatSafetySettings(t *testing.T) {
+	chdir(t, t.TempDir())
+	useTempDataDir(t)
+
+	fake := backend.NewFake(backend.TextResponse("hi"))
+	root, _ := newTestCommand(t, Chat, fake, "hello\n\n\n", "--block-hate-speech", flags.HarmBlockOnlyHigh)
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*genai.SafetySetting{{Category: genai.HarmCategoryHateSpeech, Threshold: genai.HarmBlockOnlyHigh}}
+	if got := fake.Requests[0].Model.SafetySettings; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got safety settings %v, want %v", got, want)
+	}
+}
+
+func TestCheckHarm(t *testing.T) {
+	rating := func(c genai.HarmCategory, p genai.HarmProbability) []*genai.SafetyRating {
+		return []*genai.SafetyRating{
+			{Category: genai.HarmCategoryHateSpeech, Probability: genai.HarmProbabilityNegligible},
+			{Category: c, Probability: p},
+		}
+	}
+	res := func(p genai.HarmProbability) *genai.GenerateContentResponse {
+		return &genai.GenerateContentResponse{
+			PromptFeedback: &genai.PromptFeedback{
+				SafetyRatings: rating(genai.HarmCategoryHarassment, p),
+			},
+		}
+	}
+	candidate := func(reason genai.FinishReason, p genai.HarmProbability) *genai.GenerateContentResponse {
+		res := backend.TextResponse("ok")
+		res.Candidates[0].FinishReason = reason
+		res.Candidates[0].SafetyRatings = rating(genai.HarmCategoryDangerousContent, p)
+		return res
+	}
+
+	tests := []struct {
+		name    string
+		res     *genai.GenerateContentResponse
+		allow   string
+		wantErr string
+	}{
+		{
+			name:  "no feedback",
+			res:   backend.TextResponse("ok"),
+			allow: flags.HarmProbabilityNegligible,
+		},
+		{
+			name:  "within threshold",
+			res:   res(genai.HarmProbabilityLow),
+			allow: flags.HarmProbabilityLow,
+		},
+		{
+			name:    "above threshold",
+			res:     res(genai.HarmProbabilityMedium),
+			allow:   flags.HarmProbabilityLow,
+			wantErr: "prompt harm probability threshold crossed: harassment probability is medium, allowed up to low",
+		},
+		{
+			name:  "unspecified disables check",
+			res:   res(genai.HarmProbabilityHigh),
+			allow: flags.HarmProbabilityUnspecified,
+		},
+		{
+			name:    "invalid threshold",
+			res:     res(genai.HarmProbabilityLow),
+			allow:   "bogus",
+			wantErr: "invalid harm probability",
+		},
+		{
+			name:    "candidate above threshold",
+			res:     candidate(genai.FinishReasonStop, genai.HarmProbabilityHigh),
+			allow:   flags.HarmProbabilityMedium,
+			wantErr: "response 1 harm probability threshold crossed: dangerous content probability is high, allowed up to medium",
+		},
+		{
+			name:    "candidate blocked",
+			res:     candidate(genai.FinishReasonSafety, genai.HarmProbabilityMedium),
+			allow:   flags.HarmProbabilityUnspecified,
+			wantErr: "response 1 blocked for safety reasons: dangerous content probability is medium",
+		},
+		{
+			name: "prompt blocked",
+			res: &genai.GenerateContentResponse{
+				PromptFeedback: &genai.PromptFeedback{BlockReason: genai.BlockReasonOther},
+			},
+			allow:   flags.HarmProbabilityHigh,
+			wantErr: "prompt blocked for other reasons",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkHarm(tt.res, tt.allow)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("got error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExplainBlocked(t *testing.T) {
+	blocked := &genai.BlockedError{
+		Candidate: &genai.Candidate{
+			FinishReason: genai.FinishReasonSafety,
+			SafetyRatings: []*genai.SafetyRating{
+				{Category: genai.HarmCategorySexuallyExplicit, Probability: genai.HarmProbabilityHigh, Blocked: true},
+				{Category: genai.HarmCategoryHarassment, Probability: genai.HarmProbabilityLow},
+			},
+		},
+	}
+
+	err := explainBlocked(blocked)
+	if want := "response blocked for safety reasons: sexually explicit probability is high"; !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("got error %q, want it to start with %q", err, want)
+	}
+	if !errors.Is(err, blocked) {
+		t.Fatal("blocked error is not wrapped")
+	}
+
+	other := errors.New("unavailable")
+	if err := explainBlocked(other); err != other {
+		t.Fatalf("got error %v, want it unchanged", err)
+	}
+}
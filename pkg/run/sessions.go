@@ -0,0 +1,300 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/session"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const shortIDLen = 8
+
+func SessionsList(cmd *cobra.Command, args []string) error {
+	store, err := session.NewStore()
+	if err != nil {
+		return err
+	}
+	store.Warnings = cmd.ErrOrStderr()
+
+	sessions, err := store.List()
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tUPDATED\tTURNS\tTOKENS\tMODEL\tTITLE")
+	for _, sess := range sessions {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n",
+			shortID(sess.ID),
+			sess.UpdateTime.Local().Format(time.DateTime),
+			len(sess.Turns),
+			sess.Usage.TotalTokens,
+			strings.TrimPrefix(sess.Model, "models/"),
+			sess.Title,
+		)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write to output: %w", err)
+	}
+
+	return nil
+}
+
+func SessionsShow(cmd *cobra.Command, args []string) error {
+	store, err := session.NewStore()
+	if err != nil {
+		return err
+	}
+
+	sess, err := store.Get(args[0])
+	if err != nil {
+		return err
+	}
+
+	w := cmd.OutOrStdout()
+	if _, err := fmt.Fprintf(w,
+		"id: %s\ntitle: %s\nmodel: %s\nsystem: %s\ncreated: %s\nupdated: %s\nturns: %d\n"+
+			"tokens: %d (prompt: %d, candidates: %d)\nfile: %s\n",
+		sess.ID,
+		sess.Title,
+		sess.Model,
+		sess.SystemInstruction,
+		sess.CreateTime.Local().Format(time.DateTime),
+		sess.UpdateTime.Local().Format(time.DateTime),
+		len(sess.Turns),
+		sess.Usage.TotalTokens,
+		sess.Usage.PromptTokens,
+		sess.Usage.CandidatesTokens,
+		store.Path(sess.ID),
+	); err != nil {
+		return fmt.Errorf("failed to write to output: %w", err)
+	}
+
+	for _, file := range sess.Files {
+		if _, err := fmt.Fprintf(w, "attachment: %s (%s)\n", file.Path, file.MIMEType); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+
+	return printTurns(w, sess.Turns)
+}
+
+func SessionsRm(cmd *cobra.Command, args []string) error {
+	store, err := session.NewStore()
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range args {
+		id, err := store.Remove(ref)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(cmd.OutOrStdout(), "removed session %s\n", id); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func SessionsRename(cmd *cobra.Command, args []string) error {
+	store, err := session.NewStore()
+	if err != nil {
+		return err
+	}
+
+	sess, err := store.Get(args[0])
+	if err != nil {
+		return err
+	}
+
+	title := strings.TrimSpace(strings.Join(args[1:], " "))
+	if len(title) == 0 {
+		return fmt.Errorf("title cannot be empty")
+	}
+
+	sess.Title = title
+	if err := store.Save(sess); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(cmd.OutOrStdout(), "renamed session %s to %q\n", sess.ID, title); err != nil {
+		return fmt.Errorf("failed to write to output: %w", err)
+	}
+
+	return nil
+}
+
+func SessionsExport(cmd *cobra.Command, args []string) error {
+	_ = viper.BindPFlag(flags.OutputFormat, cmd.Flag(flags.OutputFormat))
+	_ = viper.BindPFlag(flags.Output, cmd.Flag(flags.Output))
+
+	outputFormat := viper.GetString(flags.OutputFormat)
+	output := viper.GetString(flags.Output)
+
+	store, err := session.NewStore()
+	if err != nil {
+		return err
+	}
+
+	sess, err := store.Get(args[0])
+	if err != nil {
+		return err
+	}
+
+	var b []byte
+	switch outputFormat {
+	case flags.OutputFormatJson:
+		b, err = json.MarshalIndent(sess, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to serialize session: %w", err)
+		}
+		b = append(b, '\n')
+	case flags.RenderFormatMarkdown:
+		b = sessionToMarkdown(sess)
+	case flags.RenderFormatHtml:
+		b = mdToHTML(sessionToMarkdown(sess))
+	case flags.RenderFormatPretty:
+		b = mdToPretty(sessionToMarkdown(sess))
+	default:
+		return fmt.Errorf("invalid output format: %s", outputFormat)
+	}
+
+	var w io.Writer = cmd.OutOrStdout()
+	if len(output) > 0 {
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("failed to write to output: %w", err)
+	}
+
+	return nil
+}
+
+func SessionsSearch(cmd *cobra.Command, args []string) error {
+	query := strings.TrimSpace(strings.Join(args, " "))
+	if len(query) == 0 {
+		return fmt.Errorf("search query cannot be empty")
+	}
+
+	store, err := session.NewStore()
+	if err != nil {
+		return err
+	}
+	store.Warnings = cmd.ErrOrStderr()
+
+	matches, err := store.Search(query)
+	if err != nil {
+		return fmt.Errorf("failed to search sessions: %w", err)
+	}
+
+	for _, match := range matches {
+		where := "title"
+		if match.Turn > 0 {
+			where = fmt.Sprintf("turn %d", match.Turn)
+		}
+
+		if _, err := fmt.Fprintf(cmd.OutOrStdout(), "%s [%s] %s: %s\n",
+			shortID(match.Session.ID), where, match.Session.Title, match.Snippet); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// printTurns prints prompts and pretty rendered responses of turns.
+func printTurns(w io.Writer, turns []session.Turn) error {
+	for i, turn := range turns {
+		if _, err := fmt.Fprintf(w, "\n[%d]>>> %s\n%s\n", i+1, turn.Prompt,
+			mdToPretty([]byte(turn.Response))); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+		if err := printTurnNotes(w, turn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printTurnNotes prints why the response of turn ended, when it did not
+// end normally, and sources it cites.
+func printTurnNotes(w io.Writer, turn session.Turn) error {
+	if len(turn.FinishReason) > 0 {
+		if _, err := fmt.Fprintf(w, "[finish]>>> %s\n", finishNote(turn.FinishReason)); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+	for _, source := range turn.Citations {
+		if _, err := fmt.Fprintf(w, "[citation]>>> %s\n", source); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// sessionToMarkdown renders session metadata and turns as a markdown document.
+func sessionToMarkdown(sess *session.Session) []byte {
+	var sb strings.Builder
+
+	title := sess.Title
+	if len(title) == 0 {
+		title = sess.ID
+	}
+	_, _ = fmt.Fprintf(&sb, "# %s\n\n", title)
+	_, _ = fmt.Fprintf(&sb, "* id: %s\n", sess.ID)
+	_, _ = fmt.Fprintf(&sb, "* model: %s\n", sess.Model)
+	if len(sess.SystemInstruction) > 0 {
+		_, _ = fmt.Fprintf(&sb, "* system: %s\n", sess.SystemInstruction)
+	}
+	_, _ = fmt.Fprintf(&sb, "* created: %s\n", sess.CreateTime.Format(time.RFC3339))
+	_, _ = fmt.Fprintf(&sb, "* updated: %s\n", sess.UpdateTime.Format(time.RFC3339))
+	_, _ = fmt.Fprintf(&sb, "* turns: %d\n", len(sess.Turns))
+	_, _ = fmt.Fprintf(&sb, "* tokens: %d\n", sess.Usage.TotalTokens)
+
+	for i, turn := range sess.Turns {
+		_, _ = fmt.Fprintf(&sb, "\n## [%d]>>>\n\n", i+1)
+		for _, line := range strings.Split(turn.Prompt, "\n") {
+			_, _ = fmt.Fprintf(&sb, "> %s\n", line)
+		}
+		_, _ = fmt.Fprintf(&sb, "\n%s\n", strings.TrimSpace(turn.Response))
+		if len(turn.FinishReason) > 0 {
+			_, _ = fmt.Fprintf(&sb, "\n_%s_\n", finishNote(turn.FinishReason))
+		}
+		if len(turn.Citations) > 0 {
+			_, _ = fmt.Fprintf(&sb, "\nCitations:\n\n")
+			for _, source := range turn.Citations {
+				_, _ = fmt.Fprintf(&sb, "* %s\n", source)
+			}
+		}
+	}
+
+	return []byte(sb.String())
+}
+
+func shortID(id string) string {
+	if len(id) > shortIDLen {
+		return id[:shortIDLen]
+	}
+
+	return id
+}
@@ -0,0 +1,87 @@
+package run
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/kubetrail/gini/pkg/session"
+	"github.com/spf13/cobra"
+)
+
+func TestSessions(t *testing.T) {
+	useTempDataDir(t)
+
+	store, err := session.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess := session.New("models/gemini-2.0-flash")
+	sess.AddTurn(session.Turn{Prompt: "what is a goroutine?", Response: "A lightweight **thread**."})
+	if err := store.Save(sess); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		run     func(*cobra.Command, []string) error
+		args    []string
+		wantOut []string
+	}{
+		{
+			name:    "list",
+			run:     SessionsList,
+			wantOut: []string{sess.ID[:8], "gemini-2.0-flash", "what is a goroutine?"},
+		},
+		{
+			name:    "rename",
+			run:     SessionsRename,
+			args:    []string{sess.ID[:8], "Go", "concurrency"},
+			wantOut: []string{`renamed session ` + sess.ID + ` to "Go concurrency"`},
+		},
+		{
+			name:    "export markdown",
+			run:     SessionsExport,
+			args:    []string{sess.ID},
+			wantOut: []string{"# Go concurrency", "## [1]>>>", "> what is a goroutine?", "A lightweight **thread**."},
+		},
+		{
+			name:    "export json",
+			run:     SessionsExport,
+			args:    []string{sess.ID, "--output-format", "json"},
+			wantOut: []string{`"title": "Go concurrency"`},
+		},
+		{
+			name:    "search",
+			run:     SessionsSearch,
+			args:    []string{"THREAD"},
+			wantOut: []string{sess.ID[:8] + " [turn 1] Go concurrency: A lightweight **thread**."},
+		},
+		{
+			name:    "rm",
+			run:     SessionsRm,
+			args:    []string{sess.ID[:8]},
+			wantOut: []string{"removed session " + sess.ID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, out := newTestCommand(t, tt.run, backend.NewFake(), "", tt.args...)
+			if err := root.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Fatalf("output %q does not contain %q", out.String(), want)
+				}
+			}
+		})
+	}
+
+	if sessions, err := store.List(); err != nil || len(sessions) != 0 {
+		t.Fatalf("got sessions %v, error %v after removal", sessions, err)
+	}
+}
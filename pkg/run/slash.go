@@ -0,0 +1,289 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kubetrail/gini/pkg/attach"
+	"github.com/kubetrail/gini/pkg/session"
+)
+
+const slashPrefix = "/"
+
+// slashCommand is a meta command typed at the chat prompt that adjusts
+// the chat instead of being sent to the model.
+type slashCommand struct {
+	name  string
+	usage string
+	help  string
+	run   func(c *chat, args []string) error
+}
+
+var slashCommands []slashCommand
+
+func init() {
+	slashCommands = []slashCommand{
+		{name: "model", usage: "<name>", help: "switch model keeping chat history", run: (*chat).slashModel},
+		{name: "temperature", usage: "<value>", help: "set model temperature", run: (*chat).slashTemperature},
+		{name: "attach", usage: "<file> [format]", help: "attach file, directory or glob pattern to subsequent prompts", run: (*chat).slashAttach},
+		{name: "detach", usage: "[file]...", help: "stop attaching given files or all files", run: (*chat).slashDetach},
+		{name: "save", help: "save session now and after every turn", run: (*chat).slashSave},
+		{name: "clear", help: "clear chat history and start a new session", run: (*chat).slashClear},
+		{name: "history", help: "print chat history", run: (*chat).slashHistory},
+		{name: "retry", help: "send last prompt again replacing its response", run: (*chat).slashRetry},
+		{name: "undo", help: "remove last prompt and its response from history", run: (*chat).slashUndo},
+		{name: "help", help: "print this help", run: (*chat).slashHelp},
+	}
+}
+
+// parseSlashCommand reports whether prompt is a slash command and returns
+// its name and arguments. A prompt starting with a double slash is
+// not a command, see unescapeSlash.
+func parseSlashCommand(prompt string) (string, []string, bool) {
+	prompt = strings.TrimSpace(prompt)
+	if !strings.HasPrefix(prompt, slashPrefix) || strings.HasPrefix(prompt, slashPrefix+slashPrefix) {
+		return "", nil, false
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(prompt, slashPrefix))
+	if len(fields) == 0 {
+		return "", nil, false
+	}
+
+	return fields[0], fields[1:], true
+}
+
+// unescapeSlash removes leading slash from a prompt starting with a double
+// slash, allowing prompts that begin with a slash to be sent as is.
+func unescapeSlash(prompt string) string {
+	if strings.HasPrefix(prompt, slashPrefix+slashPrefix) {
+		return strings.TrimPrefix(prompt, slashPrefix)
+	}
+
+	return prompt
+}
+
+func (c *chat) runSlashCommand(name string, args []string) error {
+	for _, sc := range slashCommands {
+		if sc.name == name {
+			return sc.run(c, args)
+		}
+	}
+
+	return fmt.Errorf("unknown command, type /help to list commands or start prompt with // to send it as is")
+}
+
+func (c *chat) printf(format string, a ...any) {
+	_, _ = fmt.Fprintf(c.cmd.OutOrStdout(), format, a...)
+}
+
+func (c *chat) slashModel(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: /model <name>")
+	}
+	if len(c.model.CachedContent) > 0 {
+		return fmt.Errorf("model cannot be switched when using cached content")
+	}
+
+	c.model.Name = args[0]
+	c.sess.Model = args[0]
+	if err := c.restart(); err != nil {
+		return err
+	}
+
+	c.printf("model set to %s\n", args[0])
+	return c.save()
+}
+
+func (c *chat) slashTemperature(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: /temperature <value>")
+	}
+
+	v, err := strconv.ParseFloat(args[0], 32)
+	if err != nil || v < 0 {
+		return fmt.Errorf("invalid temperature %s", args[0])
+	}
+
+	c.model.SetTemperature(float32(v))
+	c.sess.GenerationConfig = c.model.GenerationConfig
+	if err := c.restart(); err != nil {
+		return err
+	}
+
+	c.printf("temperature set to %s\n", args[0])
+	return c.save()
+}
+
+func (c *chat) slashAttach(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: /attach <file> [format]")
+	}
+
+	if len(args) == 1 && attach.IsPattern(args[0]) {
+		return c.attachPattern(args[0])
+	}
+
+	formats, err := detectFormats(args[:1], args[1:], c.model.Name)
+	if err != nil {
+		return err
+	}
+
+	return c.attach(args[0], formats[0])
+}
+
+func (c *chat) slashDetach(args []string) error {
+	if len(args) == 0 {
+		c.attached = nil
+		c.printf("detached all files\n")
+		return nil
+	}
+
+	for _, arg := range args {
+		abs, err := filepath.Abs(arg)
+		if err != nil {
+			return fmt.Errorf("failed to resolve path of file %s: %w", arg, err)
+		}
+
+		found := false
+		for i, path := range c.attached {
+			if path == abs || path == arg || filepath.Base(path) == arg {
+				c.attached = append(c.attached[:i], c.attached[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("file %s is not attached", arg)
+		}
+
+		c.printf("detached %s\n", arg)
+	}
+
+	return nil
+}
+
+func (c *chat) slashSave(args []string) error {
+	if len(c.sessionFile) == 0 {
+		store, err := session.NewStore()
+		if err != nil {
+			return err
+		}
+		c.sessionFile = store.Path(c.sess.ID)
+	}
+
+	c.saveSession = true
+	if err := c.save(); err != nil {
+		return err
+	}
+
+	if c.fileWriter != nil {
+		if err := c.fileWriter.Flush(); err != nil {
+			return fmt.Errorf("failed to write to history file: %w", err)
+		}
+	}
+
+	c.printf("session saved to %s\n", c.sessionFile)
+	return nil
+}
+
+func (c *chat) slashClear(args []string) error {
+	sess := session.New(c.sess.Model)
+	sess.SystemInstruction = c.sess.SystemInstruction
+	sess.GenerationConfig = c.sess.GenerationConfig
+	sess.Files = c.sess.Files
+	c.sess = sess
+
+	if c.saveSession {
+		store, err := session.NewStore()
+		if err != nil {
+			return err
+		}
+		c.sessionFile = store.Path(sess.ID)
+	}
+
+	if err := c.restart(); err != nil {
+		return err
+	}
+
+	// the new session gets its own history file, which the old one
+	// points to
+	if c.historyFile != nil {
+		if _, err := c.fileWriter.WriteString(
+			fmt.Sprintf("[clear]>>> history continues in %s\n", transcriptPath(c.sessionFile)),
+		); err != nil {
+			return fmt.Errorf("failed to write to history file: %w", err)
+		}
+
+		if err := c.openHistory(); err != nil {
+			return err
+		}
+	}
+
+	c.printf("history cleared, started session %s\n", sess.ID)
+	return nil
+}
+
+func (c *chat) slashHistory(args []string) error {
+	if len(c.sess.Turns) == 0 {
+		c.printf("history is empty\n")
+		return nil
+	}
+
+	return printTurns(c.cmd.OutOrStdout(), c.sess.Turns)
+}
+
+func (c *chat) slashRetry(args []string) error {
+	turn, ok := c.sess.RemoveLastTurn()
+	if !ok {
+		return fmt.Errorf("nothing to retry")
+	}
+
+	if err := c.restart(); err != nil {
+		return err
+	}
+
+	n := len(c.sess.Turns)
+	c.printf("[%d]>>> %s\n", n+1, turn.Prompt)
+	err := c.send(turn.Prompt)
+	if len(c.sess.Turns) == n {
+		// keep previous response when retry fails or is cancelled
+		c.sess.AddTurn(turn)
+		if err := c.restart(); err != nil {
+			return err
+		}
+	}
+	if errors.Is(err, errCancelled) {
+		return nil
+	}
+
+	return err
+}
+
+func (c *chat) slashUndo(args []string) error {
+	turn, ok := c.sess.RemoveLastTurn()
+	if !ok {
+		return fmt.Errorf("nothing to undo")
+	}
+
+	if err := c.restart(); err != nil {
+		return err
+	}
+
+	c.printf("removed turn %d: %s\n", len(c.sess.Turns)+1, session.TitleFromPrompt(turn.Prompt))
+	return c.save()
+}
+
+func (c *chat) slashHelp(args []string) error {
+	tw := tabwriter.NewWriter(c.cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	for _, sc := range slashCommands {
+		_, _ = fmt.Fprintf(tw, "  /%s %s\t%s\n", sc.name, sc.usage, sc.help)
+	}
+	_, _ = fmt.Fprintf(tw, "  //...\tsend prompt starting with a slash\n")
+
+	return tw.Flush()
+}
@@ -0,0 +1,194 @@
+package run
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+)
+
+func TestParseSlashCommand(t *testing.T) {
+	tests := []struct {
+		prompt   string
+		wantName string
+		wantArgs []string
+		wantOK   bool
+	}{
+		{prompt: "/help", wantName: "help", wantArgs: []string{}, wantOK: true},
+		{prompt: "  /temperature 0.2 ", wantName: "temperature", wantArgs: []string{"0.2"}, wantOK: true},
+		{prompt: "/attach a.pdf application/pdf", wantName: "attach", wantArgs: []string{"a.pdf", "application/pdf"}, wantOK: true},
+		{prompt: "//usr/bin is a directory", wantOK: false},
+		{prompt: "hello /help", wantOK: false},
+		{prompt: "/", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			name, args, ok := parseSlashCommand(tt.prompt)
+			if ok != tt.wantOK {
+				t.Fatalf("got ok %t, want %t", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if name != tt.wantName || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Fatalf("got %s %q, want %s %q", name, args, tt.wantName, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestChatSlashCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		replies int
+		// wantRequests lists, per request, the texts of all contents sent
+		wantRequests [][]string
+		wantOut      []string
+		check        func(t *testing.T, reqs []backend.Request)
+	}{
+		{
+			name:    "help and unknown command are not sent",
+			input:   "/help\n\n/bogus\n\n\n",
+			wantOut: []string{"/temperature <value>", "/bogus: unknown command"},
+		},
+		{
+			name:         "escaped slash is sent",
+			input:        "//usr/bin\n\n\n",
+			replies:      1,
+			wantRequests: [][]string{{"/usr/bin"}},
+		},
+		{
+			name:         "temperature and model changes keep history",
+			input:        "one\n\n/temperature 0.5\n\n/model models/gemini-2.0-flash\n\ntwo\n\n\n",
+			replies:      2,
+			wantRequests: [][]string{{"one"}, {"one", "reply 1", "two"}},
+			wantOut:      []string{"temperature set to 0.5", "model set to models/gemini-2.0-flash"},
+			check: func(t *testing.T, reqs []backend.Request) {
+				if reqs[0].Model.Temperature != nil {
+					t.Fatal("temperature set on first request")
+				}
+				if reqs[1].Model.Temperature == nil || *reqs[1].Model.Temperature != 0.5 {
+					t.Fatalf("got temperature %v, want 0.5", reqs[1].Model.Temperature)
+				}
+				if reqs[1].Model.Name != "models/gemini-2.0-flash" {
+					t.Fatalf("got model %s", reqs[1].Model.Name)
+				}
+			},
+		},
+		{
+			name:         "undo removes last turn",
+			input:        "one\n\ntwo\n\n/undo\n\nthree\n\n\n",
+			replies:      3,
+			wantRequests: [][]string{{"one"}, {"one", "reply 1", "two"}, {"one", "reply 1", "three"}},
+			wantOut:      []string{"removed turn 2: two\n[2]>>> "},
+		},
+		{
+			name:         "retry replaces last response",
+			input:        "one\n\n/retry\n\ntwo\n\n\n",
+			replies:      3,
+			wantRequests: [][]string{{"one"}, {"one"}, {"one", "reply 2", "two"}},
+		},
+		{
+			name:         "clear starts over",
+			input:        "one\n\n/clear\n\ntwo\n\n/history\n\n\n",
+			replies:      2,
+			wantRequests: [][]string{{"one"}, {"two"}},
+			wantOut:      []string{"history cleared", "[1]>>> two"},
+		},
+		{
+			name:    "nothing to undo",
+			input:   "/undo\n\n\n",
+			wantOut: []string{"/undo: nothing to undo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdir(t, t.TempDir())
+			useTempDataDir(t)
+
+			fake := backend.NewFake()
+			for i := 0; i < tt.replies; i++ {
+				fake.Script = append(fake.Script, backend.Reply{
+					Response: backend.TextResponse("reply " + string(rune('1'+i))),
+				})
+			}
+			root, out := newTestCommand(t, Chat, fake, tt.input)
+
+			if err := root.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(fake.Requests) != len(tt.wantRequests) {
+				t.Fatalf("got %d requests, want %d", len(fake.Requests), len(tt.wantRequests))
+			}
+			for i, req := range fake.Requests {
+				var got []string
+				for _, content := range req.Contents {
+					got = append(got, string(content.Parts[0].(genai.Text)))
+				}
+				if !reflect.DeepEqual(got, tt.wantRequests[i]) {
+					t.Fatalf("request %d: got %q, want %q", i, got, tt.wantRequests[i])
+				}
+			}
+
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Fatalf("output %q does not contain %q", out.String(), want)
+				}
+			}
+
+			if tt.check != nil {
+				tt.check(t, fake.Requests)
+			}
+		})
+	}
+}
+
+func TestChatClearHistoryFile(t *testing.T) {
+	chdir(t, t.TempDir())
+	useTempDataDir(t)
+
+	fake := backend.NewFake()
+	fake.Script = []backend.Reply{
+		{Response: backend.TextResponse("reply 1")},
+		{Response: backend.TextResponse("reply 2")},
+	}
+	root, out := newTestCommand(t, Chat, fake, "one\n\n/clear\n\ntwo\n\n\n", "--auto-save")
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	transcripts := sessionFiles(t, "*.txt")
+	if len(transcripts) != 2 {
+		t.Fatalf("got %d transcripts, want 2", len(transcripts))
+	}
+
+	var before, after string
+	for _, transcript := range transcripts {
+		b, err := os.ReadFile(transcript)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), "[1]>>> one") {
+			before = string(b)
+		} else {
+			after = string(b)
+			if !strings.Contains(out.String(), "history saved to "+transcript) {
+				t.Fatalf("output %q does not name %s", out.String(), transcript)
+			}
+		}
+	}
+
+	if strings.Contains(before, ">>> two") || !strings.Contains(before, "[clear]>>> history continues in ") {
+		t.Fatalf("history before clear is %q", before)
+	}
+	if !strings.Contains(after, "[1]>>> two") || strings.Contains(after, ">>> one") {
+		t.Fatalf("history after clear is %q", after)
+	}
+}
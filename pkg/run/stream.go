@@ -0,0 +1,160 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/mattn/go-isatty"
+	"github.com/mattn/go-runewidth"
+	"google.golang.org/api/iterator"
+)
+
+// defaultTermWidth and defaultTermHeight are the number of columns and
+// rows assumed when the terminal does not tell.
+const (
+	defaultTermWidth  = 80
+	defaultTermHeight = 24
+)
+
+// streamResponse consumes iter and renders the text received so far to w
+// on every chunk, re-flowing the pretty rendering as more text arrives.
+// Only the end of the rendering that fits on the terminal is drawn since
+// rows scrolled out of sight cannot be cleared. The streamed output is
+// cleared once the stream ends so that the caller can print the merged
+// response via printResponse, which also takes care of writing the turn
+// to history.
+func streamResponse(iter backend.ResponseIterator, w io.Writer, placeholder string) (*genai.GenerateContentResponse, error) {
+	live := isTerminal(w)
+	width, height := terminalSize(w)
+
+	var text strings.Builder
+	var rows int
+	clear := func() {
+		if rows > 0 {
+			_, _ = fmt.Fprintf(w, "\r\033[%dA\033[J", rows)
+		} else {
+			_, _ = fmt.Fprintf(w, "\r\033[J")
+		}
+		rows = 0
+	}
+
+	if live && len(placeholder) > 0 {
+		_, _ = fmt.Fprintf(w, "%s\r", placeholder)
+	}
+
+	for {
+		res, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			if live {
+				clear()
+			}
+			return nil, fmt.Errorf("failed to receive streamed response: %w", explainBlocked(err))
+		}
+
+		if !live {
+			continue
+		}
+
+		n := text.Len()
+		for _, cand := range res.Candidates {
+			if cand.Content == nil {
+				continue
+			}
+			for _, part := range cand.Content.Parts {
+				if t, ok := part.(genai.Text); ok {
+					text.WriteString(string(t))
+				}
+			}
+		}
+
+		if text.Len() == n {
+			continue
+		}
+
+		// a row is left for the cursor so that the first row drawn stays
+		// on screen to be cleared
+		out := strings.ReplaceAll(string(mdToPretty([]byte(text.String()))), "\t", "    ")
+		tail, drawn := visibleTail(out, width, max(height-1, 1))
+		clear()
+		if _, err := fmt.Fprint(w, strings.ReplaceAll(tail, "\n", "\r\n")+"\r\n"); err != nil {
+			return nil, fmt.Errorf("failed to write to output: %w", err)
+		}
+		rows = drawn
+	}
+
+	if live {
+		clear()
+	}
+
+	res := iter.MergedResponse()
+	if res == nil {
+		return nil, fmt.Errorf("empty response from model")
+	}
+
+	return res, nil
+}
+
+// visibleTail returns the last lines of rendered text that fit in rows
+// rows of a terminal width columns wide, along with the number of rows
+// they take as the terminal wraps them.
+func visibleTail(text string, width, rows int) (string, int) {
+	lines := strings.Split(text, "\n")
+
+	i, used := len(lines), 0
+	for ; i > 0; i-- {
+		n := lineRows(lines[i-1], width)
+		if used+n > rows {
+			break
+		}
+		used += n
+	}
+
+	return strings.Join(lines[i:], "\n"), used
+}
+
+// escapeSequence matches terminal escape sequences, such as the ones
+// setting colors or marking links, which take no columns.
+var escapeSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)`)
+
+// lineRows returns the number of rows line takes on a terminal width
+// columns wide.
+func lineRows(line string, width int) int {
+	cols := runewidth.StringWidth(escapeSequence.ReplaceAllString(line, ""))
+	if cols == 0 {
+		return 1
+	}
+
+	return (cols + width - 1) / width
+}
+
+// terminalSize returns the number of columns and rows of the terminal w is
+// attached to, or defaults when w is not a terminal or its size is unknown.
+func terminalSize(w io.Writer) (width, height int) {
+	f, ok := w.(*os.File)
+	if !ok {
+		return defaultTermWidth, defaultTermHeight
+	}
+
+	return termSize(f)
+}
+
+// isTerminal reports whether v, a reader or writer, is attached to
+// a terminal, in which case cursor movement escape sequences can be used
+// to redraw output.
+func isTerminal(v any) bool {
+	f, ok := v.(*os.File)
+	if !ok {
+		return false
+	}
+
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
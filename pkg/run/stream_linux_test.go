@@ -0,0 +1,29 @@
+package run
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kubetrail/gini/pkg/backend"
+)
+
+func TestStreamResponseRenders(t *testing.T) {
+	term, dev := openTerminal(t)
+
+	const text = "# Title\n\nsome **bold** text"
+	fake := backend.NewFake(backend.TextResponse(text))
+	res, err := streamResponse(fake.GenerateContentStream(context.Background(), backend.NewModel("m")), dev, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := responseText(res); got != text {
+		t.Fatalf("got merged text %q, want %q", got, text)
+	}
+
+	// the pretty rendering is drawn while streaming and cleared at the end,
+	// where the terminal adds a carriage return to every new line
+	rendered := strings.ReplaceAll(strings.TrimRight(string(mdToPretty([]byte(text))), "\n"), "\n", "\r\r\n")
+	term.waitFor(t, rendered, 1)
+	term.waitFor(t, "\x1b[J", 2)
+}
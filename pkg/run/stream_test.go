@@ -0,0 +1,32 @@
+package run
+
+import "testing"
+
+func TestVisibleTail(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		width    int
+		rows     int
+		want     string
+		wantRows int
+	}{
+		{name: "fits", text: "one\ntwo", width: 10, rows: 5, want: "one\ntwo", wantRows: 2},
+		{name: "last lines", text: "one\ntwo\nthree\nfour", width: 10, rows: 2, want: "three\nfour", wantRows: 2},
+		{name: "soft wrap", text: "abcdefgh\nij", width: 3, rows: 4, want: "abcdefgh\nij", wantRows: 4},
+		{name: "wrapped line left out", text: "abcdefgh\nij", width: 3, rows: 3, want: "ij", wantRows: 1},
+		{name: "wide runes", text: "日本語です", width: 4, rows: 5, want: "日本語です", wantRows: 3},
+		{name: "colors", text: "\x1b[1;33mbold\x1b[0m", width: 4, rows: 1, want: "\x1b[1;33mbold\x1b[0m", wantRows: 1},
+		{name: "links", text: "\x1b]8;;https://go.dev\x1b\\go\x1b]8;;\x1b\\", width: 2, rows: 1, want: "\x1b]8;;https://go.dev\x1b\\go\x1b]8;;\x1b\\", wantRows: 1},
+		{name: "trailing newline", text: "a\n", width: 3, rows: 5, want: "a\n", wantRows: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rows := visibleTail(tt.text, tt.width, tt.rows)
+			if got != tt.want || rows != tt.wantRows {
+				t.Fatalf("got %q in %d rows, want %q in %d rows", got, rows, tt.want, tt.wantRows)
+			}
+		})
+	}
+}
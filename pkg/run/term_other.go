@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package run
+
+import "os"
+
+func termSize(f *os.File) (int, int) {
+	return defaultTermWidth, defaultTermHeight
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package run
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// termSize returns the number of columns and rows of terminal f.
+func termSize(f *os.File) (int, int) {
+	ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return defaultTermWidth, defaultTermHeight
+	}
+
+	return int(ws.Col), int(ws.Row)
+}
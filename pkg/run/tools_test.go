@@ -0,0 +1,82 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/spf13/viper"
+)
+
+func TestChatTools(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, ".gini.yaml")
+	if err := os.WriteFile(config, []byte("tools:\n  - name: echo\n    command: cat\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	call := &genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{{
+			Content: &genai.Content{Role: "model", Parts: []genai.Part{
+				genai.FunctionCall{Name: "echo", Args: map[string]any{"word": "hi"}},
+			}},
+		}},
+	}
+
+	tests := []struct {
+		name    string
+		answer  string
+		wantOut string
+		want    map[string]any
+	}{
+		{
+			name:    "confirmed",
+			answer:  "y",
+			wantOut: `[tool]>>> echo {"word":"hi"}`,
+			want:    map[string]any{"word": "hi"},
+		},
+		{
+			name:   "declined",
+			answer: "n",
+			want:   map[string]any{"error": "user declined to run the tool"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := backend.NewFake(call, backend.TextResponse("done"))
+			root, out := newTestCommand(t, Chat, fake, "echo hi\n\n"+tt.answer+"\n\n", "--enable-tools")
+			viper.SetConfigFile(config)
+
+			if err := root.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(fake.Requests) != 2 {
+				t.Fatalf("got %d requests, want 2", len(fake.Requests))
+			}
+
+			decls := fake.Requests[0].Model.Tools[0].FunctionDeclarations
+			if len(decls) != 1 || decls[0].Name != "echo" {
+				t.Fatalf("got declarations %v", decls)
+			}
+
+			contents := fake.Requests[1].Contents
+			fr, ok := contents[len(contents)-1].Parts[0].(genai.FunctionResponse)
+			if !ok {
+				t.Fatalf("got %T, want genai.FunctionResponse", contents[len(contents)-1].Parts[0])
+			}
+			if fr.Name != "echo" || !reflect.DeepEqual(fr.Response, tt.want) {
+				t.Fatalf("got function response %v, want %v", fr, tt.want)
+			}
+
+			if !strings.Contains(out.String(), tt.wantOut) || !strings.Contains(out.String(), "done") {
+				t.Fatalf("output %q does not contain %q and response", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+)
+
+// filePollInterval is the time between checks of the state of a file
+// that is still being processed after upload.
+var filePollInterval = 2 * time.Second
+
+// attachFile returns a part referring to file for use in a prompt. Files
+// of up to inlineLimit bytes are sent inline, saving an upload round-trip,
+// while larger ones are uploaded using the Files API. The name of the
+// upload is returned so that it can be deleted later, it is empty for
+// inline files.
+func attachFile(ctx context.Context, client backend.Backend, path, mimeType string, inlineLimit int64, w io.Writer) (genai.Part, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+
+	if info.Size() <= inlineLimit {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read file %s: %w", path, err)
+		}
+		return genai.Blob{MIMEType: mimeType, Data: b}, "", nil
+	}
+
+	f, err := uploadFile(ctx, client, path, mimeType, w)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return genai.FileData{URI: f.URI}, f.Name, nil
+}
+
+// uploadFile uploads file and waits until it is ready to be used in
+// prompts. Progress is written to w. A file that fails processing is
+// deleted and reported as an error.
+func uploadFile(ctx context.Context, client backend.Backend, path, mimeType string, w io.Writer) (*genai.File, error) {
+	_, _ = fmt.Fprintf(w, "uploading %s...", path)
+
+	f, err := client.UploadFile(ctx, path, &genai.UploadFileOptions{
+		DisplayName: filepath.Base(path),
+		MIMEType:    mimeType,
+	})
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "failed!\n")
+		return nil, fmt.Errorf("failed to upload file %s: %w", path, err)
+	}
+
+	ready, err := waitForFile(ctx, client, f, w)
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "failed!\n")
+		// the upload is of no use, it is deleted even when ctx is done
+		_ = client.DeleteFile(context.WithoutCancel(ctx), f.Name)
+		return nil, fmt.Errorf("failed to process file %s: %w", path, err)
+	}
+
+	_, _ = fmt.Fprintf(w, "done!\n")
+	return ready, nil
+}
+
+// waitForFile polls the state of file until it is no longer processing,
+// writing a dot to w for every poll.
+func waitForFile(ctx context.Context, client backend.Backend, f *genai.File, w io.Writer) (*genai.File, error) {
+	for f.State == genai.FileStateProcessing {
+		_, _ = fmt.Fprintf(w, ".")
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(filePollInterval):
+		}
+
+		var err error
+		if f, err = client.GetFile(ctx, f.Name); err != nil {
+			return nil, fmt.Errorf("failed to get state of file: %w", err)
+		}
+	}
+
+	if f.State == genai.FileStateFailed {
+		if f.Error != nil {
+			return nil, fmt.Errorf("file was rejected by the service: %s", f.Error.Error())
+		}
+		return nil, fmt.Errorf("file was rejected by the service")
+	}
+
+	return f, nil
+}
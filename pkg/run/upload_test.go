@@ -0,0 +1,91 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
+)
+
+func TestUploadFile(t *testing.T) {
+	orig := filePollInterval
+	filePollInterval = time.Millisecond
+	t.Cleanup(func() { filePollInterval = orig })
+
+	file := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(file, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		states   []genai.FileState
+		cancel   bool
+		wantErr  string
+		wantDots int
+	}{
+		{name: "active right away"},
+		{
+			name:     "processing until active",
+			states:   []genai.FileState{genai.FileStateProcessing, genai.FileStateProcessing, genai.FileStateActive},
+			wantDots: 3,
+		},
+		{
+			name:    "rejected",
+			states:  []genai.FileState{genai.FileStateProcessing, genai.FileStateFailed},
+			wantErr: "rejected",
+		},
+		{
+			name:    "cancelled",
+			states:  []genai.FileState{genai.FileStateProcessing},
+			cancel:  true,
+			wantErr: context.Canceled.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := backend.NewFake()
+			fake.FileStates = tt.states
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			w := &bytes.Buffer{}
+			f, err := uploadFile(ctx, fake, file, "video/mp4", w)
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				if tt.cancel && !errors.Is(err, context.Canceled) {
+					t.Errorf("error %v does not wrap context error", err)
+				}
+				if len(fake.Files) != 0 {
+					t.Errorf("failed upload was not deleted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if f.State != genai.FileStateActive {
+				t.Errorf("got state %s", f.State)
+			}
+			progress := strings.TrimPrefix(w.String(), "uploading "+file+"...")
+			if want := strings.Repeat(".", tt.wantDots) + "done!\n"; progress != want {
+				t.Errorf("got progress %q, want %q", progress, want)
+			}
+		})
+	}
+}
@@ -2,15 +2,24 @@ package run
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	termmarkdown "github.com/MichaelMure/go-term-markdown"
 	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/html"
 	"github.com/gomarkdown/markdown/parser"
 	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/backend"
 	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/mimetype"
+	"github.com/kubetrail/gini/pkg/schema"
+	"github.com/kubetrail/gini/pkg/session"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -20,6 +29,80 @@ const (
 	endHold   = "}}"
 )
 
+// newBackend creates the backend used by all commands. It is a variable
+// so that tests can replace it with a fake.
+var newBackend = backend.New
+
+// readLines reads a prompt from scanner. A blank line ends the prompt unless
+// it is enclosed within startHold and endHold markers. Reading also stops
+// when ctx is done or input is exhausted.
+func readLines(ctx context.Context, scanner *bufio.Scanner) ([]string, error) {
+	var p promptLines
+	for scanner.Scan() {
+		select {
+		case <-ctx.Done():
+			return p.lines, scanner.Err()
+		default:
+			if p.add(scanner.Text()) {
+				return p.lines, scanner.Err()
+			}
+		}
+	}
+
+	return p.lines, scanner.Err()
+}
+
+// promptLines collects lines of a prompt read one at a time.
+type promptLines struct {
+	lines []string
+	hold  bool
+}
+
+// add adds line to the prompt and reports whether it ends the prompt, that
+// is, when it is blank or closes hold mode.
+func (p *promptLines) add(line string) bool {
+	switch {
+	case len(line) == 0 && !p.hold:
+		return true
+	case strings.TrimSpace(line) == startHold:
+		p.hold = true
+	case strings.TrimSpace(line) == endHold && p.hold:
+		return true
+	default:
+		p.lines = append(p.lines, line)
+	}
+
+	return false
+}
+
+// configureModel applies model config values and safety settings from
+// persistent flags.
+func configureModel(model *backend.Model, pFlags persistentFlagValues) error {
+	if pFlags.TopP >= 0 {
+		model.SetTopP(pFlags.TopP)
+	}
+	if pFlags.TopK >= 0 {
+		model.SetTopK(pFlags.TopK)
+	}
+	if pFlags.Temperature >= 0 {
+		model.SetTemperature(pFlags.Temperature)
+	}
+	if pFlags.CandidateCount >= 0 {
+		model.SetCandidateCount(pFlags.CandidateCount)
+	}
+	if pFlags.MaxOutputTokens >= 0 {
+		model.SetMaxOutputTokens(pFlags.MaxOutputTokens)
+	}
+
+	settings, err := safetySettings(pFlags)
+	if err != nil {
+		return err
+	}
+	model.SafetySettings = settings
+
+	return nil
+}
+
 func mdToHTML(md []byte) []byte {
 	// create Markdown parser with extensions
 	extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock
@@ -42,7 +125,11 @@ func mdToMd(md []byte) []byte {
 	return md
 }
 
-func printResponse(resp *genai.GenerateContentResponse, w io.Writer, render string, autoSave bool, fileWriter *bufio.Writer) error {
+// printResponse prints text parts of resp rendered for the terminal and
+// writes them to history in render format when autoSave is set. Blob
+// parts, such as generated images, are saved to files in outputDir and
+// referenced by path instead.
+func printResponse(resp *genai.GenerateContentResponse, w io.Writer, render string, autoSave bool, fileWriter *bufio.Writer, outputDir string) error {
 	if autoSave {
 		if _, err := fileWriter.WriteString(fmt.Sprintf("%s\n", "[response]>>>")); err != nil {
 			return fmt.Errorf("failed to write to history file: %w", err)
@@ -78,6 +165,21 @@ func printResponse(resp *genai.GenerateContentResponse, w io.Writer, render stri
 							return fmt.Errorf("failed to write to history file: %w", err)
 						}
 					}
+				} else if blob, ok := part.(genai.Blob); ok {
+					path, err := saveBlob(blob, outputDir)
+					if err != nil {
+						return err
+					}
+
+					ref := fmt.Sprintf("[%s saved to %s]", blobKind(blob), path)
+					if _, err := fmt.Fprintln(w, ref); err != nil {
+						return fmt.Errorf("failed to write to output: %w", err)
+					}
+					if autoSave {
+						if _, err := fileWriter.WriteString(fmt.Sprintf("%s\n", ref)); err != nil {
+							return fmt.Errorf("failed to write to history file: %w", err)
+						}
+					}
 				} else {
 					if _, err := fmt.Fprintln(w, part); err != nil {
 						return fmt.Errorf("failed to write to output: %w", err)
@@ -95,6 +197,261 @@ func printResponse(resp *genai.GenerateContentResponse, w io.Writer, render stri
 	return nil
 }
 
+// printJSON validates response text against the schema and prints it as is
+// without any rendering so that it can be piped to other tools.
+func printJSON(resp *genai.GenerateContentResponse, w io.Writer, s *genai.Schema, fileWriter *bufio.Writer) error {
+	text := strings.TrimSpace(responseText(resp))
+	if err := schema.Validate(s, []byte(text)); err != nil {
+		return fmt.Errorf("response does not match schema: %w", err)
+	}
+
+	if _, err := fmt.Fprintln(w, text); err != nil {
+		return fmt.Errorf("failed to write to output: %w", err)
+	}
+
+	if fileWriter != nil {
+		if _, err := fileWriter.WriteString(fmt.Sprintf("[response]>>>\n%s\n", text)); err != nil {
+			return fmt.Errorf("failed to write to history file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// responseText returns the concatenated text parts of the first candidate.
+func responseText(resp *genai.GenerateContentResponse) string {
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if text, ok := part.(genai.Text); ok {
+			sb.WriteString(string(text))
+		}
+	}
+
+	return sb.String()
+}
+
+// responseBlobs returns blob parts of the first candidate.
+func responseBlobs(resp *genai.GenerateContentResponse) []genai.Blob {
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return nil
+	}
+
+	var blobs []genai.Blob
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if blob, ok := part.(genai.Blob); ok {
+			blobs = append(blobs, blob)
+		}
+	}
+
+	return blobs
+}
+
+// blobKind returns the kind of content of blob, such as image or audio.
+func blobKind(blob genai.Blob) string {
+	kind, _, _ := strings.Cut(blob.MIMEType, "/")
+	if len(kind) == 0 || kind == "application" {
+		return "file"
+	}
+
+	return kind
+}
+
+// saveBlob writes data of blob to a new file in dir, which is created if
+// needed, and returns its path. Files are named after the kind of content
+// with an extension matching its type, for instance image-123456.png.
+func saveBlob(blob genai.Blob, dir string) (string, error) {
+	if len(dir) == 0 {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, blobKind(blob)+"-*"+mimetype.Extension(blob.MIMEType))
+	if err != nil {
+		return "", fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(blob.Data); err != nil {
+		return "", fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	return f.Name(), nil
+}
+
+// detectFormats returns formats of files. Formats given on command line
+// apply to files in the same position and formats of the remaining files
+// are detected. Every format is checked to be accepted by model unless
+// model is empty.
+func detectFormats(files, formats []string, model string) ([]string, error) {
+	if len(formats) > len(files) {
+		return nil, fmt.Errorf("cannot provide more formats than number of files")
+	}
+
+	formats = append([]string(nil), formats...)
+	for _, file := range files[len(formats):] {
+		format, err := mimetype.Detect(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect format of file %s: %w", file, err)
+		}
+		formats = append(formats, format)
+	}
+
+	for i, file := range files {
+		if err := mimetype.Check(model, formats[i]); err != nil {
+			return nil, fmt.Errorf("cannot attach file %s: %w", file, err)
+		}
+	}
+
+	return formats, nil
+}
+
+// configureResponse applies response MIME type, schema and modalities
+// flags to model. A response schema implies JSON responses. Model is left
+// as is when none of the flags is set.
+func configureResponse(cmd *cobra.Command, model *backend.Model) error {
+	_ = viper.BindPFlag(flags.ResponseMimeType, cmd.Flag(flags.ResponseMimeType))
+	_ = viper.BindPFlag(flags.ResponseSchema, cmd.Flag(flags.ResponseSchema))
+	_ = viper.BindPFlag(flags.ResponseModalities, cmd.Flag(flags.ResponseModalities))
+
+	for _, modality := range viper.GetStringSlice(flags.ResponseModalities) {
+		switch strings.ToLower(modality) {
+		case flags.ResponseModalityText:
+			model.ResponseModalities = append(model.ResponseModalities, backend.ModalityText)
+		case flags.ResponseModalityImage:
+			model.ResponseModalities = append(model.ResponseModalities, backend.ModalityImage)
+		default:
+			return fmt.Errorf("invalid response modality %s, needs to be %s or %s",
+				modality, flags.ResponseModalityText, flags.ResponseModalityImage)
+		}
+	}
+
+	mimeType := viper.GetString(flags.ResponseMimeType)
+	schemaFile := viper.GetString(flags.ResponseSchema)
+
+	if len(schemaFile) > 0 {
+		s, err := schema.Load(schemaFile)
+		if err != nil {
+			return err
+		}
+
+		if len(mimeType) == 0 {
+			mimeType = flags.ResponseMimeTypeJson
+		}
+		if mimeType != flags.ResponseMimeTypeJson {
+			return fmt.Errorf("response schema requires response mime type %s", flags.ResponseMimeTypeJson)
+		}
+
+		model.ResponseSchema = s
+	}
+
+	if len(mimeType) > 0 {
+		model.ResponseMIMEType = mimeType
+		if mimeType != flags.ResponseMimeTypeJson {
+			model.ResponseSchema = nil
+		}
+	}
+
+	return nil
+}
+
+// jsonOutput reports whether model is configured to respond with JSON.
+func jsonOutput(model *backend.Model) bool {
+	return model.ResponseMIMEType == flags.ResponseMimeTypeJson
+}
+
+// getSystemInstruction returns the system instruction given via --system
+// or --system-file flags, falling back to system-file and system keys in
+// config file.
+func getSystemInstruction(cmd *cobra.Command) (string, error) {
+	_ = viper.BindPFlag(flags.System, cmd.Flag(flags.System))
+	_ = viper.BindPFlag(flags.SystemFile, cmd.Flag(flags.SystemFile))
+
+	systemChanged := cmd.Flags().Changed(flags.System)
+	systemFileChanged := cmd.Flags().Changed(flags.SystemFile)
+	if systemChanged && systemFileChanged {
+		return "", fmt.Errorf("cannot use both --%s and --%s", flags.System, flags.SystemFile)
+	}
+
+	if !systemChanged {
+		if file := viper.GetString(flags.SystemFile); len(file) > 0 {
+			b, err := os.ReadFile(file)
+			if err != nil {
+				return "", fmt.Errorf("failed to read system instruction file: %w", err)
+			}
+			return strings.TrimSpace(string(b)), nil
+		}
+	}
+
+	return strings.TrimSpace(viper.GetString(flags.System)), nil
+}
+
+// systemContent returns system instruction content for the model or nil
+// when there is no system instruction.
+func systemContent(system string) *genai.Content {
+	if len(system) == 0 {
+		return nil
+	}
+
+	return &genai.Content{Parts: []genai.Part{genai.Text(system)}}
+}
+
+// openSession returns the session to record a chat in along with the path
+// of its session file. A new session is created in the session store when
+// ref is empty, otherwise ref is either the path to a session file or an ID
+// of a session in the store. The store is only accessed when a session is
+// resumed or save is set.
+func openSession(ref, model string, save bool) (*session.Session, string, error) {
+	if len(ref) == 0 {
+		sess := session.New(model)
+		if !save {
+			return sess, "", nil
+		}
+
+		store, err := session.NewStore()
+		if err != nil {
+			return nil, "", err
+		}
+
+		return sess, store.Path(sess.ID), nil
+	}
+
+	sessionFile := ref
+	if _, err := os.Stat(ref); err != nil {
+		store, err := session.NewStore()
+		if err != nil {
+			return nil, "", err
+		}
+
+		id, err := store.Resolve(ref)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to resume session: %w", err)
+		}
+		sessionFile = store.Path(id)
+	}
+
+	sess, err := session.Load(sessionFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resume session: %w", err)
+	}
+
+	return sess, sessionFile, nil
+}
+
+// transcriptPath returns the path of the rendered transcript kept
+// alongside a session file.
+func transcriptPath(sessionFile string) string {
+	return strings.TrimSuffix(sessionFile, filepath.Ext(sessionFile)) + ".txt"
+}
+
 type persistentFlagValues struct {
 	ApiKey               string
 	TopP                 float32
@@ -105,6 +462,12 @@ type persistentFlagValues struct {
 	AutoSave             bool
 	Render               string
 	AllowHarmProbability string
+	BlockHarassment      string
+	BlockHateSpeech      string
+	BlockSexual          string
+	BlockDangerous       string
+	RetryMaxAttempts     int
+	RetryMaxElapsed      time.Duration
 }
 
 func getPersistentFlags(cmd *cobra.Command) persistentFlagValues {
@@ -119,6 +482,12 @@ func getPersistentFlags(cmd *cobra.Command) persistentFlagValues {
 	_ = viper.BindPFlag(flags.AutoSave, pFlags.Lookup(flags.AutoSave))
 	_ = viper.BindPFlag(flags.Render, pFlags.Lookup(flags.Render))
 	_ = viper.BindPFlag(flags.AllowHarmProbability, pFlags.Lookup(flags.AllowHarmProbability))
+	_ = viper.BindPFlag(flags.BlockHarassment, pFlags.Lookup(flags.BlockHarassment))
+	_ = viper.BindPFlag(flags.BlockHateSpeech, pFlags.Lookup(flags.BlockHateSpeech))
+	_ = viper.BindPFlag(flags.BlockSexual, pFlags.Lookup(flags.BlockSexual))
+	_ = viper.BindPFlag(flags.BlockDangerous, pFlags.Lookup(flags.BlockDangerous))
+	_ = viper.BindPFlag(flags.RetryMaxAttempts, pFlags.Lookup(flags.RetryMaxAttempts))
+	_ = viper.BindPFlag(flags.RetryMaxElapsed, pFlags.Lookup(flags.RetryMaxElapsed))
 
 	_ = viper.BindEnv(flags.ApiKey, flags.ApiKeyEnv)
 
@@ -131,6 +500,12 @@ func getPersistentFlags(cmd *cobra.Command) persistentFlagValues {
 	autoSave := viper.GetBool(flags.AutoSave)
 	render := viper.GetString(flags.Render)
 	allowHarmProbability := viper.GetString(flags.AllowHarmProbability)
+	blockHarassment := viper.GetString(flags.BlockHarassment)
+	blockHateSpeech := viper.GetString(flags.BlockHateSpeech)
+	blockSexual := viper.GetString(flags.BlockSexual)
+	blockDangerous := viper.GetString(flags.BlockDangerous)
+	retryMaxAttempts := viper.GetInt(flags.RetryMaxAttempts)
+	retryMaxElapsed := viper.GetDuration(flags.RetryMaxElapsed)
 
 	return persistentFlagValues{
 		ApiKey:               apiKey,
@@ -142,5 +517,11 @@ func getPersistentFlags(cmd *cobra.Command) persistentFlagValues {
 		AutoSave:             autoSave,
 		Render:               render,
 		AllowHarmProbability: allowHarmProbability,
+		BlockHarassment:      blockHarassment,
+		BlockHateSpeech:      blockHateSpeech,
+		BlockSexual:          blockSexual,
+		BlockDangerous:       blockDangerous,
+		RetryMaxAttempts:     retryMaxAttempts,
+		RetryMaxElapsed:      retryMaxElapsed,
 	}
 }
@@ -0,0 +1,199 @@
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubetrail/gini/pkg/backend"
+	"github.com/kubetrail/gini/pkg/flags"
+	"github.com/kubetrail/gini/pkg/index"
+	"github.com/kubetrail/gini/pkg/session"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// newTestCommand returns a command attached to a root command carrying the
+// same persistent flags as gini, with input, output and backend wired to
+// given values. Extra arguments are parsed as command line flags.
+func newTestCommand(t *testing.T, run func(*cobra.Command, []string) error, fake *backend.Fake, input string, extraFlags ...string) (*cobra.Command, *bytes.Buffer) {
+	t.Helper()
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	orig := newBackend
+	newBackend = func(ctx context.Context, apiKey string) (backend.Backend, error) {
+		return fake, nil
+	}
+	t.Cleanup(func() { newBackend = orig })
+
+	// interrupts of the test process are left alone
+	origNotify := notifyInterrupt
+	notifyInterrupt = func(c chan<- os.Signal) func() { return func() {} }
+	t.Cleanup(func() { notifyInterrupt = origNotify })
+
+	root := &cobra.Command{Use: "gini"}
+	f := root.PersistentFlags()
+	f.String(flags.ApiKey, "test-key", "")
+	f.Bool(flags.AutoSave, false, "")
+	f.String(flags.Render, flags.RenderFormatMarkdown, "")
+	f.Float32(flags.TopP, -1, "")
+	f.Int32(flags.TopK, -1, "")
+	f.Float32(flags.Temperature, -1, "")
+	f.Int32(flags.CandidateCount, -1, "")
+	f.Int32(flags.MaxOutputTokens, -1, "")
+	f.String(flags.AllowHarmProbability, flags.HarmProbabilityNegligible, "")
+	f.String(flags.BlockHarassment, flags.HarmBlockUnspecified, "")
+	f.String(flags.BlockHateSpeech, flags.HarmBlockUnspecified, "")
+	f.String(flags.BlockSexual, flags.HarmBlockUnspecified, "")
+	f.String(flags.BlockDangerous, flags.HarmBlockUnspecified, "")
+	f.Int(flags.RetryMaxAttempts, 5, "")
+	f.Duration(flags.RetryMaxElapsed, time.Minute, "")
+
+	cmd := &cobra.Command{Use: "test", RunE: run}
+	cf := cmd.Flags()
+	cf.String(flags.Model, flags.Models[flags.DefaultModelIndex], "")
+	cf.StringSlice(flags.File, nil, "")
+	cf.StringSlice(flags.Format, nil, "")
+	cf.Bool(flags.Stream, false, "")
+	cf.String(flags.Resume, "", "")
+	cf.String(flags.System, "", "")
+	cf.String(flags.SystemFile, "", "")
+	cf.Bool(flags.Usage, false, "")
+	cf.String(flags.ResponseMimeType, "", "")
+	cf.String(flags.ResponseSchema, "", "")
+	cf.StringSlice(flags.ResponseModalities, nil, "")
+	cf.String(flags.OutputDir, "", "")
+	cf.Bool(flags.AutoContinue, false, "")
+	cf.String(flags.SubmitKey, flags.SubmitKeyDoubleEnter, "")
+	cf.Bool(flags.EnableTools, false, "")
+	cf.String(flags.OutputFormat, flags.RenderFormatMarkdown, "")
+	cf.String(flags.Output, "", "")
+	cf.String(flags.TaskType, "", "")
+	cf.String(flags.Title, "", "")
+	cf.String(flags.Name, "", "")
+	cf.Int(flags.ChunkSize, index.DefaultChunkSize, "")
+	cf.String(flags.Index, "", "")
+	cf.Int(flags.IndexTopK, 5, "")
+	cf.String(flags.CachedContent, "", "")
+	cf.String(flags.DisplayName, "", "")
+	cf.Duration(flags.TTL, 0, "")
+	cf.String(flags.ExpireTime, "", "")
+	cf.Bool(flags.KeepUploads, false, "")
+	cf.StringSlice(flags.FileUri, nil, "")
+	cf.Duration(flags.OlderThan, 0, "")
+	cf.Bool(flags.DryRun, false, "")
+	cf.Bool(flags.All, false, "")
+	cf.Bool(flags.Yes, false, "")
+	cf.Int(flags.MaxDimension, 0, "")
+	cf.String(flags.ConvertTo, "", "")
+	cf.Int(flags.Quality, 0, "")
+	cf.Bool(flags.KeepMetadata, false, "")
+	root.AddCommand(cmd)
+
+	out := &bytes.Buffer{}
+	root.SetIn(strings.NewReader(input))
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs(append([]string{"test"}, extraFlags...))
+
+	return root, out
+}
+
+// useTempDataDir points the session store to a temporary directory
+// for the duration of the test.
+func useTempDataDir(t *testing.T) {
+	t.Helper()
+
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+}
+
+// sessionFiles returns names of files in session store matching pattern.
+func sessionFiles(t *testing.T, pattern string) []string {
+	t.Helper()
+
+	store, err := session.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(store.Dir, pattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return matches
+}
+
+// chdir changes working directory to dir for the duration of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+func TestReadLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "single line",
+			input: "hello\n\n",
+			want:  []string{"hello"},
+		},
+		{
+			name:  "multiple lines",
+			input: "hello\nworld\n\nnext\n",
+			want:  []string{"hello", "world"},
+		},
+		{
+			name:  "hold mode keeps blank lines",
+			input: "{{\nhello\n\n\nworld\n}}\nnext\n",
+			want:  []string{"hello", "", "", "world"},
+		},
+		{
+			name:  "end marker outside hold mode is text",
+			input: "}}\n\n",
+			want:  []string{"}}"},
+		},
+		{
+			name:  "empty input",
+			input: "\n",
+			want:  nil,
+		},
+		{
+			name:  "unterminated hold mode at eof",
+			input: "{{\nhello\n\n",
+			want:  []string{"hello", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := bufio.NewScanner(strings.NewReader(tt.input))
+			got, err := readLines(context.Background(), scanner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
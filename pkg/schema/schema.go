@@ -0,0 +1,349 @@
+// Package schema loads response schemas written as JSON Schema or an
+// equivalent YAML document and validates model responses against them.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"gopkg.in/yaml.v3"
+)
+
+// ignoredKeys are JSON Schema keywords that are accepted but have no
+// equivalent in genai.Schema.
+var ignoredKeys = map[string]bool{
+	"$schema":              true,
+	"$id":                  true,
+	"title":                true,
+	"additionalProperties": true,
+}
+
+var types = map[string]genai.Type{
+	"string":  genai.TypeString,
+	"number":  genai.TypeNumber,
+	"integer": genai.TypeInteger,
+	"boolean": genai.TypeBoolean,
+	"array":   genai.TypeArray,
+	"object":  genai.TypeObject,
+}
+
+// Load reads a schema from file. JSON files are parsed as YAML, which is
+// a superset of JSON.
+func Load(name string) (*genai.Schema, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema file: %w", err)
+	}
+
+	s, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema file %s: %w", name, err)
+	}
+
+	return s, nil
+}
+
+// Parse parses a schema document. Only the subset of JSON Schema that
+// genai.Schema can express is supported, i.e. type, format, description,
+// nullable, enum, items, properties and required.
+func Parse(b []byte) (*genai.Schema, error) {
+	var m map[string]any
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, fmt.Errorf("schema is empty")
+	}
+
+	return fromMap(m, "$")
+}
+
+// FromMap converts a schema document already decoded into a map.
+func FromMap(m map[string]any) (*genai.Schema, error) {
+	return fromMap(m, "$")
+}
+
+func fromMap(m map[string]any, path string) (*genai.Schema, error) {
+	s := &genai.Schema{}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := m[key]
+		switch key {
+		case "type":
+			if err := setType(s, value, path); err != nil {
+				return nil, err
+			}
+		case "format":
+			v, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: format must be a string", path)
+			}
+			s.Format = v
+		case "description":
+			v, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: description must be a string", path)
+			}
+			s.Description = v
+		case "nullable":
+			v, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s: nullable must be a boolean", path)
+			}
+			s.Nullable = s.Nullable || v
+		case "enum":
+			v, err := toStrings(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: enum %w", path, err)
+			}
+			s.Enum = v
+		case "required":
+			v, err := toStrings(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: required %w", path, err)
+			}
+			s.Required = v
+		case "items":
+			v, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: items must be a schema", path)
+			}
+			items, err := fromMap(v, path+"[]")
+			if err != nil {
+				return nil, err
+			}
+			s.Items = items
+		case "properties":
+			v, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: properties must be a map of schemas", path)
+			}
+			s.Properties = make(map[string]*genai.Schema, len(v))
+			for name, prop := range v {
+				pm, ok := prop.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("%s.%s: property must be a schema", path, name)
+				}
+				ps, err := fromMap(pm, path+"."+name)
+				if err != nil {
+					return nil, err
+				}
+				s.Properties[name] = ps
+			}
+		default:
+			if !ignoredKeys[key] {
+				return nil, fmt.Errorf("%s: unsupported schema keyword %q", path, key)
+			}
+		}
+	}
+
+	if s.Type == genai.TypeUnspecified {
+		switch {
+		case s.Properties != nil:
+			s.Type = genai.TypeObject
+		case s.Items != nil:
+			s.Type = genai.TypeArray
+		case s.Enum != nil:
+			s.Type = genai.TypeString
+		default:
+			return nil, fmt.Errorf("%s: type is required", path)
+		}
+	}
+
+	for _, name := range s.Required {
+		if _, ok := s.Properties[name]; !ok {
+			return nil, fmt.Errorf("%s: required property %q is not defined", path, name)
+		}
+	}
+
+	return s, nil
+}
+
+// setType sets schema type from either a type name or a list of type
+// names where the only other allowed name is null, which makes the
+// schema nullable.
+func setType(s *genai.Schema, value any, path string) error {
+	var names []string
+	switch v := value.(type) {
+	case string:
+		names = []string{v}
+	case []any:
+		var err error
+		if names, err = toStrings(v); err != nil {
+			return fmt.Errorf("%s: type %w", path, err)
+		}
+	default:
+		return fmt.Errorf("%s: type must be a string or a list of strings", path)
+	}
+
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if name == "null" {
+			s.Nullable = true
+			continue
+		}
+
+		t, ok := types[name]
+		if !ok {
+			return fmt.Errorf("%s: invalid type %q", path, name)
+		}
+		if s.Type != genai.TypeUnspecified && s.Type != t {
+			return fmt.Errorf("%s: multiple types are not supported", path)
+		}
+		s.Type = t
+	}
+
+	return nil
+}
+
+func toStrings(value any) ([]string, error) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("must be a list of strings")
+	}
+
+	out := make([]string, len(list))
+	for i, item := range list {
+		v, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a list of strings")
+		}
+		out[i] = v
+	}
+
+	return out, nil
+}
+
+// Validate checks that data is a JSON document conforming to s.
+func Validate(s *genai.Schema, data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("invalid json: %w", err)
+	}
+	if dec.More() {
+		return fmt.Errorf("invalid json: unexpected data after top-level value")
+	}
+
+	if s == nil {
+		return nil
+	}
+
+	return validate(s, v, "$")
+}
+
+func validate(s *genai.Schema, v any, path string) error {
+	if v == nil {
+		if s.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s: value cannot be null", path)
+	}
+
+	switch s.Type {
+	case genai.TypeString:
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string, got %s", path, typeName(v))
+		}
+		if len(s.Enum) > 0 && !contains(s.Enum, str) {
+			return fmt.Errorf("%s: %q is not one of %s", path, str, strings.Join(s.Enum, ", "))
+		}
+	case genai.TypeNumber:
+		if _, ok := v.(json.Number); !ok {
+			return fmt.Errorf("%s: expected number, got %s", path, typeName(v))
+		}
+	case genai.TypeInteger:
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected integer, got %s", path, typeName(v))
+		}
+		if _, err := n.Int64(); err != nil {
+			return fmt.Errorf("%s: expected integer, got %s", path, n)
+		}
+	case genai.TypeBoolean:
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %s", path, typeName(v))
+		}
+	case genai.TypeArray:
+		list, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %s", path, typeName(v))
+		}
+		if s.Items != nil {
+			for i, item := range list {
+				if err := validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case genai.TypeObject:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %s", path, typeName(v))
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			value, ok := obj[name]
+			if !ok {
+				continue
+			}
+			if err := validate(s.Properties[name], value, path+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,112 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+const recipeSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "properties": {
+    "name": {"type": "string", "description": "recipe name"},
+    "servings": {"type": "integer"},
+    "difficulty": {"enum": ["easy", "hard"]},
+    "notes": {"type": ["string", "null"]},
+    "ingredients": {"type": "array", "items": {"type": "string"}}
+  },
+  "required": ["name", "ingredients"]
+}`
+
+func TestParse(t *testing.T) {
+	s, err := Parse([]byte(recipeSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"name":        {Type: genai.TypeString, Description: "recipe name"},
+			"servings":    {Type: genai.TypeInteger},
+			"difficulty":  {Type: genai.TypeString, Enum: []string{"easy", "hard"}},
+			"notes":       {Type: genai.TypeString, Nullable: true},
+			"ingredients": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+		},
+		Required: []string{"name", "ingredients"},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Fatalf("got %+v, want %+v", s, want)
+	}
+
+	yamlSchema := `
+type: array
+items:
+  type: object
+  properties:
+    score:
+      type: number
+`
+	s, err = Parse([]byte(yamlSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Type != genai.TypeArray || s.Items.Properties["score"].Type != genai.TypeNumber {
+		t.Fatalf("unexpected yaml schema %+v", s)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		`{"type": "date"}`:                                             "invalid type",
+		`{"type": "object", "oneOf": []}`:                              "unsupported schema keyword",
+		`{"type": ["string", "integer"]}`:                              "multiple types",
+		`{"properties": {"a": {"type": "string"}}, "required": ["b"]}`: "not defined",
+		`{"description": "no type"}`:                                   "type is required",
+	}
+
+	for in, want := range tests {
+		_, err := Parse([]byte(in))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%s) got error %v, want %q", in, err, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s, err := Parse([]byte(recipeSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		data    string
+		wantErr string
+	}{
+		{data: `{"name": "soup", "ingredients": ["water"], "servings": 2, "notes": null}`},
+		{data: `{"name": "soup", "ingredients": [], "extra": true}`},
+		{data: `{"name": "soup"}`, wantErr: `$: missing required property "ingredients"`},
+		{data: `{"name": "soup", "ingredients": [1]}`, wantErr: "$.ingredients[0]: expected string, got number"},
+		{data: `{"name": "soup", "ingredients": [], "servings": 2.5}`, wantErr: "$.servings: expected integer"},
+		{data: `{"name": "soup", "ingredients": [], "difficulty": "medium"}`, wantErr: "is not one of easy, hard"},
+		{data: `{"name": null, "ingredients": []}`, wantErr: "$.name: value cannot be null"},
+		{data: "```json\n{}\n```", wantErr: "invalid json"},
+		{data: `{} {}`, wantErr: "unexpected data"},
+	}
+
+	for _, tt := range tests {
+		err := Validate(s, []byte(tt.data))
+		if len(tt.wantErr) == 0 {
+			if err != nil {
+				t.Errorf("Validate(%s) got error %v", tt.data, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Validate(%s) got error %v, want %q", tt.data, err, tt.wantErr)
+		}
+	}
+}
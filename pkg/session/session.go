@@ -0,0 +1,217 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/google/uuid"
+)
+
+// Session is the structured record of a chat that can be saved to disk
+// and loaded back to continue the conversation.
+type Session struct {
+	ID                string                 `json:"id"`
+	Title             string                 `json:"title"`
+	Model             string                 `json:"model"`
+	SystemInstruction string                 `json:"systemInstruction,omitempty"`
+	GenerationConfig  genai.GenerationConfig `json:"generationConfig"`
+	Files             []File                 `json:"files,omitempty"`
+	Turns             []Turn                 `json:"turns"`
+	Usage             Usage                  `json:"usage"`
+	CreateTime        time.Time              `json:"createTime"`
+	UpdateTime        time.Time              `json:"updateTime"`
+}
+
+// Usage is the token usage accumulated over a session.
+type Usage struct {
+	PromptTokens     int32 `json:"promptTokens"`
+	CandidatesTokens int32 `json:"candidatesTokens"`
+	TotalTokens      int32 `json:"totalTokens"`
+}
+
+// File is a local file attached to the chat along with the URI of its
+// most recent upload. Remote files were uploaded beforehand, their Path
+// holds the name of the upload since there is no local file. Inline files
+// are small enough not to be uploaded, their content is sent along with
+// prompts.
+type File struct {
+	Path     string `json:"path"`
+	MIMEType string `json:"mimeType"`
+	Name     string `json:"name,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	Remote   bool   `json:"remote,omitempty"`
+	Inline   bool   `json:"inline,omitempty"`
+}
+
+// Turn is a single prompt and the text of its response. Files lists paths
+// of the session files that were attached to the prompt.
+type Turn struct {
+	Prompt   string    `json:"prompt"`
+	Response string    `json:"response"`
+	Files    []string  `json:"files,omitempty"`
+	Time     time.Time `json:"time"`
+	// FinishReason tells why the response ended when it did not end
+	// normally, for instance max tokens when it was cut off.
+	FinishReason string `json:"finishReason,omitempty"`
+	// Citations lists sources cited by the response.
+	Citations []string `json:"citations,omitempty"`
+}
+
+// New returns an empty session with a random ID.
+func New(model string) *Session {
+	now := time.Now()
+	return &Session{
+		ID:         uuid.New().String(),
+		Model:      model,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+}
+
+// Load reads a session from file.
+func Load(name string) (*Session, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session file: %w", err)
+	}
+
+	s := &Session{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("failed to parse session file %s: %w", name, err)
+	}
+
+	if len(s.ID) == 0 {
+		return nil, fmt.Errorf("session file %s has no id", name)
+	}
+
+	return s, nil
+}
+
+// Save writes the session to file, replacing it atomically.
+func (s *Session) Save(name string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize session: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create session file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+
+	return nil
+}
+
+// AddFile records a file attachment, replacing the entry with same path.
+func (s *Session) AddFile(file File) {
+	for i := range s.Files {
+		if s.Files[i].Path == file.Path {
+			s.Files[i] = file
+			return
+		}
+	}
+
+	s.Files = append(s.Files, file)
+}
+
+// AddTurn appends a turn and updates session timestamp. The first prompt
+// becomes the session title unless one is already set.
+func (s *Session) AddTurn(turn Turn) {
+	if turn.Time.IsZero() {
+		turn.Time = time.Now()
+	}
+
+	if len(s.Title) == 0 {
+		s.Title = TitleFromPrompt(turn.Prompt)
+	}
+
+	s.Turns = append(s.Turns, turn)
+	s.UpdateTime = turn.Time
+}
+
+// RemoveLastTurn removes the last turn and returns it. It reports false
+// when there are no turns to remove.
+func (s *Session) RemoveLastTurn() (Turn, bool) {
+	n := len(s.Turns)
+	if n == 0 {
+		return Turn{}, false
+	}
+
+	turn := s.Turns[n-1]
+	s.Turns = s.Turns[:n-1]
+	s.UpdateTime = time.Now()
+
+	return turn, true
+}
+
+// AddUsage accumulates token usage reported for a response.
+func (s *Session) AddUsage(usage *genai.UsageMetadata) {
+	if usage == nil {
+		return
+	}
+
+	s.Usage.PromptTokens += usage.PromptTokenCount
+	s.Usage.CandidatesTokens += usage.CandidatesTokenCount
+	s.Usage.TotalTokens += usage.TotalTokenCount
+}
+
+// History rebuilds chat history from session turns. Parts of files
+// attached to a turn are obtained from attached, which is given their
+// paths in the order they were attached.
+func (s *Session) History(attached func(paths []string) ([]genai.Part, error)) ([]*genai.Content, error) {
+	history := make([]*genai.Content, 0, 2*len(s.Turns))
+	for i, turn := range s.Turns {
+		parts := []genai.Part{genai.Text(turn.Prompt)}
+		if len(turn.Files) > 0 {
+			files, err := attached(turn.Files)
+			if err != nil {
+				return nil, fmt.Errorf("turn %d: %w", i+1, err)
+			}
+			parts = append(parts, files...)
+		}
+
+		history = append(history,
+			&genai.Content{Role: "user", Parts: parts},
+			&genai.Content{Role: "model", Parts: []genai.Part{genai.Text(turn.Response)}},
+		)
+	}
+
+	return history, nil
+}
+
+// TitleFromPrompt returns first non-blank line of prompt truncated
+// to a reasonable length.
+func TitleFromPrompt(prompt string) string {
+	const maxLen = 60
+
+	for _, line := range strings.Split(prompt, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if r := []rune(line); len(r) > maxLen {
+			return string(r[:maxLen-3]) + "..."
+		}
+		return line
+	}
+
+	return ""
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+func TestSaveLoad(t *testing.T) {
+	s := New("models/gemini-2.0-flash")
+	s.GenerationConfig.SetTemperature(0.2)
+	s.AddFile(File{Path: "/tmp/a.pdf", MIMEType: "application/pdf", URI: "uri-a"})
+	s.AddTurn(Turn{Prompt: "hello", Response: "hi", Files: []string{"/tmp/a.pdf"}})
+
+	name := filepath.Join(t.TempDir(), s.ID+".json")
+	if err := s.Save(name); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Load(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ID != s.ID || got.Model != s.Model {
+		t.Fatalf("got %s/%s, want %s/%s", got.ID, got.Model, s.ID, s.Model)
+	}
+	if got.GenerationConfig.Temperature == nil || *got.GenerationConfig.Temperature != 0.2 {
+		t.Fatalf("temperature not restored: %v", got.GenerationConfig.Temperature)
+	}
+	if !reflect.DeepEqual(got.Files, s.Files) {
+		t.Fatalf("got files %v, want %v", got.Files, s.Files)
+	}
+	if len(got.Turns) != 1 || got.Turns[0].Prompt != "hello" || got.Turns[0].Response != "hi" {
+		t.Fatalf("got turns %v", got.Turns)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	uris := func(paths []string) ([]genai.Part, error) {
+		parts := make([]genai.Part, len(paths))
+		for i, path := range paths {
+			if path != "a.pdf" {
+				return nil, fmt.Errorf("file %s is unknown", path)
+			}
+			parts[i] = genai.FileData{URI: "uri-a"}
+		}
+		return parts, nil
+	}
+
+	tests := []struct {
+		name    string
+		session *Session
+		want    []*genai.Content
+		wantErr bool
+	}{
+		{
+			name:    "empty",
+			session: &Session{},
+			want:    []*genai.Content{},
+		},
+		{
+			name: "turns with files",
+			session: &Session{
+				Turns: []Turn{
+					{Prompt: "p1", Response: "r1", Files: []string{"a.pdf"}},
+					{Prompt: "p2", Response: "r2"},
+				},
+			},
+			want: []*genai.Content{
+				{Role: "user", Parts: []genai.Part{genai.Text("p1"), genai.FileData{URI: "uri-a"}}},
+				{Role: "model", Parts: []genai.Part{genai.Text("r1")}},
+				{Role: "user", Parts: []genai.Part{genai.Text("p2")}},
+				{Role: "model", Parts: []genai.Part{genai.Text("r2")}},
+			},
+		},
+		{
+			name: "unknown file",
+			session: &Session{
+				Turns: []Turn{{Prompt: "p1", Response: "r1", Files: []string{"b.pdf"}}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.session.History(uris)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
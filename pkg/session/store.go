@@ -0,0 +1,236 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	dataDirEnv    = "XDG_DATA_HOME"
+	appDir        = "gini"
+	sessionsDir   = "sessions"
+	sessionExt    = ".json"
+	transcriptExt = ".txt"
+)
+
+// Store keeps sessions and their rendered transcripts in a directory.
+type Store struct {
+	Dir string
+	// Warnings receives warnings about session files that cannot be read,
+	// os.Stderr when nil
+	Warnings io.Writer
+}
+
+// DefaultDir returns the sessions directory under XDG data directory,
+// i.e. $XDG_DATA_HOME/gini/sessions, falling back to ~/.local/share
+// when XDG_DATA_HOME is not set.
+func DefaultDir() (string, error) {
+	dataDir := os.Getenv(dataDirEnv)
+	if len(dataDir) == 0 || !filepath.IsAbs(dataDir) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home dir: %w", err)
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+
+	return filepath.Join(dataDir, appDir, sessionsDir), nil
+}
+
+// NewStore returns a store at the default directory, creating it if needed.
+func NewStore() (*Store, error) {
+	dir, err := DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create sessions dir: %w", err)
+	}
+
+	return &Store{Dir: dir}, nil
+}
+
+// Path returns the path of the session file for given ID.
+func (s *Store) Path(id string) string {
+	return filepath.Join(s.Dir, id+sessionExt)
+}
+
+// TranscriptPath returns the path of the rendered transcript for given ID.
+func (s *Store) TranscriptPath(id string) string {
+	return filepath.Join(s.Dir, id+transcriptExt)
+}
+
+// Save writes session to the store.
+func (s *Store) Save(sess *Session) error {
+	return sess.Save(s.Path(sess.ID))
+}
+
+// Resolve returns the full session ID given either a full ID or an
+// unambiguous prefix of one. Refs containing path separators or ".."
+// are rejected.
+func (s *Store) Resolve(ref string) (string, error) {
+	if len(ref) == 0 {
+		return "", fmt.Errorf("session id cannot be empty")
+	}
+
+	// refs name sessions in the store and never files elsewhere
+	if strings.ContainsAny(ref, `/\`) || strings.Contains(ref, "..") {
+		return "", fmt.Errorf("invalid session id %s", ref)
+	}
+
+	if _, err := os.Stat(s.Path(ref)); err == nil {
+		return ref, nil
+	}
+
+	ids, err := s.ids()
+	if err != nil {
+		return "", err
+	}
+
+	var found []string
+	for _, id := range ids {
+		if strings.HasPrefix(id, ref) {
+			found = append(found, id)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("session %s not found", ref)
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("session id %s is ambiguous, matches %d sessions", ref, len(found))
+	}
+}
+
+// Get loads the session identified by full ID or unambiguous prefix.
+func (s *Store) Get(ref string) (*Session, error) {
+	id, err := s.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return Load(s.Path(id))
+}
+
+// List returns all sessions in the store, most recently updated first.
+// Session files that cannot be read, such as ones partly written, are
+// skipped with a warning.
+func (s *Store) List() ([]*Session, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	w := s.Warnings
+	if w == nil {
+		w = os.Stderr
+	}
+
+	sessions := make([]*Session, 0, len(ids))
+	for _, id := range ids {
+		sess, err := Load(s.Path(id))
+		if err != nil {
+			_, _ = fmt.Fprintf(w, "warning: skipping unreadable session: %s\n", err)
+			continue
+		}
+		sessions = append(sessions, sess)
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].UpdateTime.After(sessions[j].UpdateTime)
+	})
+
+	return sessions, nil
+}
+
+// Remove deletes the session and its transcript from the store.
+func (s *Store) Remove(ref string) (string, error) {
+	id, err := s.Resolve(ref)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.Remove(s.Path(id)); err != nil {
+		return "", fmt.Errorf("failed to remove session %s: %w", id, err)
+	}
+
+	if err := os.Remove(s.TranscriptPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to remove transcript of session %s: %w", id, err)
+	}
+
+	return id, nil
+}
+
+// Match is a session turn that matched a search query. Turn is zero
+// when only the session title matched.
+type Match struct {
+	Session *Session
+	Turn    int
+	Snippet string
+}
+
+// Search returns session turns whose title, prompt or response contain
+// query, ignoring case.
+func (s *Store) Search(query string) ([]Match, error) {
+	sessions, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(query)
+
+	var matches []Match
+	for _, sess := range sessions {
+		if strings.Contains(strings.ToLower(sess.Title), query) {
+			matches = append(matches, Match{Session: sess, Snippet: sess.Title})
+		}
+
+		for i, turn := range sess.Turns {
+			for _, text := range []string{turn.Prompt, turn.Response} {
+				if snippet, ok := findSnippet(text, query); ok {
+					matches = append(matches, Match{Session: sess, Turn: i + 1, Snippet: snippet})
+					break
+				}
+			}
+		}
+	}
+
+	return matches, nil
+}
+
+// ids returns IDs of all sessions in the store.
+func (s *Store) ids() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sessions dir: %w", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != sessionExt {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(entry.Name(), sessionExt))
+	}
+
+	return ids, nil
+}
+
+// findSnippet returns the line of text containing lower case query.
+func findSnippet(text, query string) (string, bool) {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.Contains(strings.ToLower(line), query) {
+			return strings.TrimSpace(line), true
+		}
+	}
+
+	return "", false
+}
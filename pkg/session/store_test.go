@@ -0,0 +1,165 @@
+package session
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	store, err := NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestDefaultDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dir)
+
+	got, err := DefaultDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "gini", "sessions"); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := newTestStore(t)
+
+	older := New("models/gemini-2.0-flash")
+	older.ID = "aaaa1111"
+	older.AddTurn(Turn{Prompt: "How do I tune Go GC?", Response: "Set GOGC.", Time: time.Unix(100, 0)})
+
+	newer := New("models/gemini-2.5-pro")
+	newer.ID = "aaaa2222"
+	newer.AddTurn(Turn{Prompt: "hello", Response: "Hi!\nAsk me about garbage collection.", Time: time.Unix(200, 0)})
+
+	for _, sess := range []*Session{older, newer} {
+		if err := store.Save(sess); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sessions, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != newer.ID {
+		t.Fatalf("sessions are not listed most recent first: %v", sessions)
+	}
+
+	resolveTests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{ref: "aaaa1111", want: "aaaa1111"},
+		{ref: "aaaa2", want: "aaaa2222"},
+		{ref: "aaaa", wantErr: true},
+		{ref: "bbbb", wantErr: true},
+		{ref: "", wantErr: true},
+		{ref: "../aaaa1111", wantErr: true},
+		{ref: "sessions/aaaa1111", wantErr: true},
+		{ref: "..", wantErr: true},
+	}
+	for _, tt := range resolveTests {
+		got, err := store.Resolve(tt.ref)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("resolve %q: got error %v, want error %t", tt.ref, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Fatalf("resolve %q: got %s, want %s", tt.ref, got, tt.want)
+		}
+	}
+
+	matches, err := store.Search("GARBAGE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Session.ID != newer.ID || matches[0].Turn != 1 ||
+		matches[0].Snippet != "Ask me about garbage collection." {
+		t.Fatalf("got matches %+v", matches)
+	}
+
+	matches, err = store.Search("tune go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// title derived from first prompt and the prompt itself both match
+	if len(matches) != 2 || matches[0].Turn != 0 || matches[1].Turn != 1 {
+		t.Fatalf("got matches %+v", matches)
+	}
+
+	id, err := store.Remove("aaaa1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != older.ID {
+		t.Fatalf("removed %s, want %s", id, older.ID)
+	}
+	if _, err := store.Get(older.ID); err == nil {
+		t.Fatal("removed session can still be loaded")
+	}
+}
+
+func TestStoreListSkipsUnreadable(t *testing.T) {
+	store := newTestStore(t)
+	warnings := &bytes.Buffer{}
+	store.Warnings = warnings
+
+	sess := New("models/gemini-2.0-flash")
+	sess.AddTurn(Turn{Prompt: "hello", Response: "Hi!", Time: time.Unix(100, 0)})
+	if err := store.Save(sess); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(store.Path("partial"), []byte(`{"id": "partial", "turns": [`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != sess.ID {
+		t.Fatalf("got sessions %v, want only %s", sessions, sess.ID)
+	}
+	if !strings.Contains(warnings.String(), "warning: skipping unreadable session") ||
+		!strings.Contains(warnings.String(), store.Path("partial")) {
+		t.Fatalf("got warnings %q", warnings.String())
+	}
+
+	matches, err := store.Search("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("got matches %+v", matches)
+	}
+}
+
+func TestStoreRemoveOutside(t *testing.T) {
+	store := newTestStore(t)
+
+	outside := filepath.Join(filepath.Dir(store.Dir), "config.json")
+	if err := os.WriteFile(outside, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Remove("../config"); err == nil {
+		t.Fatal("removed a file outside the store")
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Fatalf("file outside the store is gone: %v", err)
+	}
+}
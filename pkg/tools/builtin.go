@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxFileBytes limits the size of a file returned by read_file.
+const maxFileBytes = 1048576
+
+// Handler runs a tool with arguments given by the model and returns the
+// response sent back to it.
+type Handler func(ctx context.Context, args map[string]any) (map[string]any, error)
+
+type builtin struct {
+	description string
+	parameters  map[string]any
+	handler     Handler
+}
+
+var builtins = map[string]builtin{
+	"current_time": {
+		description: "Returns current local date, time and time zone",
+		handler:     currentTime,
+	},
+	"read_file": {
+		description: "Returns contents of a local text file within the working directory",
+		parameters:  pathParameters("path of the file"),
+		handler:     readFile,
+	},
+	"list_directory": {
+		description: "Lists names of entries in a local directory within the working directory, directories end with a slash",
+		parameters:  pathParameters("path of the directory"),
+		handler:     listDirectory,
+	},
+}
+
+func builtinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func pathParameters(description string) map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": description,
+			},
+		},
+		"required": []any{"path"},
+	}
+}
+
+func currentTime(ctx context.Context, args map[string]any) (map[string]any, error) {
+	now := time.Now()
+	zone, _ := now.Zone()
+
+	return map[string]any{
+		"time":     now.Format(time.RFC3339),
+		"timezone": zone,
+	}, nil
+}
+
+// localPath resolves path given to a file tool, following symbolic links,
+// and returns an error for paths outside of the working directory.
+func localPath(path string) (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	if wd, err = filepath.EvalSymlinks(wd); err != nil {
+		return "", err
+	}
+
+	resolved := path
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(wd, resolved)
+	}
+	if resolved, err = filepath.EvalSymlinks(resolved); err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(wd, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside of the working directory", path)
+	}
+
+	return resolved, nil
+}
+
+func readFile(ctx context.Context, args map[string]any) (map[string]any, error) {
+	path, _ := args["path"].(string)
+	path, err := localPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxFileBytes {
+		return nil, fmt.Errorf("file %s is larger than %d bytes", path, maxFileBytes)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{"content": string(b)}, nil
+}
+
+func listDirectory(ctx context.Context, args map[string]any) (map[string]any, error) {
+	path, _ := args["path"].(string)
+	path, err := localPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]any, len(entries))
+	for i, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		names[i] = name
+	}
+
+	return map[string]any{"entries": names}, nil
+}
@@ -0,0 +1,260 @@
+// Package tools declares functions the model can call and runs them locally,
+// either as built-in handlers or as external commands.
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/kubetrail/gini/pkg/schema"
+	"gopkg.in/yaml.v3"
+)
+
+// configKey is the key in config file listing tool declarations.
+const configKey = "tools"
+
+// maxOutputBytes limits the command output returned to the model.
+const maxOutputBytes = 65536
+
+// Tool is a function declared in config file. It runs either Command using
+// the shell or a built-in handler. Command receives call arguments as
+// a JSON object on stdin and its stdout is returned to the model.
+type Tool struct {
+	Name        string         `yaml:"name"`
+	Description string         `yaml:"description"`
+	Parameters  map[string]any `yaml:"parameters"`
+	Command     string         `yaml:"command"`
+	Builtin     string         `yaml:"builtin"`
+
+	params  *genai.Schema
+	handler Handler
+}
+
+// Registry holds tools available to the model by name.
+type Registry struct {
+	tools map[string]*Tool
+}
+
+// Load reads tool declarations from the config file. All built-in tools
+// are registered when config file is empty or declares no tools.
+func Load(configFile string) (*Registry, error) {
+	var tools []Tool
+	if len(configFile) > 0 {
+		b, err := os.ReadFile(configFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		// config is decoded again here since viper lower cases map keys,
+		// which would alter names of parameters
+		var config map[string]yaml.Node
+		if err := yaml.Unmarshal(b, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+
+		if node, ok := config[configKey]; ok {
+			if err := node.Decode(&tools); err != nil {
+				return nil, fmt.Errorf("failed to parse tools in config file: %w", err)
+			}
+		}
+	}
+
+	if len(tools) == 0 {
+		for _, name := range builtinNames() {
+			tools = append(tools, Tool{Builtin: name})
+		}
+	}
+
+	return NewRegistry(tools...)
+}
+
+// NewRegistry validates tools and returns a registry holding them.
+func NewRegistry(tools ...Tool) (*Registry, error) {
+	r := &Registry{tools: make(map[string]*Tool, len(tools))}
+
+	for i := range tools {
+		tool := tools[i]
+
+		switch {
+		case len(tool.Builtin) > 0 && len(tool.Command) > 0:
+			return nil, fmt.Errorf("tool %s cannot have both builtin and command", tool.Name)
+		case len(tool.Builtin) > 0:
+			b, ok := builtins[tool.Builtin]
+			if !ok {
+				return nil, fmt.Errorf("unknown builtin tool %s", tool.Builtin)
+			}
+			if len(tool.Name) == 0 {
+				tool.Name = tool.Builtin
+			}
+			if len(tool.Description) == 0 {
+				tool.Description = b.description
+			}
+			if tool.Parameters == nil {
+				tool.Parameters = b.parameters
+			}
+			tool.handler = b.handler
+		case len(tool.Command) > 0:
+			tool.handler = commandHandler(tool.Command)
+		default:
+			return nil, fmt.Errorf("tool %s needs either builtin or command", tool.Name)
+		}
+
+		if len(tool.Name) == 0 {
+			return nil, fmt.Errorf("tool name cannot be empty")
+		}
+		if _, ok := r.tools[tool.Name]; ok {
+			return nil, fmt.Errorf("tool %s is declared more than once", tool.Name)
+		}
+
+		if tool.Parameters != nil {
+			params, err := schema.FromMap(tool.Parameters)
+			if err != nil {
+				return nil, fmt.Errorf("invalid parameters of tool %s: %w", tool.Name, err)
+			}
+			tool.params = params
+		}
+
+		r.tools[tool.Name] = &tool
+	}
+
+	return r, nil
+}
+
+// Names returns names of registered tools in sorted order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Tools returns function declarations of registered tools for the model.
+func (r *Registry) Tools() []*genai.Tool {
+	if len(r.tools) == 0 {
+		return nil
+	}
+
+	decls := make([]*genai.FunctionDeclaration, 0, len(r.tools))
+	for _, name := range r.Names() {
+		tool := r.tools[name]
+		decls = append(decls, &genai.FunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  tool.params,
+		})
+	}
+
+	return []*genai.Tool{{FunctionDeclarations: decls}}
+}
+
+// Call runs the tool requested by the model and returns its response.
+// Failures are reported to the model in the response rather than as an
+// error so that it can recover, for instance, by fixing the arguments.
+func (r *Registry) Call(ctx context.Context, call genai.FunctionCall) genai.FunctionResponse {
+	tool, ok := r.tools[call.Name]
+	if !ok {
+		return ErrorResponse(call.Name, fmt.Errorf("unknown tool %s", call.Name))
+	}
+
+	if tool.params != nil {
+		b, err := json.Marshal(args(call))
+		if err != nil {
+			return ErrorResponse(call.Name, err)
+		}
+		if err := schema.Validate(tool.params, b); err != nil {
+			return ErrorResponse(call.Name, fmt.Errorf("invalid arguments: %w", err))
+		}
+	}
+
+	res, err := tool.handler(ctx, args(call))
+	if err != nil {
+		return ErrorResponse(call.Name, err)
+	}
+
+	return genai.FunctionResponse{Name: call.Name, Response: res}
+}
+
+// ErrorResponse returns a function response reporting err to the model.
+func ErrorResponse(name string, err error) genai.FunctionResponse {
+	return genai.FunctionResponse{
+		Name:     name,
+		Response: map[string]any{"error": err.Error()},
+	}
+}
+
+// FunctionCalls returns function calls in the first candidate of res.
+func FunctionCalls(res *genai.GenerateContentResponse) []genai.FunctionCall {
+	if res == nil || len(res.Candidates) == 0 || res.Candidates[0].Content == nil {
+		return nil
+	}
+
+	var calls []genai.FunctionCall
+	for _, part := range res.Candidates[0].Content.Parts {
+		switch v := part.(type) {
+		case genai.FunctionCall:
+			calls = append(calls, v)
+		case *genai.FunctionCall:
+			calls = append(calls, *v)
+		}
+	}
+
+	return calls
+}
+
+func args(call genai.FunctionCall) map[string]any {
+	if call.Args == nil {
+		return map[string]any{}
+	}
+
+	return call.Args
+}
+
+// commandHandler runs command using the shell passing arguments as a JSON
+// object on stdin. Output that is a JSON object is returned as is, any
+// other output is returned as text.
+func commandHandler(command string) Handler {
+	return func(ctx context.Context, args map[string]any) (map[string]any, error) {
+		in, err := json.Marshal(args)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize arguments: %w", err)
+		}
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Stdin = bytes.NewReader(in)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return nil, fmt.Errorf("command exited with code %d: %s",
+					exitErr.ExitCode(), strings.TrimSpace(stderr.String()))
+			}
+			return nil, fmt.Errorf("failed to run command: %w", err)
+		}
+
+		out := stdout.Bytes()
+		if len(out) > maxOutputBytes {
+			out = out[:maxOutputBytes]
+		}
+
+		var res map[string]any
+		if err := json.Unmarshal(out, &res); err == nil && res != nil {
+			return res, nil
+		}
+
+		return map[string]any{"output": string(out)}, nil
+	}
+}
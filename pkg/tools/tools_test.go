@@ -0,0 +1,167 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+const config = `api-key: secret
+tools:
+  - name: greet
+    description: Greets a person
+    parameters:
+      type: object
+      properties:
+        firstName:
+          type: string
+      required: [firstName]
+    command: 'read -r args; echo "{\"args\": $args}"'
+  - name: fail
+    command: echo oops >&2; exit 3
+  - builtin: read_file
+`
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".gini.yaml")
+	if err := os.WriteFile(file, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := r.Names(), []string{"fail", "greet", "read_file"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got tools %v, want %v", got, want)
+	}
+
+	decls := r.Tools()[0].FunctionDeclarations
+	greet := decls[1]
+	if greet.Description != "Greets a person" {
+		t.Fatalf("got description %q", greet.Description)
+	}
+	// parameter names keep their case
+	if _, ok := greet.Parameters.Properties["firstName"]; !ok {
+		t.Fatalf("got parameters %+v", greet.Parameters.Properties)
+	}
+	if decls[2].Parameters == nil || len(decls[2].Description) == 0 {
+		t.Fatalf("builtin declaration was not filled in: %+v", decls[2])
+	}
+}
+
+func TestLoadDefaultsToBuiltins(t *testing.T) {
+	r, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := r.Names(), builtinNames(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got tools %v, want %v", got, want)
+	}
+}
+
+func TestNewRegistryErrors(t *testing.T) {
+	tests := []struct {
+		tools []Tool
+		want  string
+	}{
+		{tools: []Tool{{Name: "x"}}, want: "needs either builtin or command"},
+		{tools: []Tool{{Name: "x", Builtin: "nope"}}, want: "unknown builtin"},
+		{tools: []Tool{{Name: "x", Builtin: "read_file", Command: "true"}}, want: "cannot have both"},
+		{tools: []Tool{{Command: "true"}}, want: "name cannot be empty"},
+		{tools: []Tool{{Name: "x", Command: "true"}, {Name: "x", Command: "true"}}, want: "more than once"},
+		{tools: []Tool{{Name: "x", Command: "true", Parameters: map[string]any{"type": "date"}}}, want: "invalid parameters"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewRegistry(tt.tools...)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got error %v, want %q", err, tt.want)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "work")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, ".gini.yaml")
+	if err := os.WriteFile(file, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "secret"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(parent, "secret"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// file tools are limited to the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	r, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		call genai.FunctionCall
+		want map[string]any
+	}{
+		{
+			call: genai.FunctionCall{Name: "greet", Args: map[string]any{"firstName": "Ada"}},
+			want: map[string]any{"args": map[string]any{"firstName": "Ada"}},
+		},
+		{
+			call: genai.FunctionCall{Name: "greet", Args: map[string]any{}},
+			want: map[string]any{"error": `invalid arguments: $: missing required property "firstName"`},
+		},
+		{
+			call: genai.FunctionCall{Name: "fail"},
+			want: map[string]any{"error": "command exited with code 3: oops"},
+		},
+		{
+			call: genai.FunctionCall{Name: "read_file", Args: map[string]any{"path": file}},
+			want: map[string]any{"content": config},
+		},
+		{
+			call: genai.FunctionCall{Name: "read_file", Args: map[string]any{"path": ".gini.yaml"}},
+			want: map[string]any{"content": config},
+		},
+		{
+			call: genai.FunctionCall{Name: "read_file", Args: map[string]any{"path": "../secret"}},
+			want: map[string]any{"error": "path ../secret is outside of the working directory"},
+		},
+		{
+			call: genai.FunctionCall{Name: "read_file", Args: map[string]any{"path": "link"}},
+			want: map[string]any{"error": "path link is outside of the working directory"},
+		},
+		{
+			call: genai.FunctionCall{Name: "missing"},
+			want: map[string]any{"error": "unknown tool missing"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := r.Call(context.Background(), tt.call)
+		if got.Name != tt.call.Name || !reflect.DeepEqual(got.Response, tt.want) {
+			t.Errorf("Call(%s) got %v, want %v", tt.call.Name, got.Response, tt.want)
+		}
+	}
+}